@@ -0,0 +1,15 @@
+package buildinfo
+
+import "time"
+
+// Build metadata, injected at build time with:
+//
+//	go build -ldflags "-X blog-backend/buildinfo.Version=v1.2.3 -X blog-backend/buildinfo.Commit=abc123 -X blog-backend/buildinfo.BuildTime=2024-01-01T00:00:00Z"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = ""
+)
+
+// StartTime is when the process started
+var StartTime = time.Now()
@@ -0,0 +1,18 @@
+package config
+
+import "time"
+
+// CommentConfig controls the public comment endpoint
+type CommentConfig struct {
+	RateLimit  int
+	RateWindow time.Duration
+}
+
+// LoadCommentConfig reads COMMENT_RATE_LIMIT and COMMENT_RATE_WINDOW
+// (default 10 comments per IP per 10m) from the environment
+func LoadCommentConfig() CommentConfig {
+	return CommentConfig{
+		RateLimit:  getInt("COMMENT_RATE_LIMIT", 10),
+		RateWindow: getDuration("COMMENT_RATE_WINDOW", 10*time.Minute),
+	}
+}
@@ -20,7 +20,10 @@ func InitDatabase() (*gorm.DB, error) {
 		)
 	}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		// Surface driver errors such as unique violations as gorm.ErrDuplicatedKey
+		TranslateError: true,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
@@ -0,0 +1,31 @@
+package config
+
+import "strconv"
+
+// ImageConfig controls the variants rendered for uploaded images
+type ImageConfig struct {
+	Widths      []int
+	Workers     int
+	JPEGQuality int
+}
+
+// LoadImageConfig reads IMAGE_WIDTHS (comma separated, default
+// 320,640,1024,1600), IMAGE_WORKERS (default 2, the number of images
+// processed at once) and IMAGE_JPEG_QUALITY (default 82) from the
+// environment
+func LoadImageConfig() ImageConfig {
+	widths := []int{320, 640, 1024, 1600}
+	if list := getList("IMAGE_WIDTHS"); len(list) > 0 {
+		widths = widths[:0]
+		for _, item := range list {
+			if w, err := strconv.Atoi(item); err == nil && w > 0 {
+				widths = append(widths, w)
+			}
+		}
+	}
+	return ImageConfig{
+		Widths:      widths,
+		Workers:     getInt("IMAGE_WORKERS", 2),
+		JPEGQuality: getInt("IMAGE_JPEG_QUALITY", 82),
+	}
+}
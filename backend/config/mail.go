@@ -0,0 +1,43 @@
+package config
+
+import "time"
+
+// MailConfig configures outgoing email. Without an SMTP host messages are
+// only logged.
+type MailConfig struct {
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+}
+
+// LoadMailConfig reads SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME,
+// SMTP_PASSWORD and MAIL_FROM from the environment
+func LoadMailConfig() MailConfig {
+	return MailConfig{
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getInt("SMTP_PORT", 587),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		From:         getEnv("MAIL_FROM", "noreply@localhost"),
+	}
+}
+
+// ContactConfig controls the public contact form
+type ContactConfig struct {
+	NotifyTo   []string
+	RateLimit  int
+	RateWindow time.Duration
+}
+
+// LoadContactConfig reads CONTACT_NOTIFY_TO (comma-separated addresses to
+// notify of new messages) and CONTACT_RATE_LIMIT and CONTACT_RATE_WINDOW
+// (default 3 messages per IP per hour) from the environment
+func LoadContactConfig() ContactConfig {
+	return ContactConfig{
+		NotifyTo:   getList("CONTACT_NOTIFY_TO"),
+		RateLimit:  getInt("CONTACT_RATE_LIMIT", 3),
+		RateWindow: getDuration("CONTACT_RATE_WINDOW", time.Hour),
+	}
+}
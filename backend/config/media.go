@@ -0,0 +1,19 @@
+package config
+
+import "time"
+
+// MediaConfig controls the clean-up of unused media
+type MediaConfig struct {
+	OrphanRetention time.Duration
+	CleanupInterval time.Duration
+}
+
+// LoadMediaConfig reads MEDIA_ORPHAN_RETENTION_DAYS (default 7, 0 keeps
+// unused media forever) and MEDIA_CLEANUP_INTERVAL (default 1h) from the
+// environment
+func LoadMediaConfig() MediaConfig {
+	return MediaConfig{
+		OrphanRetention: time.Duration(getInt("MEDIA_ORPHAN_RETENTION_DAYS", 7)) * 24 * time.Hour,
+		CleanupInterval: getDuration("MEDIA_CLEANUP_INTERVAL", time.Hour),
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// MetricsConfig controls who may scrape /metrics. A request is allowed when it
+// carries the bearer token or comes from an address in the allowlist.
+type MetricsConfig struct {
+	Token       string
+	AllowedNets []*net.IPNet
+}
+
+// LoadMetricsConfig reads METRICS_TOKEN and METRICS_ALLOWLIST (comma-separated
+// IPs or CIDRs, loopback only by default) from the environment
+func LoadMetricsConfig() MetricsConfig {
+	return MetricsConfig{
+		Token:       os.Getenv("METRICS_TOKEN"),
+		AllowedNets: parseNets(getEnv("METRICS_ALLOWLIST", "127.0.0.1/32,::1/128")),
+	}
+}
+
+// parseNets parses a comma-separated list of IPs and CIDRs, skipping invalid
+// entries
+func parseNets(list string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				log.Printf("Ignoring invalid address %q", entry)
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Ignoring invalid CIDR %q: %v", entry, err)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+
+	"blog-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Models lists every model managed by AutoMigrate
+func Models() []interface{} {
+	return []interface{}{
+		&models.User{},
+		&models.Post{},
+		&models.Activity{},
+		&models.Project{},
+		&models.PostRevision{},
+		&models.PostTransition{},
+		&models.PreviewLink{},
+		&models.Series{},
+		&models.SeriesEntry{},
+		&models.RelatedPost{},
+		&models.Comment{},
+		&models.SpamToken{},
+		&models.ContactMessage{},
+		&models.Media{},
+		&models.MediaReference{},
+		&models.MediaObject{},
+		&models.ResumableUpload{},
+	}
+}
+
+// Migrate brings the schema up to date
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(Models()...); err != nil {
+		return err
+	}
+
+	// Media with the same content now shares a storage key
+	if db.Migrator().HasIndex(&models.Media{}, "idx_media_storage_key") {
+		if err := db.Migrator().DropIndex(&models.Media{}, "idx_media_storage_key"); err != nil {
+			return err
+		}
+	}
+
+	// Posts published before the editorial workflow existed start out as
+	// drafts when the status column is added
+	return db.Model(&models.Post{}).
+		Where("published = ? AND status = ?", true, models.StatusDraft).
+		Update("status", models.StatusPublished).Error
+}
+
+// PendingMigrations returns the tables and columns that are missing from the
+// database, i.e. what Migrate would still have to create
+func PendingMigrations(db *gorm.DB) ([]string, error) {
+	var pending []string
+	migrator := db.Migrator()
+
+	for _, model := range Models() {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("failed to parse model %T: %v", model, err)
+		}
+
+		table := stmt.Schema.Table
+		if !migrator.HasTable(model) {
+			pending = append(pending, table)
+			continue
+		}
+
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue
+			}
+			if !migrator.HasColumn(model, field.DBName) {
+				pending = append(pending, table+"."+field.DBName)
+			}
+		}
+	}
+
+	return pending, nil
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+// ProofOfWorkConfig tunes the challenges anonymous clients solve before
+// submitting
+type ProofOfWorkConfig struct {
+	Secret         string
+	Difficulty     int
+	MaxDifficulty  int
+	TTL            time.Duration
+	ThrottleWindow time.Duration
+	RateLimit      int
+	RateWindow     time.Duration
+}
+
+// LoadProofOfWorkConfig reads POW_SECRET (default JWT_SECRET), POW_DIFFICULTY
+// (leading zero bits, default 16), POW_MAX_DIFFICULTY (default 22),
+// POW_CHALLENGE_TTL (default 5m), POW_THROTTLE_WINDOW (how long a rate
+// limited IP gets harder challenges, default 10m), and POW_RATE_LIMIT and
+// POW_RATE_WINDOW (default 10 challenges per 10m) from the environment
+func LoadProofOfWorkConfig() ProofOfWorkConfig {
+	return ProofOfWorkConfig{
+		Secret:         getEnv("POW_SECRET", os.Getenv("JWT_SECRET")),
+		Difficulty:     getInt("POW_DIFFICULTY", 16),
+		MaxDifficulty:  getInt("POW_MAX_DIFFICULTY", 22),
+		TTL:            getDuration("POW_CHALLENGE_TTL", 5*time.Minute),
+		ThrottleWindow: getDuration("POW_THROTTLE_WINDOW", 10*time.Minute),
+		RateLimit:      getInt("POW_RATE_LIMIT", 10),
+		RateWindow:     getDuration("POW_RATE_WINDOW", 10*time.Minute),
+	}
+}
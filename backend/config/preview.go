@@ -0,0 +1,9 @@
+package config
+
+import "time"
+
+// LoadPreviewTTL reads PREVIEW_LINK_TTL, the default lifetime of draft preview
+// links (default 72h)
+func LoadPreviewTTL() time.Duration {
+	return getDuration("PREVIEW_LINK_TTL", 72*time.Hour)
+}
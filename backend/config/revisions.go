@@ -0,0 +1,18 @@
+package config
+
+import "time"
+
+// RevisionConfig controls how much post revision history is kept
+type RevisionConfig struct {
+	MaxCount int
+	MaxAge   time.Duration
+}
+
+// LoadRevisionConfig reads REVISION_RETENTION_COUNT (default 50) and
+// REVISION_RETENTION_DAYS (default 0, keep forever) from the environment
+func LoadRevisionConfig() RevisionConfig {
+	return RevisionConfig{
+		MaxCount: getInt("REVISION_RETENTION_COUNT", 50),
+		MaxAge:   time.Duration(getInt("REVISION_RETENTION_DAYS", 0)) * 24 * time.Hour,
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Port              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownDelay is how long the server keeps serving after it has been
+	// marked not-ready, giving load balancers time to stop routing to it.
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
+	// TrustedProxies lists the proxy IPs/CIDRs whose X-Forwarded-For header is
+	// believed when resolving the client IP. Empty trusts no proxy.
+	TrustedProxies []string
+	// TrustedPlatform names a CDN header to take the client IP from
+	// (e.g. CF-Connecting-IP)
+	TrustedPlatform string
+}
+
+// LoadServerConfig reads the server settings from the environment
+func LoadServerConfig() ServerConfig {
+	return ServerConfig{
+		Port:              getEnv("PORT", "8080"),
+		ReadTimeout:       getDuration("SERVER_READ_TIMEOUT", 15*time.Second),
+		ReadHeaderTimeout: getDuration("SERVER_READ_HEADER_TIMEOUT", 5*time.Second),
+		WriteTimeout:      getDuration("SERVER_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       getDuration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+		ShutdownDelay:     getDuration("SERVER_SHUTDOWN_DELAY", 0),
+		ShutdownTimeout:   getDuration("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second),
+		TrustedProxies:    getList("TRUSTED_PROXIES"),
+		TrustedPlatform:   os.Getenv("TRUSTED_PLATFORM"),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s (%q), using %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+func getFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid number for %s (%q), using %g", key, value, fallback)
+		return fallback
+	}
+	return f
+}
+
+func getInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s (%q), using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+func getBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean for %s (%q), using %t", key, value, fallback)
+		return fallback
+	}
+	return b
+}
@@ -0,0 +1,31 @@
+package config
+
+import "time"
+
+// SpamConfig tunes the local spam scoring of public submissions
+type SpamConfig struct {
+	MinFillTime time.Duration
+	MaxLinks    int
+	Blocklist   []string
+	RateLimit   int
+	RateWindow  time.Duration
+	Threshold   float64
+	MinTraining int
+}
+
+// LoadSpamConfig reads SPAM_MIN_FILL_TIME (default 3s), SPAM_MAX_LINKS
+// (default 2), SPAM_BLOCKLIST (comma separated), SPAM_RATE_LIMIT and
+// SPAM_RATE_WINDOW (default 5 per 10m), SPAM_THRESHOLD (default 1.0) and
+// SPAM_MIN_TRAINING (default 5 moderated submissions before the classifier
+// scores anything) from the environment
+func LoadSpamConfig() SpamConfig {
+	return SpamConfig{
+		MinFillTime: getDuration("SPAM_MIN_FILL_TIME", 3*time.Second),
+		MaxLinks:    getInt("SPAM_MAX_LINKS", 2),
+		Blocklist:   getList("SPAM_BLOCKLIST"),
+		RateLimit:   getInt("SPAM_RATE_LIMIT", 5),
+		RateWindow:  getDuration("SPAM_RATE_WINDOW", 10*time.Minute),
+		Threshold:   getFloat("SPAM_THRESHOLD", 1.0),
+		MinTraining: getInt("SPAM_MIN_TRAINING", 5),
+	}
+}
@@ -0,0 +1,42 @@
+package config
+
+import "time"
+
+// Storage drivers
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+// StorageConfig selects where uploaded files are kept. Dir is used by the
+// local driver, the S3 fields by the s3 driver.
+type StorageConfig struct {
+	Driver      string
+	Dir         string
+	Endpoint    string
+	Region      string
+	Bucket      string
+	AccessKey   string
+	SecretKey   string
+	UseSSL      bool
+	RedirectTTL time.Duration
+}
+
+// LoadStorageConfig reads STORAGE_DRIVER (local or s3, default local),
+// STORAGE_DIR (default ./uploads), S3_ENDPOINT, S3_REGION, S3_BUCKET,
+// S3_ACCESS_KEY, S3_SECRET_KEY, S3_USE_SSL (default true) and
+// STORAGE_REDIRECT_TTL (default 0, which proxies files instead of
+// redirecting to presigned S3 URLs) from the environment
+func LoadStorageConfig() StorageConfig {
+	return StorageConfig{
+		Driver:      getEnv("STORAGE_DRIVER", StorageLocal),
+		Dir:         getEnv("STORAGE_DIR", "./uploads"),
+		Endpoint:    getEnv("S3_ENDPOINT", ""),
+		Region:      getEnv("S3_REGION", ""),
+		Bucket:      getEnv("S3_BUCKET", ""),
+		AccessKey:   getEnv("S3_ACCESS_KEY", ""),
+		SecretKey:   getEnv("S3_SECRET_KEY", ""),
+		UseSSL:      getBool("S3_USE_SSL", true),
+		RedirectTTL: getDuration("STORAGE_REDIRECT_TTL", 0),
+	}
+}
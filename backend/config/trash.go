@@ -0,0 +1,18 @@
+package config
+
+import "time"
+
+// TrashConfig controls how long soft-deleted items are kept
+type TrashConfig struct {
+	Retention     time.Duration
+	PurgeInterval time.Duration
+}
+
+// LoadTrashConfig reads TRASH_RETENTION_DAYS (default 30, 0 keeps items
+// forever) and TRASH_PURGE_INTERVAL (default 1h) from the environment
+func LoadTrashConfig() TrashConfig {
+	return TrashConfig{
+		Retention:     time.Duration(getInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		PurgeInterval: getDuration("TRASH_PURGE_INTERVAL", time.Hour),
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import "time"
+
+// UploadConfig limits uploaded files. Sizes are in bytes.
+type UploadConfig struct {
+	MaxImageSize       int64
+	MaxPDFSize         int64
+	MaxVideoSize       int64
+	MaxMultipartMemory int64
+	MaxChunkSize       int64
+	ResumableExpiry    time.Duration
+	CleanupInterval    time.Duration
+}
+
+// LoadUploadConfig reads UPLOAD_MAX_IMAGE_MB (default 10), UPLOAD_MAX_PDF_MB
+// (default 20), UPLOAD_MAX_VIDEO_MB (default 500), UPLOAD_MULTIPART_MEMORY_MB
+// (default 8, the part of a multipart form kept in memory before spilling to
+// temporary files), UPLOAD_CHUNK_MB (default 8, the largest chunk of a
+// resumable upload), UPLOAD_RESUMABLE_EXPIRY (default 24h without progress
+// before an unfinished upload is deleted) and UPLOAD_CLEANUP_INTERVAL
+// (default 1h) from the environment
+func LoadUploadConfig() UploadConfig {
+	return UploadConfig{
+		MaxImageSize:       int64(getInt("UPLOAD_MAX_IMAGE_MB", 10)) << 20,
+		MaxPDFSize:         int64(getInt("UPLOAD_MAX_PDF_MB", 20)) << 20,
+		MaxVideoSize:       int64(getInt("UPLOAD_MAX_VIDEO_MB", 500)) << 20,
+		MaxMultipartMemory: int64(getInt("UPLOAD_MULTIPART_MEMORY_MB", 8)) << 20,
+		MaxChunkSize:       int64(getInt("UPLOAD_CHUNK_MB", 8)) << 20,
+		ResumableExpiry:    getDuration("UPLOAD_RESUMABLE_EXPIRY", 24*time.Hour),
+		CleanupInterval:    getDuration("UPLOAD_CLEANUP_INTERVAL", time.Hour),
+	}
+}
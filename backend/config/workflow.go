@@ -0,0 +1,19 @@
+package config
+
+import "time"
+
+// WorkflowConfig controls the post background jobs
+type WorkflowConfig struct {
+	PublishInterval time.Duration
+	RelatedInterval time.Duration
+}
+
+// LoadWorkflowConfig reads SCHEDULED_PUBLISH_INTERVAL (default 1m), how often
+// scheduled posts are checked for publication, and RELATED_POSTS_INTERVAL
+// (default 24h), how often related posts are recomputed when no post changes
+func LoadWorkflowConfig() WorkflowConfig {
+	return WorkflowConfig{
+		PublishInterval: getDuration("SCHEDULED_PUBLISH_INTERVAL", time.Minute),
+		RelatedInterval: getDuration("RELATED_POSTS_INTERVAL", 24*time.Hour),
+	}
+}
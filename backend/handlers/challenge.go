@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"blog-backend/logging"
+	"blog-backend/pow"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChallengeHandler issues proof-of-work challenges to anonymous clients
+type ChallengeHandler struct {
+	issuer *pow.Issuer
+}
+
+// NewChallengeHandler creates a new challenge handler instance
+func NewChallengeHandler(issuer *pow.Issuer) *ChallengeHandler {
+	return &ChallengeHandler{issuer: issuer}
+}
+
+// Issue returns a fresh challenge for the calling client. The difficulty
+// rises for clients that request many challenges.
+func (h *ChallengeHandler) Issue(c *gin.Context) {
+	challenge, err := h.issuer.Issue(c.ClientIP())
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to issue challenge: %v", err)
+		c.Error(err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, challenge)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"blog-backend/logging"
+	"blog-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Comment handlers
+func (h *Handler) GetPostComments(c *gin.Context) {
+	slug := c.Param("slug")
+	comments, err := h.svc.ListPostComments(c.Request.Context(), slug)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get comments for post %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, comments)
+}
+
+// CreateComment accepts comments from guests and signed-in users; guest
+// comments are held for moderation
+func (h *Handler) CreateComment(c *gin.Context) {
+	slug := c.Param("slug")
+	var input service.CommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.Printf(c.Request.Context(), "Create comment validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	input.IP = c.ClientIP()
+	input.UserAgent = c.Request.UserAgent()
+
+	comment, err := h.svc.CreateComment(c.Request.Context(), slug, input)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to create comment on post %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Comment %d created on post %s (%s)", comment.ID, slug, comment.Status)
+	c.JSON(http.StatusCreated, comment)
+}
+
+// GetComments lists comments for moderation, filtered by the status query
+// parameter and paged with page and pageSize
+func (h *Handler) GetComments(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("pageSize"))
+
+	result, err := h.svc.ListCommentsForModeration(c.Request.Context(), c.Query("status"), page, pageSize)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get comments: %v", err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// ModerateComments sets the status of several comments at once
+func (h *Handler) ModerateComments(c *gin.Context) {
+	var input struct {
+		IDs    []uint `json:"ids" binding:"required,min=1,max=500"`
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.Printf(c.Request.Context(), "Moderate comments validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	updated, err := h.svc.ModerateComments(c.Request.Context(), input.IDs, input.Status)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to moderate comments: %v", err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Moved %d comments to %s", updated, input.Status)
+	c.JSON(http.StatusOK, gin.H{"updated": updated})
+}
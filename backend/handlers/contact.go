@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"blog-backend/logging"
+	"blog-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubmitContactMessage accepts a message from the public contact form. The
+// response is the same whether or not the spam filter caught it.
+func (h *Handler) SubmitContactMessage(c *gin.Context) {
+	var input service.ContactInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.Printf(c.Request.Context(), "Contact message validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	input.IP = c.ClientIP()
+	input.UserAgent = c.Request.UserAgent()
+
+	msg, err := h.svc.SubmitContactMessage(c.Request.Context(), input)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to store contact message: %v", err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Contact message %d received (spam: %v)", msg.ID, msg.Spam)
+	c.JSON(http.StatusAccepted, gin.H{"status": "received"})
+}
+
+// GetContactMessages lists a folder of the contact inbox, chosen with the
+// folder query parameter and paged with page and pageSize
+func (h *Handler) GetContactMessages(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("pageSize"))
+
+	result, err := h.svc.ListContactMessages(c.Request.Context(), c.Query("folder"), page, pageSize)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get contact messages: %v", err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetContactMessage returns one message and marks it read
+func (h *Handler) GetContactMessage(c *gin.Context) {
+	id, err := contactMessageID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	msg, err := h.svc.GetContactMessage(c.Request.Context(), id)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get contact message %d: %v", id, err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, msg)
+}
+
+// UpdateContactMessage changes the read, archived and spam state of a message
+func (h *Handler) UpdateContactMessage(c *gin.Context) {
+	id, err := contactMessageID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	var input service.ContactUpdate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.Printf(c.Request.Context(), "Contact message update validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	msg, err := h.svc.UpdateContactMessage(c.Request.Context(), id, input)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to update contact message %d: %v", id, err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, msg)
+}
+
+// RecordContactReply notes that a message was answered
+func (h *Handler) RecordContactReply(c *gin.Context) {
+	id, err := contactMessageID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	var input struct {
+		Note string `json:"note" binding:"max=2000"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.Printf(c.Request.Context(), "Contact reply validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	msg, err := h.svc.RecordContactReply(c.Request.Context(), id, input.Note)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to record reply to contact message %d: %v", id, err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, msg)
+}
+
+func contactMessageID(param string) (uint, error) {
+	id, err := strconv.ParseUint(param, 10, 32)
+	if err != nil {
+		return 0, service.Validation("invalid_contact_message_id", "Invalid contact message ID", nil)
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setETag sends the entity tag and asks caches to revalidate before reuse
+func setETag(c *gin.Context, etag string) {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+}
+
+// ifMatch returns the entity tags listed in the If-Match header. Weak tags
+// are dropped because If-Match requires a strong comparison.
+func ifMatch(c *gin.Context) []string {
+	var tags []string
+	for _, tag := range parseETags(c.GetHeader("If-Match")) {
+		if !strings.HasPrefix(tag, "W/") {
+			tags = append(tags, tag)
+		}
+	}
+	if tags == nil && c.GetHeader("If-Match") != "" {
+		// Only weak tags were sent; they can never match
+		return []string{""}
+	}
+	return tags
+}
+
+// notModified reports whether If-None-Match matches etag using the weak
+// comparison, in which case the client's cached copy is still current
+func notModified(c *gin.Context, etag string) bool {
+	for _, tag := range parseETags(c.GetHeader("If-None-Match")) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func parseETags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
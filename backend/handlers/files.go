@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"blog-backend/logging"
+	"blog-backend/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FileHandler serves uploaded files from the storage backend
+type FileHandler struct {
+	store       storage.Backend
+	redirectTTL time.Duration
+}
+
+// NewFileHandler serves files from store. With a positive redirectTTL
+// clients are redirected to a presigned URL valid that long instead of
+// having the file proxied.
+func NewFileHandler(store storage.Backend, redirectTTL time.Duration) *FileHandler {
+	return &FileHandler{store: store, redirectTTL: redirectTTL}
+}
+
+// Serve sends the file named by the key parameter, honouring range and
+// conditional requests. Keys starting with a dot hold unfinished uploads and
+// readiness probes and are never served.
+func (h *FileHandler) Serve(c *gin.Context) {
+	ctx := c.Request.Context()
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if strings.HasPrefix(key, ".") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if h.redirectTTL > 0 {
+		url, err := h.store.PresignedURL(ctx, key, h.redirectTTL)
+		if err == nil {
+			c.Redirect(http.StatusFound, url)
+			return
+		}
+		if !errors.Is(err, storage.ErrInvalidKey) {
+			logging.Printf(ctx, "Failed to presign %s: %v", key, err)
+		}
+	}
+
+	obj, err := h.store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.Printf(ctx, "Failed to open %s: %v", key, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	defer obj.Body.Close()
+
+	if obj.ContentType != "" {
+		c.Header("Content-Type", obj.ContentType)
+	}
+	http.ServeContent(c.Writer, c.Request, path.Base(key), obj.ModTime, obj.Body)
+}
@@ -1,13 +1,11 @@
 package handlers
 
 import (
+	"blog-backend/logging"
 	"blog-backend/models"
 	"blog-backend/service"
-	"fmt"
-	"log"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -30,19 +28,19 @@ func (h *Handler) Login(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		log.Printf("Login validation failed: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		logging.Printf(c.Request.Context(), "Login validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	user, token, err := h.svc.Login(input.Email, input.Password)
+	user, token, err := h.svc.Login(c.Request.Context(), input.Email, input.Password)
 	if err != nil {
-		log.Printf("Login failed for user %s: %v", input.Email, err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		logging.Printf(c.Request.Context(), "Login failed for user %s: %v", input.Email, err)
+		c.Error(err)
 		return
 	}
 
-	log.Printf("User logged in successfully: %s", user.Email)
+	logging.Printf(c.Request.Context(), "User logged in successfully: %s", user.Email)
 	c.JSON(http.StatusOK, gin.H{
 		"token": token,
 		"user": gin.H{
@@ -62,19 +60,19 @@ func (h *Handler) Register(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		log.Printf("Register validation failed: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		logging.Printf(c.Request.Context(), "Register validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	user, token, err := h.svc.Register(input.Name, input.Email, input.Password)
+	user, token, err := h.svc.Register(c.Request.Context(), input.Name, input.Email, input.Password)
 	if err != nil {
-		log.Printf("Register failed for user %s: %v", input.Email, err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		logging.Printf(c.Request.Context(), "Register failed for user %s: %v", input.Email, err)
+		c.Error(err)
 		return
 	}
 
-	log.Printf("User registered successfully: %s", user.Email)
+	logging.Printf(c.Request.Context(), "User registered successfully: %s", user.Email)
 	c.JSON(http.StatusCreated, gin.H{
 		"token": token,
 		"user": gin.H{
@@ -87,10 +85,10 @@ func (h *Handler) Register(c *gin.Context) {
 
 // Post handlers
 func (h *Handler) GetPosts(c *gin.Context) {
-	posts, err := h.svc.ListPosts()
+	posts, err := h.svc.ListPosts(c.Request.Context())
 	if err != nil {
-		log.Printf("Failed to get posts: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		logging.Printf(c.Request.Context(), "Failed to get posts: %v", err)
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, posts)
@@ -98,70 +96,145 @@ func (h *Handler) GetPosts(c *gin.Context) {
 
 func (h *Handler) GetPost(c *gin.Context) {
 	slug := c.Param("slug")
-	post, err := h.svc.GetPost(slug)
+	post, err := h.svc.GetPost(c.Request.Context(), slug)
 	if err != nil {
-		log.Printf("Failed to get post %s: %v", slug, err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		logging.Printf(c.Request.Context(), "Failed to get post %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+
+	setETag(c, post.ETag())
+	if notModified(c, post.ETag()) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(http.StatusOK, post)
+}
+
+// GetManagedPosts lists the posts the current user may edit, in every
+// workflow state
+func (h *Handler) GetManagedPosts(c *gin.Context) {
+	posts, err := h.svc.ListManagedPosts(c.Request.Context())
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get managed posts: %v", err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, posts)
+}
+
+// GetManagedPost returns a post in any workflow state to its author or an
+// editor
+func (h *Handler) GetManagedPost(c *gin.Context) {
+	slug := c.Param("slug")
+	post, err := h.svc.GetManagedPost(c.Request.Context(), slug)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get managed post %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+
+	setETag(c, post.ETag())
+	if notModified(c, post.ETag()) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 	c.JSON(http.StatusOK, post)
 }
 
+// GetRelatedPosts returns published posts to read next, best match first.
+// The optional limit query parameter caps the number of posts.
+func (h *Handler) GetRelatedPosts(c *gin.Context) {
+	slug := c.Param("slug")
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	posts, err := h.svc.ListRelatedPosts(c.Request.Context(), slug, limit)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get related posts for %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, posts)
+}
+
 func (h *Handler) CreatePost(c *gin.Context) {
 	var post models.Post
 	if err := c.ShouldBindJSON(&post); err != nil {
-		log.Printf("Create post validation failed: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		logging.Printf(c.Request.Context(), "Create post validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	if err := h.svc.CreatePost(&post); err != nil {
-		log.Printf("Failed to create post: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.svc.CreatePost(c.Request.Context(), &post); err != nil {
+		logging.Printf(c.Request.Context(), "Failed to create post: %v", err)
+		c.Error(err)
 		return
 	}
 
-	log.Printf("Post created successfully: %s", post.Title)
+	logging.Printf(c.Request.Context(), "Post created successfully: %s", post.Title)
 	c.JSON(http.StatusCreated, post)
 }
 
 func (h *Handler) UpdatePost(c *gin.Context) {
 	slug := c.Param("slug")
-	var post models.Post
-	if err := c.ShouldBindJSON(&post); err != nil {
-		log.Printf("Update post validation failed: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var changes models.Post
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		logging.Printf(c.Request.Context(), "Update post validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	post, err := h.svc.UpdatePost(c.Request.Context(), slug, &changes, ifMatch(c))
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to update post %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Post updated successfully: %s", post.Title)
+	setETag(c, post.ETag())
+	c.JSON(http.StatusOK, post)
+}
+
+// PatchPost applies a JSON merge patch (RFC 7396) to a post
+func (h *Handler) PatchPost(c *gin.Context) {
+	slug := c.Param("slug")
+	var patch service.Patch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		logging.Printf(c.Request.Context(), "Patch post validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	post.Slug = slug
-	if err := h.svc.UpdatePost(&post); err != nil {
-		log.Printf("Failed to update post %s: %v", slug, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	post, err := h.svc.PatchPost(c.Request.Context(), slug, patch, ifMatch(c))
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to patch post %s: %v", slug, err)
+		c.Error(err)
 		return
 	}
 
-	log.Printf("Post updated successfully: %s", post.Title)
+	logging.Printf(c.Request.Context(), "Post patched successfully: %s", post.Title)
+	setETag(c, post.ETag())
 	c.JSON(http.StatusOK, post)
 }
 
 func (h *Handler) DeletePost(c *gin.Context) {
 	slug := c.Param("slug")
-	if err := h.svc.DeletePost(slug); err != nil {
-		log.Printf("Failed to delete post %s: %v", slug, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.svc.DeletePost(c.Request.Context(), slug, ifMatch(c)); err != nil {
+		logging.Printf(c.Request.Context(), "Failed to delete post %s: %v", slug, err)
+		c.Error(err)
 		return
 	}
-	log.Printf("Post deleted successfully: %s", slug)
+	logging.Printf(c.Request.Context(), "Post deleted successfully: %s", slug)
 	c.Status(http.StatusNoContent)
 }
 
 // Project handlers
 func (h *Handler) GetProjects(c *gin.Context) {
-	projects, err := h.svc.ListProjects()
+	projects, err := h.svc.ListProjects(c.Request.Context())
 	if err != nil {
-		log.Printf("Failed to get projects: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		logging.Printf(c.Request.Context(), "Failed to get projects: %v", err)
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, projects)
@@ -170,15 +243,21 @@ func (h *Handler) GetProjects(c *gin.Context) {
 func (h *Handler) GetProject(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		log.Printf("Invalid project ID: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		logging.Printf(c.Request.Context(), "Invalid project ID: %v", err)
+		c.Error(service.Validation("invalid_project_id", "Invalid project ID", nil))
 		return
 	}
 
-	project, err := h.svc.GetProject(uint(id))
+	project, err := h.svc.GetProject(c.Request.Context(), uint(id))
 	if err != nil {
-		log.Printf("Failed to get project %d: %v", id, err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		logging.Printf(c.Request.Context(), "Failed to get project %d: %v", id, err)
+		c.Error(err)
+		return
+	}
+
+	setETag(c, project.ETag())
+	if notModified(c, project.ETag()) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 	c.JSON(http.StatusOK, project)
@@ -187,70 +266,99 @@ func (h *Handler) GetProject(c *gin.Context) {
 func (h *Handler) CreateProject(c *gin.Context) {
 	var project models.Project
 	if err := c.ShouldBindJSON(&project); err != nil {
-		log.Printf("Create project validation failed: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		logging.Printf(c.Request.Context(), "Create project validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	if err := h.svc.CreateProject(&project); err != nil {
-		log.Printf("Failed to create project: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.svc.CreateProject(c.Request.Context(), &project); err != nil {
+		logging.Printf(c.Request.Context(), "Failed to create project: %v", err)
+		c.Error(err)
 		return
 	}
 
-	log.Printf("Project created successfully: %s", project.Title)
+	logging.Printf(c.Request.Context(), "Project created successfully: %s", project.Title)
 	c.JSON(http.StatusCreated, project)
 }
 
 func (h *Handler) UpdateProject(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		log.Printf("Invalid project ID: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		logging.Printf(c.Request.Context(), "Invalid project ID: %v", err)
+		c.Error(service.Validation("invalid_project_id", "Invalid project ID", nil))
 		return
 	}
 
-	var project models.Project
-	if err := c.ShouldBindJSON(&project); err != nil {
-		log.Printf("Update project validation failed: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var changes models.Project
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		logging.Printf(c.Request.Context(), "Update project validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	project, err := h.svc.UpdateProject(c.Request.Context(), uint(id), &changes, ifMatch(c))
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to update project %d: %v", id, err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Project updated successfully: %s", project.Title)
+	setETag(c, project.ETag())
+	c.JSON(http.StatusOK, project)
+}
+
+// PatchProject applies a JSON merge patch (RFC 7396) to a project
+func (h *Handler) PatchProject(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Invalid project ID: %v", err)
+		c.Error(service.Validation("invalid_project_id", "Invalid project ID", nil))
 		return
 	}
 
-	project.ID = uint(id)
-	if err := h.svc.UpdateProject(&project); err != nil {
-		log.Printf("Failed to update project %d: %v", id, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	var patch service.Patch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		logging.Printf(c.Request.Context(), "Patch project validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	log.Printf("Project updated successfully: %s", project.Title)
+	project, err := h.svc.PatchProject(c.Request.Context(), uint(id), patch, ifMatch(c))
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to patch project %d: %v", id, err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Project patched successfully: %s", project.Title)
+	setETag(c, project.ETag())
 	c.JSON(http.StatusOK, project)
 }
 
 func (h *Handler) DeleteProject(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		log.Printf("Invalid project ID: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		logging.Printf(c.Request.Context(), "Invalid project ID: %v", err)
+		c.Error(service.Validation("invalid_project_id", "Invalid project ID", nil))
 		return
 	}
 
-	if err := h.svc.DeleteProject(uint(id)); err != nil {
-		log.Printf("Failed to delete project %d: %v", id, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.svc.DeleteProject(c.Request.Context(), uint(id), ifMatch(c)); err != nil {
+		logging.Printf(c.Request.Context(), "Failed to delete project %d: %v", id, err)
+		c.Error(err)
 		return
 	}
-	log.Printf("Project deleted successfully: %d", id)
+	logging.Printf(c.Request.Context(), "Project deleted successfully: %d", id)
 	c.Status(http.StatusNoContent)
 }
 
 // Activity handlers
 func (h *Handler) GetActivities(c *gin.Context) {
-	activities, err := h.svc.ListActivities()
+	activities, err := h.svc.ListActivities(c.Request.Context())
 	if err != nil {
-		log.Printf("Failed to get activities: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		logging.Printf(c.Request.Context(), "Failed to get activities: %v", err)
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, activities)
@@ -259,26 +367,26 @@ func (h *Handler) GetActivities(c *gin.Context) {
 func (h *Handler) CreateActivity(c *gin.Context) {
 	var activity models.Activity
 	if err := c.ShouldBindJSON(&activity); err != nil {
-		log.Printf("Create activity validation failed: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		logging.Printf(c.Request.Context(), "Create activity validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
 	// Get user ID from context
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		c.Error(service.Unauthorized("not_authenticated", "User not authenticated"))
 		return
 	}
 	activity.UserID = userID.(uint)
 
-	if err := h.svc.CreateActivity(&activity); err != nil {
-		log.Printf("Failed to create activity: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.svc.CreateActivity(c.Request.Context(), &activity); err != nil {
+		logging.Printf(c.Request.Context(), "Failed to create activity: %v", err)
+		c.Error(err)
 		return
 	}
 
-	log.Printf("Activity created successfully: %s", activity.Description)
+	logging.Printf(c.Request.Context(), "Activity created successfully: %s", activity.Description)
 	c.JSON(http.StatusCreated, activity)
 }
 
@@ -287,14 +395,14 @@ func (h *Handler) Verify(c *gin.Context) {
 	// Get user ID from context (set by auth middleware)
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		c.Error(service.Unauthorized("not_authenticated", "User not authenticated"))
 		return
 	}
 
 	// Get user details from service
-	user, err := h.svc.GetUserByID(userID.(uint))
+	user, err := h.svc.GetUserByID(c.Request.Context(), userID.(uint))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user details"})
+		c.Error(err)
 		return
 	}
 
@@ -305,27 +413,30 @@ func (h *Handler) Verify(c *gin.Context) {
 	})
 }
 
-// File upload handler
+// UploadImage adds the file in the image form field to the media library
+// and returns the media record, whose url field links to the file
 func (h *Handler) UploadImage(c *gin.Context) {
 	file, err := c.FormFile("image")
 	if err != nil {
-		log.Printf("File upload failed: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		logging.Printf(c.Request.Context(), "File upload failed: %v", err)
+		c.Error(uploadError(err))
 		return
 	}
 
-	// Generate unique filename
-	filename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), file.Filename)
-	filepath := "uploads/" + filename
+	data, err := readFormFile(file)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to read uploaded file: %v", err)
+		c.Error(err)
+		return
+	}
 
-	// Save file
-	if err := c.SaveUploadedFile(file, filepath); err != nil {
-		log.Printf("Failed to save file %s: %v", filename, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+	media, err := h.svc.UploadMedia(c.Request.Context(), service.MediaUpload{Filename: file.Filename, Data: data})
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to store upload: %v", err)
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"url": "/" + filepath,
-	})
+	logging.Printf(c.Request.Context(), "Media %d stored as %s", media.ID, media.StorageKey)
+	c.JSON(http.StatusOK, media)
 }
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"blog-backend/buildinfo"
+	"blog-backend/config"
+	"blog-backend/lifecycle"
+	"blog-backend/logging"
+	"blog-backend/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// storageCheckInterval is how long a successful storage check is trusted.
+// Each check writes to the backend, which object stores bill per request.
+const storageCheckInterval = time.Minute
+
+// HealthHandler serves the liveness, readiness and build-info probes
+type HealthHandler struct {
+	db    *gorm.DB
+	lc    *lifecycle.Manager
+	store storage.Backend
+
+	// migrationsCurrent caches a successful migration check; the schema
+	// cannot fall behind again without a redeploy
+	migrationsCurrent atomic.Bool
+	// storageCheckedAt is when the storage check last passed, in Unix
+	// nanoseconds
+	storageCheckedAt atomic.Int64
+}
+
+// NewHealthHandler creates a new health handler instance
+func NewHealthHandler(db *gorm.DB, lc *lifecycle.Manager, store storage.Backend) *HealthHandler {
+	return &HealthHandler{db: db, lc: lc, store: store}
+}
+
+// Liveness reports that the process is up and serving requests
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness reports whether the server can take traffic: it is not shutting
+// down, the database answers, migrations are current and uploads can be stored
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	if !h.lc.Ready() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "unavailable",
+			"checks": gin.H{"lifecycle": "shutting down"},
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	checks := gin.H{
+		"database":   checkResult(ctx, "database", h.checkDatabase(ctx)),
+		"migrations": checkResult(ctx, "migrations", h.checkMigrations(ctx)),
+		"uploads":    checkResult(ctx, "uploads", h.checkStorage(ctx)),
+	}
+
+	status, result := http.StatusOK, "ok"
+	for _, check := range checks {
+		if check != "ok" {
+			status, result = http.StatusServiceUnavailable, "unavailable"
+		}
+	}
+
+	c.JSON(status, gin.H{
+		"status": result,
+		"checks": checks,
+	})
+}
+
+// Version reports the build metadata and process start time
+func (h *HealthHandler) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"version":   buildinfo.Version,
+		"commit":    buildinfo.Commit,
+		"buildTime": buildinfo.BuildTime,
+		"startTime": buildinfo.StartTime.UTC().Format(time.RFC3339),
+		"uptime":    time.Since(buildinfo.StartTime).Round(time.Second).String(),
+	})
+}
+
+func (h *HealthHandler) checkDatabase(ctx context.Context) error {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func (h *HealthHandler) checkMigrations(ctx context.Context) error {
+	if h.migrationsCurrent.Load() {
+		return nil
+	}
+
+	pending, err := config.PendingMigrations(h.db.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return &pendingMigrationsError{pending: pending}
+	}
+
+	h.migrationsCurrent.Store(true)
+	return nil
+}
+
+// checkStorage writes and deletes a probe object, at most once per
+// storageCheckInterval while the check keeps passing
+func (h *HealthHandler) checkStorage(ctx context.Context) error {
+	now := time.Now()
+	if now.Sub(time.Unix(0, h.storageCheckedAt.Load())) < storageCheckInterval {
+		return nil
+	}
+
+	key := ".readyz/" + strconv.FormatInt(now.UnixNano(), 36)
+	if err := h.store.Put(ctx, key, strings.NewReader("ok"), 2, "text/plain"); err != nil {
+		return err
+	}
+	if err := h.store.Delete(ctx, key); err != nil {
+		return err
+	}
+	h.storageCheckedAt.Store(now.UnixNano())
+	return nil
+}
+
+type pendingMigrationsError struct {
+	pending []string
+}
+
+func (e *pendingMigrationsError) Error() string {
+	return "pending migrations: " + strings.Join(e.pending, ", ")
+}
+
+// checkResult logs why a check failed and reports only a generic reason, as
+// probes are unauthenticated
+func checkResult(ctx context.Context, name string, err error) string {
+	if err == nil {
+		return "ok"
+	}
+	logging.Printf(ctx, "Readiness check %s failed: %v", name, err)
+	var pending *pendingMigrationsError
+	if errors.As(err, &pending) {
+		return "pending"
+	}
+	return "failed"
+}
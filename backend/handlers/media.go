@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"blog-backend/logging"
+	"blog-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMedia lists the media library. q searches filenames and alt text, type
+// filters by MIME type (e.g. image) and orphaned=true shows unused media.
+func (h *Handler) GetMedia(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("pageSize"))
+	orphaned, _ := strconv.ParseBool(c.Query("orphaned"))
+
+	result, err := h.svc.ListMedia(c.Request.Context(), service.MediaQuery{
+		Query:    c.Query("q"),
+		Type:     c.Query("type"),
+		Orphaned: orphaned,
+		Page:     page,
+		PageSize: pageSize,
+	})
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get media: %v", err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetMediaItem returns one media item with the posts and projects using it
+func (h *Handler) GetMediaItem(c *gin.Context) {
+	id, err := mediaID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	media, err := h.svc.GetMedia(c.Request.Context(), id)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get media %d: %v", id, err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, media)
+}
+
+// UpdateMedia changes the alt text of a media item
+func (h *Handler) UpdateMedia(c *gin.Context) {
+	id, err := mediaID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	var input struct {
+		AltText string `json:"altText" binding:"max=500"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.Printf(c.Request.Context(), "Update media validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	media, err := h.svc.UpdateMediaAltText(c.Request.Context(), id, input.AltText)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to update media %d: %v", id, err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, media)
+}
+
+// DeleteMedia removes a media item and its file. Media in use is only removed
+// with force=true.
+func (h *Handler) DeleteMedia(c *gin.Context) {
+	id, err := mediaID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	force, _ := strconv.ParseBool(c.Query("force"))
+
+	if err := h.svc.DeleteMedia(c.Request.Context(), id, force); err != nil {
+		logging.Printf(c.Request.Context(), "Failed to delete media %d: %v", id, err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Media %d deleted", id)
+	c.Status(http.StatusNoContent)
+}
+
+func mediaID(param string) (uint, error) {
+	id, err := strconv.ParseUint(param, 10, 32)
+	if err != nil {
+		return 0, service.Validation("invalid_media_id", "Invalid media ID", nil)
+	}
+	return uint(id), nil
+}
+
+// uploadError explains why the file of a multipart upload could not be read
+func uploadError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return service.Validation("file_too_large", fmt.Sprintf("Uploads may be at most %d bytes", tooLarge.Limit),
+			map[string]string{"image": "is too large"})
+	}
+	return service.Validation("file_required", "No file uploaded", map[string]string{"image": "is required"})
+}
+
+// readFormFile reads an uploaded multipart file into memory
+func readFormFile(file *multipart.FileHeader) ([]byte, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
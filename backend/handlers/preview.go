@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"blog-backend/logging"
+	"blog-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Preview link handlers
+func (h *Handler) CreatePreviewLink(c *gin.Context) {
+	slug := c.Param("slug")
+	var req service.PreviewLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		logging.Printf(c.Request.Context(), "Preview link validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	link, err := h.svc.CreatePreviewLink(c.Request.Context(), slug, req)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to create preview link for post %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Preview link %d created for post %s", link.ID, slug)
+	c.JSON(http.StatusCreated, gin.H{
+		"id":        link.ID,
+		"token":     link.Token,
+		"url":       "/api/preview/" + link.Token,
+		"expiresAt": link.ExpiresAt,
+	})
+}
+
+func (h *Handler) GetPreviewLinks(c *gin.Context) {
+	slug := c.Param("slug")
+	links, err := h.svc.ListPreviewLinks(c.Request.Context(), slug)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get preview links for post %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, links)
+}
+
+func (h *Handler) RevokePreviewLink(c *gin.Context) {
+	slug := c.Param("slug")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.Error(service.Validation("invalid_preview_link_id", "Invalid preview link ID", nil))
+		return
+	}
+
+	if err := h.svc.RevokePreviewLink(c.Request.Context(), slug, uint(id)); err != nil {
+		logging.Printf(c.Request.Context(), "Failed to revoke preview link %d: %v", id, err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Preview link %d revoked for post %s", id, slug)
+	c.Status(http.StatusNoContent)
+}
+
+// GetPreview serves the post behind a preview token to anyone holding it. The
+// response must not be cached or indexed.
+func (h *Handler) GetPreview(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Robots-Tag", "noindex")
+
+	post, err := h.svc.GetPreview(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, post)
+}
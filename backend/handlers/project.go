@@ -2,13 +2,10 @@ package handlers
 
 import (
 	"net/http"
-	"os"
-	"path/filepath"
 
 	"blog-backend/models"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -120,38 +117,3 @@ func (h *ProjectHandler) DeleteProject(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Project deleted successfully"})
 }
-
-func (h *ProjectHandler) UploadImage(c *gin.Context) {
-	// Check if uploads directory exists
-	uploadDir := filepath.Join("uploads", "projects")
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload directory"})
-		return
-	}
-
-	file, err := c.FormFile("image")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
-		return
-	}
-
-	// Validate file type
-	ext := filepath.Ext(file.Filename)
-	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".gif" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Only jpg, jpeg, png, and gif are allowed"})
-		return
-	}
-
-	// Generate unique filename
-	filename := uuid.New().String() + ext
-	filepath := filepath.Join(uploadDir, filename)
-
-	// Save the file
-	if err := c.SaveUploadedFile(file, filepath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
-		return
-	}
-
-	imageURL := "/uploads/projects/" + filename
-	c.JSON(http.StatusOK, gin.H{"imageUrl": imageURL})
-}
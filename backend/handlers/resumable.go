@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"blog-backend/logging"
+	"blog-backend/middleware"
+	"blog-backend/models"
+	"blog-backend/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// tusExtensions are the tus protocol extensions the upload endpoints support
+const tusExtensions = "creation,checksum,expiration,termination"
+
+// offsetContentType is the content type of tus PATCH requests
+const offsetContentType = "application/offset+octet-stream"
+
+// ResumableOptions describes the tus protocol support of the server
+func (h *Handler) ResumableOptions(c *gin.Context) {
+	c.Header(middleware.TusVersionHeader, middleware.TusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(h.svc.MaxUploadSize(), 10))
+	c.Header("Tus-Checksum-Algorithm", "sha256")
+	c.Status(http.StatusNoContent)
+}
+
+// CreateResumableUpload starts a tus upload of Upload-Length bytes.
+// Upload-Metadata may carry the filename and the hex SHA-256 of the file as
+// checksum, both base64 encoded.
+func (h *Handler) CreateResumableUpload(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil {
+		c.Error(service.Validation("invalid_upload_length", "Upload-Length must be the size of the file in bytes",
+			map[string]string{"uploadLength": "is required"}))
+		return
+	}
+	metadata := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	filename := metadata["filename"]
+	if filename == "" {
+		filename = metadata["name"]
+	}
+
+	upload, err := h.svc.CreateResumableUpload(c.Request.Context(), service.ResumableInput{
+		Filename: filename,
+		Length:   length,
+		Checksum: metadata["checksum"],
+	})
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to create resumable upload: %v", err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Resumable upload %s of %d bytes started", upload.ID, upload.Length)
+	setUploadHeaders(c, upload)
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	c.JSON(http.StatusCreated, upload)
+}
+
+// GetResumableUpload reports the offset of a tus upload, and for GET returns
+// the upload with its media item once complete
+func (h *Handler) GetResumableUpload(c *gin.Context) {
+	id, err := resumableUploadID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	upload, err := h.svc.GetResumableUpload(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	setUploadHeaders(c, upload)
+	c.Header("Cache-Control", "no-store")
+	if c.Request.Method == http.MethodHead {
+		c.Status(http.StatusOK)
+		return
+	}
+	c.JSON(http.StatusOK, upload)
+}
+
+// PatchResumableUpload appends the request body to a tus upload at
+// Upload-Offset. Upload-Checksum may carry the base64 SHA-256 of the chunk.
+func (h *Handler) PatchResumableUpload(c *gin.Context) {
+	id, err := resumableUploadID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if c.ContentType() != offsetContentType {
+		c.Error(service.Validation("invalid_content_type", "Chunks must be sent as "+offsetContentType, nil))
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.Error(service.Validation("invalid_upload_offset", "Upload-Offset must be the number of bytes already sent",
+			map[string]string{"uploadOffset": "is required"}))
+		return
+	}
+	digest, err := chunkDigest(c.GetHeader("Upload-Checksum"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	upload, err := h.svc.AppendResumableUpload(c.Request.Context(), id, offset, c.Request.Body, digest)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to append to resumable upload %s: %v", id, err)
+		c.Error(err)
+		return
+	}
+
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteResumableUpload cancels a tus upload
+func (h *Handler) DeleteResumableUpload(c *gin.Context) {
+	id, err := resumableUploadID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.svc.CancelResumableUpload(c.Request.Context(), id); err != nil {
+		logging.Printf(c.Request.Context(), "Failed to cancel resumable upload %s: %v", id, err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Resumable upload %s cancelled", id)
+	c.Status(http.StatusNoContent)
+}
+
+func resumableUploadID(param string) (string, error) {
+	if _, err := uuid.Parse(param); err != nil {
+		return "", service.Validation("invalid_upload_id", "Invalid upload ID", nil)
+	}
+	return strings.ToLower(param), nil
+}
+
+// setUploadHeaders reports the progress of a tus upload
+func setUploadHeaders(c *gin.Context, upload *models.ResumableUpload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Received, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.MediaID == nil {
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseUploadMetadata decodes a tus Upload-Metadata header: comma separated
+// keys, each followed by a base64 value. Malformed values are dropped.
+func parseUploadMetadata(header string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata
+}
+
+// chunkDigest decodes a tus Upload-Checksum header of the form
+// "sha256 <base64 digest>"; an empty header yields nil
+func chunkDigest(header string) ([]byte, error) {
+	if header == "" {
+		return nil, nil
+	}
+	algorithm, value, _ := strings.Cut(header, " ")
+	if algorithm != "sha256" {
+		return nil, service.Validation("unsupported_checksum", "Only sha256 chunk checksums are supported", nil)
+	}
+	digest, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(digest) != 32 {
+		return nil, service.Validation("invalid_checksum", "Upload-Checksum must be a base64 SHA-256", nil)
+	}
+	return digest, nil
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"blog-backend/logging"
+	"blog-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Revision handlers
+func (h *Handler) GetPostRevisions(c *gin.Context) {
+	slug := c.Param("slug")
+	revisions, err := h.svc.ListPostRevisions(c.Request.Context(), slug)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get revisions of post %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+func (h *Handler) GetPostRevision(c *gin.Context) {
+	slug := c.Param("slug")
+	id, err := revisionID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	revision, err := h.svc.GetPostRevision(c.Request.Context(), slug, id)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get revision %d of post %s: %v", id, slug, err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, revision)
+}
+
+// DiffPostRevisions compares the revisions given by the from and to query
+// parameters
+func (h *Handler) DiffPostRevisions(c *gin.Context) {
+	slug := c.Param("slug")
+	from, err := revisionID(c.Query("from"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	to, err := revisionID(c.Query("to"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	diff, err := h.svc.DiffPostRevisions(c.Request.Context(), slug, from, to)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to diff revisions of post %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+func (h *Handler) RestorePostRevision(c *gin.Context) {
+	slug := c.Param("slug")
+	id, err := revisionID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	post, err := h.svc.RestorePostRevision(c.Request.Context(), slug, id, ifMatch(c))
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to restore revision %d of post %s: %v", id, slug, err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Post %s restored to revision %d", slug, id)
+	setETag(c, post.ETag())
+	c.JSON(http.StatusOK, post)
+}
+
+func revisionID(param string) (uint, error) {
+	id, err := strconv.ParseUint(param, 10, 32)
+	if err != nil {
+		return 0, service.Validation("invalid_revision_id", "Invalid revision ID", nil)
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+
+	"blog-backend/logging"
+	"blog-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Series handlers
+func (h *Handler) GetSeriesList(c *gin.Context) {
+	series, err := h.svc.ListSeries(c.Request.Context())
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get series: %v", err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, series)
+}
+
+func (h *Handler) GetSeries(c *gin.Context) {
+	slug := c.Param("slug")
+	series, err := h.svc.GetSeries(c.Request.Context(), slug)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get series %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, series)
+}
+
+func (h *Handler) CreateSeries(c *gin.Context) {
+	var input service.SeriesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.Printf(c.Request.Context(), "Create series validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	series, err := h.svc.CreateSeries(c.Request.Context(), input)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to create series: %v", err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Series created successfully: %s", series.Title)
+	c.JSON(http.StatusCreated, series)
+}
+
+func (h *Handler) UpdateSeries(c *gin.Context) {
+	slug := c.Param("slug")
+	var input service.SeriesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.Printf(c.Request.Context(), "Update series validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	series, err := h.svc.UpdateSeries(c.Request.Context(), slug, input)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to update series %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Series updated successfully: %s", series.Title)
+	c.JSON(http.StatusOK, series)
+}
+
+func (h *Handler) DeleteSeries(c *gin.Context) {
+	slug := c.Param("slug")
+	if err := h.svc.DeleteSeries(c.Request.Context(), slug); err != nil {
+		logging.Printf(c.Request.Context(), "Failed to delete series %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+	logging.Printf(c.Request.Context(), "Series deleted successfully: %s", slug)
+	c.Status(http.StatusNoContent)
+}
+
+// SetSeriesPosts replaces the posts of a series; their order in the request
+// is their order in the series
+func (h *Handler) SetSeriesPosts(c *gin.Context) {
+	slug := c.Param("slug")
+	var input struct {
+		Posts []string `json:"posts" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.Printf(c.Request.Context(), "Series posts validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	series, err := h.svc.SetSeriesPosts(c.Request.Context(), slug, input.Posts)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to set posts of series %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Series %s now has %d posts", slug, len(series.Posts))
+	c.JSON(http.StatusOK, series)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"blog-backend/logging"
+	"blog-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Trash handlers
+func (h *Handler) GetTrash(c *gin.Context) {
+	items, err := h.svc.ListTrash(c.Request.Context())
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get trash: %v", err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+func (h *Handler) RestoreFromTrash(c *gin.Context) {
+	itemType := c.Param("type")
+	id, err := trashID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	item, err := h.svc.RestoreFromTrash(c.Request.Context(), itemType, id)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to restore %s %d: %v", itemType, id, err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Restored %s %d from the trash", itemType, id)
+	c.JSON(http.StatusOK, item)
+}
+
+func (h *Handler) DeleteFromTrash(c *gin.Context) {
+	itemType := c.Param("type")
+	id, err := trashID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.svc.DeleteFromTrash(c.Request.Context(), itemType, id); err != nil {
+		logging.Printf(c.Request.Context(), "Failed to permanently delete %s %d: %v", itemType, id, err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Permanently deleted %s %d", itemType, id)
+	c.Status(http.StatusNoContent)
+}
+
+func trashID(param string) (uint, error) {
+	id, err := strconv.ParseUint(param, 10, 32)
+	if err != nil {
+		return 0, service.Validation("invalid_trash_id", "Invalid trash item ID", nil)
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+
+	"blog-backend/logging"
+	"blog-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Workflow handlers
+func (h *Handler) TransitionPost(c *gin.Context) {
+	slug := c.Param("slug")
+	var req service.TransitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logging.Printf(c.Request.Context(), "Transition validation failed: %v", err)
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	post, err := h.svc.TransitionPost(c.Request.Context(), slug, req, ifMatch(c))
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to move post %s to %s: %v", slug, req.Status, err)
+		c.Error(err)
+		return
+	}
+
+	logging.Printf(c.Request.Context(), "Post %s moved to %s", slug, post.Status)
+	setETag(c, post.ETag())
+	c.JSON(http.StatusOK, post)
+}
+
+func (h *Handler) GetPostTransitions(c *gin.Context) {
+	slug := c.Param("slug")
+	transitions, err := h.svc.ListPostTransitions(c.Request.Context(), slug)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get workflow history of post %s: %v", slug, err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, transitions)
+}
+
+func (h *Handler) GetReviewQueue(c *gin.Context) {
+	posts, err := h.svc.ReviewQueue(c.Request.Context())
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Failed to get review queue: %v", err)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, posts)
+}
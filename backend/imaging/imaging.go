@@ -0,0 +1,260 @@
+// Package imaging turns uploaded images into web-ready files: it strips
+// metadata from the original, renders WebP variants at configured widths
+// and computes blurred placeholders to show while they load.
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"sort"
+
+	// Register the decoders for the accepted upload types
+	_ "image/gif"
+
+	_ "golang.org/x/image/webp"
+
+	"github.com/buckket/go-blurhash"
+	"golang.org/x/image/draw"
+)
+
+// Placeholder sizes: Blurhash components and the widths of the images they
+// are computed from
+const (
+	blurhashX       = 4
+	blurhashY       = 3
+	blurhashWidth   = 32
+	lqipWidth       = 16
+	lqipQuality     = 50
+	orientedQuality = 90
+)
+
+// MaxPixels caps the size of decoded images so a small, highly compressed
+// file cannot exhaust memory
+const MaxPixels = 40_000_000
+
+var (
+	// ErrTooLarge reports an image with more than MaxPixels pixels, or one
+	// too large for WebP
+	ErrTooLarge = errors.New("imaging: image too large")
+	// ErrMalformed reports a file whose structure could not be parsed
+	ErrMalformed = errors.New("imaging: malformed image")
+)
+
+// Variant is a resized copy of an image
+type Variant struct {
+	Width    int
+	Height   int
+	MimeType string
+	Data     []byte
+}
+
+// Result is a processed image. Original is the uploaded file without its
+// metadata, rotated upright when it had an EXIF orientation. LQIP is a tiny
+// JPEG data URI.
+type Result struct {
+	Original []byte
+	Width    int
+	Height   int
+	Variants []Variant
+	Blurhash string
+	LQIP     string
+}
+
+// Processor renders image variants. At most workers images are processed at
+// a time; further calls wait for a free slot.
+type Processor struct {
+	widths  []int
+	quality int
+	slots   chan struct{}
+}
+
+// NewProcessor renders variants at each of widths that is smaller than the
+// original. Opaque fallback variants are JPEGs of the given quality.
+func NewProcessor(widths []int, workers, jpegQuality int) *Processor {
+	if workers < 1 {
+		workers = 1
+	}
+	if jpegQuality < 1 || jpegQuality > 100 {
+		jpegQuality = jpeg.DefaultQuality
+	}
+	sorted := make([]int, 0, len(widths))
+	for _, w := range widths {
+		if w > 0 {
+			sorted = append(sorted, w)
+		}
+	}
+	sort.Ints(sorted)
+	unique := sorted[:0]
+	for i, w := range sorted {
+		if i == 0 || w != sorted[i-1] {
+			unique = append(unique, w)
+		}
+	}
+	return &Processor{widths: unique, quality: jpegQuality, slots: make(chan struct{}, workers)}
+}
+
+// Process strips the metadata of an image and renders its variants and
+// placeholders. Every width gets a fallback variant, a PNG when the image has
+// transparency and a JPEG otherwise, plus a WebP variant when that is
+// smaller. GIFs keep their animation, so they only get placeholders.
+func (p *Processor) Process(ctx context.Context, data []byte, mimeType string) (*Result, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-p.slots }()
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	original, orientation, err := StripMetadata(data, mimeType)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, err
+	}
+	if orientation > 1 {
+		img = orient(img, orientation)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: orientedQuality}); err != nil {
+			return nil, err
+		}
+		original = buf.Bytes()
+	}
+
+	bounds := img.Bounds()
+	result := &Result{Original: original, Width: bounds.Dx(), Height: bounds.Dy()}
+	if result.Blurhash, err = blurhash.Encode(blurhashX, blurhashY, Resize(img, blurhashWidth)); err != nil {
+		return nil, err
+	}
+	if result.LQIP, err = lqip(img); err != nil {
+		return nil, err
+	}
+	if mimeType == "image/gif" {
+		return result, nil
+	}
+
+	for _, width := range p.widths {
+		if width >= result.Width {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		variants, err := p.render(Resize(img, width))
+		if err != nil {
+			return nil, err
+		}
+		result.Variants = append(result.Variants, variants...)
+	}
+	return result, nil
+}
+
+// render encodes img as its fallback type and as WebP. The WebP is lossless,
+// so for photos it is often larger than the JPEG and is then left out.
+func (p *Processor) render(img *image.RGBA) ([]Variant, error) {
+	size := img.Bounds().Size()
+
+	var webp bytes.Buffer
+	if err := EncodeWebP(&webp, img); err != nil {
+		return nil, err
+	}
+
+	var fallback bytes.Buffer
+	fallbackType := "image/jpeg"
+	if img.Opaque() {
+		if err := jpeg.Encode(&fallback, img, &jpeg.Options{Quality: p.quality}); err != nil {
+			return nil, err
+		}
+	} else {
+		fallbackType = "image/png"
+		if err := png.Encode(&fallback, img); err != nil {
+			return nil, err
+		}
+	}
+
+	variants := []Variant{{Width: size.X, Height: size.Y, MimeType: fallbackType, Data: fallback.Bytes()}}
+	if webp.Len() < fallback.Len() {
+		variants = append([]Variant{{Width: size.X, Height: size.Y, MimeType: "image/webp", Data: webp.Bytes()}}, variants...)
+	}
+	return variants, nil
+}
+
+// Resize scales img to width, keeping its aspect ratio
+func Resize(img image.Image, width int) *image.RGBA {
+	bounds := img.Bounds()
+	height := int(math.Round(float64(bounds.Dy()) * float64(width) / float64(bounds.Dx())))
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Rect, img, bounds, draw.Src, nil)
+	return dst
+}
+
+// lqip renders a tiny JPEG of img on a white background as a data URI
+func lqip(img image.Image) (string, error) {
+	small := Resize(img, lqipWidth)
+	flat := image.NewRGBA(small.Rect)
+	draw.Draw(flat, flat.Rect, image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Rect, small, image.Point{}, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: lqipQuality}); err != nil {
+		return "", err
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// orient applies an EXIF orientation, returning an upright copy of img
+func orient(img image.Image, orientation int) image.Image {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Rect, img, bounds.Min, draw.Src)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
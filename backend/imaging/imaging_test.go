@@ -0,0 +1,218 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func testImage(w, h int, seed int64, alpha bool) *image.NRGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := uint8(0xff)
+			if alpha {
+				a = uint8(rng.Intn(256))
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x + rng.Intn(8)), G: uint8(y * 3), B: uint8(rng.Intn(256)), A: a})
+		}
+	}
+	return img
+}
+
+// graphicImage is an opaque image of two flat colours, like a diagram, which
+// lossless WebP stores in fewer bytes than JPEG
+func graphicImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := uint8(0x20)
+			if x >= w/2 {
+				c = 0xc0
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: c, G: c, B: 0x80, A: 0xff})
+		}
+	}
+	return img
+}
+
+func TestEncodeWebPRoundTrip(t *testing.T) {
+	solid := image.NewNRGBA(image.Rect(0, 0, 7, 5))
+	for i := range solid.Pix {
+		solid.Pix[i] = 0x80
+	}
+
+	for name, img := range map[string]*image.NRGBA{
+		"single pixel": testImage(1, 1, 1, false),
+		"solid":        solid,
+		"noise":        testImage(64, 48, 2, false),
+		"alpha":        testImage(33, 17, 3, true),
+		"wide":         testImage(600, 3, 4, false),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := EncodeWebP(&buf, img); err != nil {
+				t.Fatalf("EncodeWebP returned error: %v", err)
+			}
+			decoded, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatalf("decoding the WebP failed: %v", err)
+			}
+			if decoded.Bounds() != img.Bounds() {
+				t.Fatalf("expected bounds %v, got %v", img.Bounds(), decoded.Bounds())
+			}
+			for y := 0; y < img.Rect.Dy(); y++ {
+				for x := 0; x < img.Rect.Dx(); x++ {
+					want := img.NRGBAAt(x, y)
+					got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+					if want != got {
+						t.Fatalf("pixel (%d, %d): expected %v, got %v", x, y, want, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+// exifSegment builds an APP1 segment holding only an orientation tag
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	return append([]byte{0xff, 0xe1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}, payload...)
+}
+
+func TestStripMetadata(t *testing.T) {
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, testImage(4, 2, 5, false), nil); err != nil {
+		t.Fatal(err)
+	}
+	comment := []byte{0xff, 0xfe, 0x00, 0x06, 'G', 'P', 'S', '!'}
+	tagged := append([]byte{0xff, 0xd8}, exifSegment(6)...)
+	tagged = append(tagged, comment...)
+	tagged = append(tagged, jpg.Bytes()[2:]...)
+
+	stripped, orientation, err := StripMetadata(tagged, "image/jpeg")
+	if err != nil {
+		t.Fatalf("StripMetadata returned error: %v", err)
+	}
+	if orientation != 6 {
+		t.Errorf("expected orientation 6, got %d", orientation)
+	}
+	if bytes.Contains(stripped, []byte("Exif")) || bytes.Contains(stripped, []byte("GPS!")) {
+		t.Error("expected the EXIF and comment segments to be removed")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("expected the stripped JPEG to decode, got %v", err)
+	}
+
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, testImage(3, 3, 6, false)); err != nil {
+		t.Fatal(err)
+	}
+	raw := pngBuf.Bytes()
+	text := []byte("\x00\x00\x00\x08tEXtAuthorMe\x00\x00\x00\x00")
+	withText := append(append(append([]byte{}, raw[:33]...), text...), raw[33:]...)
+	stripped, _, err = StripMetadata(withText, "image/png")
+	if err != nil {
+		t.Fatalf("StripMetadata returned error: %v", err)
+	}
+	if !bytes.Equal(stripped, raw) {
+		t.Error("expected the tEXt chunk to be removed and nothing else")
+	}
+}
+
+func TestProcess(t *testing.T) {
+	p := NewProcessor([]int{64, 16, 1000, 16}, 1, 80)
+
+	var src bytes.Buffer
+	if err := png.Encode(&src, graphicImage(100, 50)); err != nil {
+		t.Fatal(err)
+	}
+	result, err := p.Process(context.Background(), src.Bytes(), "image/png")
+	if err != nil {
+		t.Fatalf("Process returned error: %v", err)
+	}
+	if result.Width != 100 || result.Height != 50 {
+		t.Errorf("expected 100x50, got %dx%d", result.Width, result.Height)
+	}
+	var kinds []string
+	for _, v := range result.Variants {
+		kinds = append(kinds, v.MimeType)
+		if _, _, err := image.Decode(bytes.NewReader(v.Data)); err != nil {
+			t.Errorf("variant %dw %s does not decode: %v", v.Width, v.MimeType, err)
+		}
+	}
+	if len(result.Variants) != 4 || result.Variants[0].Width != 16 || result.Variants[2].Width != 64 || result.Variants[2].Height != 32 {
+		t.Errorf("expected 16w and 64w variants only, got %v", kinds)
+	}
+	if strings.Join(kinds, ",") != "image/webp,image/jpeg,image/webp,image/jpeg" {
+		t.Errorf("expected WebP and JPEG variants of an opaque image, got %v", kinds)
+	}
+	if len(result.Blurhash) != 4+2*(blurhashX*blurhashY-1)+2 || !strings.HasPrefix(result.LQIP, "data:image/jpeg;base64,") {
+		t.Errorf("expected placeholders, got %q and %q", result.Blurhash, result.LQIP)
+	}
+
+	// A JPEG shot sideways comes out upright
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, testImage(40, 20, 8, false), nil); err != nil {
+		t.Fatal(err)
+	}
+	rotated := append(append([]byte{0xff, 0xd8}, exifSegment(6)...), jpg.Bytes()[2:]...)
+	result, err = p.Process(context.Background(), rotated, "image/jpeg")
+	if err != nil {
+		t.Fatalf("Process returned error: %v", err)
+	}
+	if result.Width != 20 || result.Height != 40 {
+		t.Errorf("expected the rotated image to be 20x40, got %dx%d", result.Width, result.Height)
+	}
+
+	// Callers wait for a free worker
+	p.slots <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Process(ctx, src.Bytes(), "image/png"); err != context.Canceled {
+		t.Errorf("expected a cancelled wait for a worker, got %v", err)
+	}
+}
+
+func TestProcessDropsLargerWebP(t *testing.T) {
+	p := NewProcessor([]int{64}, 1, 80)
+
+	// Noise stands in for a photo, which lossless WebP stores less
+	// efficiently than JPEG
+	var src bytes.Buffer
+	if err := png.Encode(&src, testImage(100, 50, 9, false)); err != nil {
+		t.Fatal(err)
+	}
+	result, err := p.Process(context.Background(), src.Bytes(), "image/png")
+	if err != nil {
+		t.Fatalf("Process returned error: %v", err)
+	}
+	if len(result.Variants) != 1 || result.Variants[0].MimeType != "image/jpeg" {
+		t.Fatalf("expected only the JPEG variant, got %d variants", len(result.Variants))
+	}
+
+	var webp bytes.Buffer
+	if err := EncodeWebP(&webp, Resize(testImage(100, 50, 9, false), 64)); err != nil {
+		t.Fatal(err)
+	}
+	if webp.Len() < len(result.Variants[0].Data) {
+		t.Errorf("expected the WebP (%d bytes) not to be smaller than the JPEG (%d bytes)", webp.Len(), len(result.Variants[0].Data))
+	}
+}
@@ -0,0 +1,201 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// droppedPNGChunks hold EXIF data and free text that may identify the author
+// or the camera
+var droppedPNGChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// StripMetadata removes EXIF, XMP and comment data from a JPEG, PNG or WebP
+// file without re-encoding it. ICC colour profiles are kept. For JPEGs it
+// also returns the EXIF orientation, 1 when there is none, since stripping
+// the EXIF block loses it. Other types are returned unchanged.
+func StripMetadata(data []byte, mimeType string) ([]byte, int, error) {
+	switch mimeType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		out, err := stripPNG(data)
+		return out, 1, err
+	case "image/webp":
+		out, err := stripWebP(data)
+		return out, 1, err
+	}
+	return data, 1, nil
+}
+
+// stripJPEG copies every segment up to the start of scan except APP1 (EXIF
+// and XMP), APP3 to APP15 and comments. APP2 is kept only for ICC profiles.
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, 0, ErrMalformed
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xff, 0xd8)
+	orientation := 1
+
+	for i := 2; i < len(data); {
+		if data[i] != 0xff {
+			return nil, 0, ErrMalformed
+		}
+		for i < len(data) && data[i] == 0xff {
+			i++
+		}
+		if i >= len(data) {
+			return nil, 0, ErrMalformed
+		}
+		marker := data[i]
+		i++
+
+		switch {
+		case marker == 0xda || marker == 0xd9:
+			// Entropy coded data follows; everything from here on is image
+			out = append(out, 0xff, marker)
+			return append(out, data[i:]...), orientation, nil
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			out = append(out, 0xff, marker)
+			continue
+		}
+
+		if i+2 > len(data) {
+			return nil, 0, ErrMalformed
+		}
+		length := int(binary.BigEndian.Uint16(data[i:]))
+		if length < 2 || i+length > len(data) {
+			return nil, 0, ErrMalformed
+		}
+		payload := data[i+2 : i+length]
+		segment := data[i : i+length]
+		i += length
+
+		switch {
+		case marker == 0xe1:
+			if o := exifOrientation(payload); o != 0 {
+				orientation = o
+			}
+			continue
+		case marker == 0xe2 && !bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00")):
+			continue
+		case marker >= 0xe3 && marker <= 0xef, marker == 0xfe:
+			continue
+		}
+		out = append(out, 0xff, marker)
+		out = append(out, segment...)
+	}
+	return nil, 0, ErrMalformed
+}
+
+// exifOrientation reads the orientation tag from the first IFD of an APP1
+// EXIF payload, returning 0 when there is none
+func exifOrientation(payload []byte) int {
+	if !bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+		return 0
+	}
+	tiff := payload[6:]
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 0
+			}
+			return o
+		}
+	}
+	return 0
+}
+
+// stripPNG copies every chunk except those in droppedPNGChunks
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrMalformed
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+
+	for i := len(pngSignature); i+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		kind := string(data[i+4 : i+8])
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, ErrMalformed
+		}
+		if !droppedPNGChunks[kind] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+		if kind == "IEND" {
+			return out, nil
+		}
+	}
+	return nil, ErrMalformed
+}
+
+// stripWebP copies every RIFF chunk except EXIF and XMP, clears their flags
+// in the VP8X header and rewrites the RIFF size
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformed
+	}
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		kind := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			if i+8+size != len(data) {
+				return nil, ErrMalformed
+			}
+			end = len(data) // some encoders leave out the final pad byte
+		}
+		chunk := data[i:end]
+		i = end
+
+		switch kind {
+		case "EXIF", "XMP ":
+			continue
+		case "VP8X":
+			if len(chunk) > 8 {
+				start := len(out)
+				out = append(out, chunk...)
+				out[start+8] &^= 0x08 | 0x04
+				continue
+			}
+		}
+		out = append(out, chunk...)
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
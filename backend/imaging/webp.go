@@ -0,0 +1,471 @@
+package imaging
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"io"
+)
+
+// VP8L constants from the WebP lossless bitstream specification
+const (
+	vp8lSignature       = 0x2f
+	vp8lMaxDimension    = 1 << 14
+	transformPredictor  = 0
+	transformSubGreen   = 2
+	predictorBits       = 9 // one predictor per 512x512 block
+	predictorClampFull  = 12
+	numLiteralCodes     = 256
+	numLengthCodes      = 24
+	numDistanceCodes    = 40
+	numCodeLengthCodes  = 19
+	maxCodeLength       = 15
+	maxCodeLengthLength = 7
+)
+
+// codeLengthOrder is the order in which code length code lengths are sent
+var codeLengthOrder = [numCodeLengthCodes]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// EncodeWebP writes img as a lossless WebP. Pixels go through the subtract
+// green and gradient predictor transforms before being Huffman coded; there
+// are no backward references, so files are larger than a full encoder
+// produces but decode with any WebP decoder.
+func EncodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxDimension || height > vp8lMaxDimension {
+		return ErrTooLarge
+	}
+
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || nrgba.Rect.Min != (image.Point{}) {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(nrgba, nrgba.Rect, img, bounds.Min, draw.Src)
+	}
+
+	argb := make([]uint32, width*height)
+	hasAlpha := false
+	for y := 0; y < height; y++ {
+		row := nrgba.Pix[y*nrgba.Stride:]
+		for x := 0; x < width; x++ {
+			r, g, b, a := row[4*x], row[4*x+1], row[4*x+2], row[4*x+3]
+			if a != 0xff {
+				hasAlpha = true
+			}
+			argb[y*width+x] = uint32(a)<<24 | uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+		}
+	}
+
+	bw := &bitWriter{}
+	bw.write(vp8lSignature, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	bw.write(boolBit(hasAlpha), 1)
+	bw.write(0, 3) // version
+
+	// The decoder undoes transforms in reverse order: predictor, then green
+	bw.write(1, 1)
+	bw.write(transformSubGreen, 2)
+	subtractGreen(argb)
+
+	bw.write(1, 1)
+	bw.write(transformPredictor, 2)
+	bw.write(predictorBits-2, 3)
+	blocksX := subSampleSize(width, predictorBits)
+	blocksY := subSampleSize(height, predictorBits)
+	modes := make([]uint32, blocksX*blocksY)
+	for i := range modes {
+		modes[i] = 0xff000000 | predictorClampFull<<8
+	}
+	writeImageData(bw, modes, false)
+	predict(argb, width, height)
+
+	bw.write(0, 1) // no more transforms
+	writeImageData(bw, argb, true)
+
+	data := bw.bytes()
+	size := len(data) + len(data)%2
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+size))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if len(data)%2 == 1 {
+		data = append(data, 0)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// subtractGreen subtracts the green channel from red and blue
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		g := (p >> 8) & 0xff
+		r := ((p >> 16) - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// predict replaces every pixel with its difference from the prediction the
+// decoder makes: black for the first pixel, the left neighbour on the top
+// row, the top neighbour on the left column and ClampAddSubtractFull
+// elsewhere. It works backwards so predictions use the original pixels.
+func predict(argb []uint32, width, height int) {
+	for y := height - 1; y >= 0; y-- {
+		for x := width - 1; x >= 0; x-- {
+			i := y*width + x
+			var pred uint32
+			switch {
+			case x == 0 && y == 0:
+				pred = 0xff000000
+			case y == 0:
+				pred = argb[i-1]
+			case x == 0:
+				pred = argb[i-width]
+			default:
+				pred = clampAddSubtractFull(argb[i-1], argb[i-width], argb[i-width-1])
+			}
+			argb[i] = subPixels(argb[i], pred)
+		}
+	}
+}
+
+func clampAddSubtractFull(left, top, topLeft uint32) uint32 {
+	var out uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		v := int((left>>shift)&0xff) + int((top>>shift)&0xff) - int((topLeft>>shift)&0xff)
+		if v < 0 {
+			v = 0
+		} else if v > 255 {
+			v = 255
+		}
+		out |= uint32(v) << shift
+	}
+	return out
+}
+
+// subPixels subtracts b from a per channel, modulo 256
+func subPixels(a, b uint32) uint32 {
+	var out uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		out |= (((a >> shift) - (b >> shift)) & 0xff) << shift
+	}
+	return out
+}
+
+func subSampleSize(size, bits int) int {
+	return (size + 1<<bits - 1) >> bits
+}
+
+// writeImageData entropy codes pixels as literals with one group of prefix
+// codes and no color cache. Only the main image has the meta prefix bit.
+func writeImageData(bw *bitWriter, argb []uint32, mainImage bool) {
+	bw.write(0, 1) // no color cache
+	if mainImage {
+		bw.write(0, 1) // no meta prefix codes
+	}
+
+	green := make([]int, numLiteralCodes+numLengthCodes)
+	red := make([]int, numLiteralCodes)
+	blue := make([]int, numLiteralCodes)
+	alpha := make([]int, numLiteralCodes)
+	for _, p := range argb {
+		green[(p>>8)&0xff]++
+		red[(p>>16)&0xff]++
+		blue[p&0xff]++
+		alpha[p>>24]++
+	}
+
+	codes := make([]*prefixCode, 0, 4)
+	for _, counts := range [][]int{green, red, blue, alpha} {
+		code := newPrefixCode(counts, maxCodeLength)
+		code.writeTo(bw)
+		codes = append(codes, code)
+	}
+	// Distances are never used
+	newPrefixCode(make([]int, numDistanceCodes), maxCodeLength).writeTo(bw)
+
+	for _, p := range argb {
+		codes[0].writeSymbol(bw, int((p>>8)&0xff))
+		codes[1].writeSymbol(bw, int((p>>16)&0xff))
+		codes[2].writeSymbol(bw, int(p&0xff))
+		codes[3].writeSymbol(bw, int(p>>24))
+	}
+}
+
+// prefixCode is a canonical Huffman code. A code with a single symbol
+// takes no bits per symbol.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint16 // bit-reversed, ready to be written LSB first
+	used    []int
+}
+
+func newPrefixCode(counts []int, maxLength int) *prefixCode {
+	c := &prefixCode{lengths: huffmanLengths(counts, maxLength)}
+	for sym, length := range c.lengths {
+		if length > 0 {
+			c.used = append(c.used, sym)
+		}
+	}
+	c.codes = canonicalCodes(c.lengths)
+	return c
+}
+
+func (c *prefixCode) writeSymbol(bw *bitWriter, sym int) {
+	if len(c.used) > 1 {
+		bw.write(uint32(c.codes[sym]), uint(c.lengths[sym]))
+	}
+}
+
+// writeTo sends the code lengths: as a simple code when at most two symbols
+// below 256 are used, otherwise as a normal code whose lengths are
+// themselves Huffman coded
+func (c *prefixCode) writeTo(bw *bitWriter) {
+	if len(c.used) <= 2 && (len(c.used) == 0 || c.used[len(c.used)-1] < numLiteralCodes) {
+		bw.write(1, 1)
+		if len(c.used) == 0 {
+			bw.write(0, 1) // one symbol
+			bw.write(0, 1) // of one bit
+			bw.write(0, 1) // symbol 0
+			return
+		}
+		bw.write(uint32(len(c.used)-1), 1)
+		bw.write(1, 1) // 8-bit symbols
+		for _, sym := range c.used {
+			bw.write(uint32(sym), 8)
+		}
+		return
+	}
+
+	bw.write(0, 1)
+	tokens := codeLengthTokens(c.lengths)
+	counts := make([]int, numCodeLengthCodes)
+	for _, t := range tokens {
+		counts[t.code]++
+	}
+	lengthCode := newPrefixCode(counts, maxCodeLengthLength)
+
+	n := numCodeLengthCodes
+	for n > 4 && lengthCode.lengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	bw.write(uint32(n-4), 4)
+	for _, sym := range codeLengthOrder[:n] {
+		bw.write(uint32(lengthCode.lengths[sym]), 3)
+	}
+	bw.write(0, 1) // lengths for the whole alphabet follow
+
+	for _, t := range tokens {
+		lengthCode.writeSymbol(bw, t.code)
+		switch t.code {
+		case 17:
+			bw.write(uint32(t.extra), 3)
+		case 18:
+			bw.write(uint32(t.extra), 7)
+		}
+	}
+}
+
+type codeLengthToken struct {
+	code  int
+	extra int
+}
+
+// codeLengthTokens run-length encodes code lengths, using codes 17 and 18
+// for runs of zeros
+func codeLengthTokens(lengths []uint8) []codeLengthToken {
+	var tokens []codeLengthToken
+	for i := 0; i < len(lengths); {
+		if lengths[i] != 0 {
+			tokens = append(tokens, codeLengthToken{code: int(lengths[i])})
+			i++
+			continue
+		}
+		run := 0
+		for i+run < len(lengths) && lengths[i+run] == 0 {
+			run++
+		}
+		i += run
+		for run > 0 {
+			switch {
+			case run >= 11:
+				n := min(run, 138)
+				tokens = append(tokens, codeLengthToken{code: 18, extra: n - 11})
+				run -= n
+			case run >= 3:
+				tokens = append(tokens, codeLengthToken{code: 17, extra: run - 3})
+				run = 0
+			default:
+				tokens = append(tokens, codeLengthToken{code: 0})
+				run--
+			}
+		}
+	}
+	return tokens
+}
+
+// huffmanLengths returns Huffman code lengths for counts no longer than
+// maxLength. Codes that come out too long are rebuilt from flattened counts.
+func huffmanLengths(counts []int, maxLength int) []uint8 {
+	lengths := make([]uint8, len(counts))
+	var symbols []int
+	for sym, n := range counts {
+		if n > 0 {
+			symbols = append(symbols, sym)
+		}
+	}
+	switch len(symbols) {
+	case 0:
+		return lengths
+	case 1:
+		lengths[symbols[0]] = 1
+		return lengths
+	}
+
+	weights := make([]int, len(symbols))
+	for i, sym := range symbols {
+		weights[i] = counts[sym]
+	}
+	for {
+		depths, maxDepth := treeDepths(weights)
+		if maxDepth <= maxLength {
+			for i, sym := range symbols {
+				lengths[sym] = uint8(depths[i])
+			}
+			return lengths
+		}
+		for i := range weights {
+			weights[i] = weights[i]/2 + 1
+		}
+	}
+}
+
+// treeDepths builds a Huffman tree over weights and returns the depth of
+// each leaf and the largest depth
+func treeDepths(weights []int) ([]int, int) {
+	n := len(weights)
+	parent := make([]int, 2*n-1)
+	h := &nodeHeap{}
+	for i, w := range weights {
+		heap.Push(h, node{weight: w, index: i})
+	}
+	next := n
+	for h.Len() > 1 {
+		a := heap.Pop(h).(node)
+		b := heap.Pop(h).(node)
+		parent[a.index] = next
+		parent[b.index] = next
+		heap.Push(h, node{weight: a.weight + b.weight, index: next})
+		next++
+	}
+
+	root := next - 1
+	depths := make([]int, n)
+	maxDepth := 0
+	for i := range depths {
+		for j := i; j != root; j = parent[j] {
+			depths[i]++
+		}
+		if depths[i] > maxDepth {
+			maxDepth = depths[i]
+		}
+	}
+	return depths, maxDepth
+}
+
+type node struct {
+	weight int
+	index  int
+}
+
+type nodeHeap []node
+
+func (h nodeHeap) Len() int { return len(h) }
+func (h nodeHeap) Less(i, j int) bool {
+	if h[i].weight != h[j].weight {
+		return h[i].weight < h[j].weight
+	}
+	return h[i].index < h[j].index
+}
+func (h nodeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *nodeHeap) Push(x interface{}) { *h = append(*h, x.(node)) }
+func (h *nodeHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// canonicalCodes assigns canonical Huffman codes to lengths, shorter codes
+// and lower symbols first, and bit-reverses them for LSB-first writing
+func canonicalCodes(lengths []uint8) []uint16 {
+	var count [maxCodeLength + 1]int
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+		}
+	}
+	var next [maxCodeLength + 1]int
+	code := 0
+	for bits := 1; bits <= maxCodeLength; bits++ {
+		code = (code + count[bits-1]) << 1
+		next[bits] = code
+	}
+
+	codes := make([]uint16, len(lengths))
+	for sym, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		codes[sym] = reverseBits(uint16(next[l]), l)
+		next[l]++
+	}
+	return codes
+}
+
+func reverseBits(code uint16, length uint8) uint16 {
+	var out uint16
+	for i := uint8(0); i < length; i++ {
+		out = out<<1 | code&1
+		code >>= 1
+	}
+	return out
+}
+
+// bitWriter packs bits least significant first
+type bitWriter struct {
+	buf  []byte
+	acc  uint64
+	bits uint
+}
+
+func (w *bitWriter) write(value uint32, n uint) {
+	w.acc |= uint64(value) << w.bits
+	w.bits += n
+	for w.bits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.bits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.bits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.bits = 0, 0
+	}
+	return w.buf
+}
+
+func boolBit(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+package lifecycle
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// Manager tracks server readiness and the background workers that must be
+// stopped before the process exits
+type Manager struct {
+	ready  atomic.Bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a lifecycle manager. The server starts out not ready.
+func New() *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{ctx: ctx, cancel: cancel}
+}
+
+// Ready reports whether the server should receive traffic
+func (m *Manager) Ready() bool {
+	return m.ready.Load()
+}
+
+// SetReady flips the readiness flag
+func (m *Manager) SetReady(ready bool) {
+	m.ready.Store(ready)
+}
+
+// Go runs fn in a background goroutine. The context passed to fn is
+// cancelled when Shutdown is called.
+func (m *Manager) Go(name string, fn func(ctx context.Context)) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		log.Printf("Background worker started: %s", name)
+		fn(m.ctx)
+		log.Printf("Background worker stopped: %s", name)
+	}()
+}
+
+// Shutdown marks the server not ready, cancels all background workers and
+// waits for them to return or for ctx to expire
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.SetReady(false)
+	m.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,79 @@
+// Package mail sends notification emails through a pluggable Mailer
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"blog-backend/logging"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      []string
+	ReplyTo string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer writes messages to the log instead of sending them. It is used
+// when no SMTP server is configured.
+type LogMailer struct{}
+
+// Send logs msg
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	logging.Printf(ctx, "Email to %s: %s\n%s", strings.Join(msg.To, ", "), msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPMailer sends messages through an SMTP server, using STARTTLS when the
+// server offers it
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer creates a mailer for the server at host:port. Without a
+// username no authentication is attempted.
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{addr: fmt.Sprintf("%s:%d", host, port), from: from}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// Send delivers msg. net/smtp has no context support, so ctx only carries
+// the request for logging.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(msg.To, ", "))
+	if msg.ReplyTo != "" {
+		fmt.Fprintf(&b, "Reply-To: %s\r\n", headerValue(msg.ReplyTo))
+	}
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(m.addr, m.auth, m.from, msg.To, []byte(b.String())); err != nil {
+		return fmt.Errorf("send mail via %s: %w", m.addr, err)
+	}
+	return nil
+}
+
+// headerValue strips line breaks so visitor input cannot add headers
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
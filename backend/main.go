@@ -1,65 +1,213 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
-	"os"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"blog-backend/config"
 	"blog-backend/handlers"
+	"blog-backend/imaging"
+	"blog-backend/lifecycle"
+	"blog-backend/logging"
+	"blog-backend/mail"
+	"blog-backend/metrics"
 	"blog-backend/middleware"
-	"blog-backend/models"
+	"blog-backend/pow"
 	"blog-backend/repository"
 	"blog-backend/service"
+	"blog-backend/spam"
+	"blog-backend/storage"
+	"blog-backend/tracing"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
-	"gorm.io/gorm"
 )
 
-var db *gorm.DB
-
 func main() {
-	if err := godotenv.Load(); err != nil {
+	// Load .env first so it can configure logging too
+	envErr := godotenv.Load()
+	logging.Init()
+	if envErr != nil {
 		log.Println("No .env file found")
 	}
 
+	serverConfig := config.LoadServerConfig()
+	lc := lifecycle.New()
+
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		log.Fatal("Failed to initialize tracing:", err)
+	}
+
 	// Initialize database
-	var err error
-	db, err = config.InitDatabase()
+	db, err := config.InitDatabase()
 	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
-
-	// Explicitly reference db to remove unused variable warning
-	_ = db
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatal("Failed to access database pool:", err)
+	}
+	if err := db.Use(metrics.GormPlugin{}); err != nil {
+		log.Fatal("Failed to register metrics plugin:", err)
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		log.Fatal("Failed to register tracing plugin:", err)
+	}
+	if err := metrics.RegisterDBStats(sqlDB, db.Migrator().CurrentDatabase()); err != nil {
+		log.Fatal("Failed to register database metrics:", err)
+	}
 
 	// Auto-migrate models
-	if err := db.AutoMigrate(&models.User{}, &models.Post{}, &models.Activity{}, &models.Project{}); err != nil {
+	if err := config.Migrate(db); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	storageConfig := config.LoadStorageConfig()
+	store, err := newStorage(storageConfig)
+	if err != nil {
+		log.Fatal("Failed to set up upload storage:", err)
+	}
+
+	// Rate limiters report throttled IPs so their challenges get harder
+	powConfig := config.LoadProofOfWorkConfig()
+	powIssuer, err := pow.NewIssuer([]byte(powConfig.Secret), pow.Config{
+		Difficulty:     powConfig.Difficulty,
+		MaxDifficulty:  powConfig.MaxDifficulty,
+		TTL:            powConfig.TTL,
+		ThrottleWindow: powConfig.ThrottleWindow,
+	})
+	if err != nil {
+		log.Fatal("Failed to create proof-of-work issuer:", err)
+	}
+
 	// Initialize layers
 	repo := repository.NewRepository(db)
-	svc := service.NewService(repo)
+	revisionConfig := config.LoadRevisionConfig()
+	trashConfig := config.LoadTrashConfig()
+	spamConfig := config.LoadSpamConfig()
+	mediaConfig := config.LoadMediaConfig()
+	uploadConfig := config.LoadUploadConfig()
+	uploadLimits := service.NewUploadLimits(uploadConfig.MaxImageSize, uploadConfig.MaxPDFSize, uploadConfig.MaxVideoSize)
+	imageConfig := config.LoadImageConfig()
+	mailConfig := config.LoadMailConfig()
+	contactConfig := config.LoadContactConfig()
+	commentConfig := config.LoadCommentConfig()
+	var mailer mail.Mailer = mail.LogMailer{}
+	if mailConfig.SMTPHost != "" {
+		mailer = mail.NewSMTPMailer(mailConfig.SMTPHost, mailConfig.SMTPPort,
+			mailConfig.SMTPUsername, mailConfig.SMTPPassword, mailConfig.From)
+	}
+	svc := service.NewService(repo,
+		service.WithRevisionRetention(service.RevisionRetention{
+			MaxCount: revisionConfig.MaxCount,
+			MaxAge:   revisionConfig.MaxAge,
+		}),
+		service.WithTrashRetention(trashConfig.Retention),
+		service.WithPreviewTTL(config.LoadPreviewTTL()),
+		service.WithSpamFilter(spam.NewPipeline(
+			spam.Honeypot(),
+			spam.MinFillTime(spamConfig.MinFillTime),
+			spam.LinkCount(spamConfig.MaxLinks),
+			spam.Blocklist(spamConfig.Blocklist),
+			spam.IPRate(spamConfig.RateLimit, spamConfig.RateWindow, powIssuer.Throttled),
+			spam.NewBayes(repo, spamConfig.MinTraining),
+		), spamConfig.Threshold),
+		service.WithMailer(mailer, contactConfig.NotifyTo),
+		service.WithBackground(lc.Go),
+		service.WithStorage(store),
+		service.WithUploadLimits(uploadLimits),
+		service.WithResumableUploads(uploadConfig.MaxChunkSize, uploadConfig.ResumableExpiry),
+		service.WithImageProcessor(imaging.NewProcessor(imageConfig.Widths, imageConfig.Workers, imageConfig.JPEGQuality)),
+		service.WithMediaOrphanRetention(mediaConfig.OrphanRetention),
+	)
 	handler := handlers.NewHandler(svc)
+	healthHandler := handlers.NewHealthHandler(db, lc, store)
+
+	challengeHandler := handlers.NewChallengeHandler(powIssuer)
+	proofOfWork := middleware.ProofOfWork(powIssuer)
+
+	// Background workers
+	workflowConfig := config.LoadWorkflowConfig()
+	lc.Go("scheduled-publishing", func(ctx context.Context) {
+		svc.RunScheduledPublishing(ctx, workflowConfig.PublishInterval)
+	})
+	lc.Go("related-posts", func(ctx context.Context) {
+		svc.RunRelatedPosts(ctx, workflowConfig.RelatedInterval)
+	})
+	if trashConfig.Retention > 0 {
+		lc.Go("trash-purge", func(ctx context.Context) {
+			svc.RunTrashPurge(ctx, trashConfig.PurgeInterval)
+		})
+	}
+	if mediaConfig.OrphanRetention > 0 {
+		lc.Go("media-cleanup", func(ctx context.Context) {
+			svc.RunMediaCleanup(ctx, mediaConfig.CleanupInterval)
+		})
+	}
+	lc.Go("upload-cleanup", func(ctx context.Context) {
+		svc.RunResumableUploadCleanup(ctx, uploadConfig.CleanupInterval)
+	})
 
-	router := gin.Default()
+	router := gin.New()
+	if err := router.SetTrustedProxies(serverConfig.TrustedProxies); err != nil {
+		log.Fatal("Invalid trusted proxies:", err)
+	}
+	router.TrustedPlatform = serverConfig.TrustedPlatform
+	router.MaxMultipartMemory = uploadConfig.MaxMultipartMemory
+	router.Use(gin.Recovery())
+	router.Use(middleware.RequestID())
+	router.Use(tracing.Middleware())
+	router.Use(metrics.Middleware())
+	router.Use(middleware.AccessLog("/healthz", "/readyz", "/metrics"))
+	router.Use(middleware.ErrorHandler())
+	router.NoRoute(func(c *gin.Context) {
+		c.Error(service.NotFound("route_not_found", "No route matches "+c.Request.URL.Path))
+	})
 
 	// CORS configuration
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowOrigins = []string{"http://localhost:3000", "http://localhost:5173", "http://localhost:5174", "http://localhost:8081"}
 	corsConfig.AllowCredentials = true
-	corsConfig.AddAllowHeaders("Authorization")
+	corsConfig.AddAllowHeaders("Authorization", "If-Match", "If-None-Match", middleware.RequestIDHeader,
+		middleware.ChallengeHeader, middleware.NonceHeader, middleware.TusResumableHeader,
+		"Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Checksum")
+	corsConfig.AddExposeHeaders("ETag", middleware.RequestIDHeader, "Location", middleware.TusResumableHeader,
+		middleware.TusVersionHeader, "Tus-Extension", "Tus-Max-Size", "Tus-Checksum-Algorithm",
+		"Upload-Offset", "Upload-Length", "Upload-Expires")
 	router.Use(cors.New(corsConfig))
 
+	// Probes
+	router.GET("/healthz", healthHandler.Liveness)
+	router.GET("/readyz", healthHandler.Readiness)
+	router.GET("/version", healthHandler.Version)
+	router.GET("/metrics", middleware.MetricsGuard(config.LoadMetricsConfig()), gin.WrapH(metrics.Handler()))
+
 	// Public routes
 	public := router.Group("/api")
 	{
 		public.POST("/auth/login", handler.Login)
+		public.GET("/challenge", middleware.RateLimit(powConfig.RateLimit, powConfig.RateWindow, powIssuer.Throttled), challengeHandler.Issue)
 		public.GET("/posts", handler.GetPosts)
 		public.GET("/posts/:slug", handler.GetPost)
+		public.GET("/posts/:slug/related", handler.GetRelatedPosts)
+		public.GET("/posts/:slug/comments", handler.GetPostComments)
+		public.POST("/posts/:slug/comments", middleware.RateLimit(commentConfig.RateLimit, commentConfig.RateWindow, powIssuer.Throttled),
+			middleware.OptionalAuthMiddleware(), proofOfWork, handler.CreateComment)
+		public.GET("/preview/:token", handler.GetPreview)
+		public.GET("/series", handler.GetSeriesList)
+		public.GET("/series/:slug", handler.GetSeries)
 		public.GET("/projects", handler.GetProjects)
+		public.GET("/projects/:id", handler.GetProject)
+		public.POST("/contact", middleware.RateLimit(contactConfig.RateLimit, contactConfig.RateWindow, powIssuer.Throttled), proofOfWork, handler.SubmitContactMessage)
+		public.OPTIONS("/uploads/resumable", middleware.TusResumable(), handler.ResumableOptions)
 	}
 
 	// Protected routes
@@ -72,28 +220,150 @@ func main() {
 		// Project routes
 		protected.POST("/projects", handler.CreateProject)
 		protected.PUT("/projects/:id", handler.UpdateProject)
+		protected.PATCH("/projects/:id", handler.PatchProject)
 		protected.DELETE("/projects/:id", handler.DeleteProject)
-		protected.POST("/upload", handler.UploadImage)
+		// Whole-file uploads take images and PDFs, with room for the
+		// multipart framing; videos and other large files go through the
+		// resumable tus endpoints
+		protected.POST("/upload", middleware.NoTimeouts(), middleware.MaxBodySize(max(uploadConfig.MaxImageSize, uploadConfig.MaxPDFSize)+1<<20), handler.UploadImage)
+		protected.POST("/uploads/resumable", middleware.TusResumable(), handler.CreateResumableUpload)
+		protected.HEAD("/uploads/resumable/:id", middleware.TusResumable(), handler.GetResumableUpload)
+		protected.GET("/uploads/resumable/:id", middleware.TusResumable(), handler.GetResumableUpload)
+		protected.PATCH("/uploads/resumable/:id", middleware.TusResumable(), middleware.NoTimeouts(), handler.PatchResumableUpload)
+		protected.DELETE("/uploads/resumable/:id", middleware.TusResumable(), handler.DeleteResumableUpload)
+
+		// Media library routes
+		protected.GET("/media", handler.GetMedia)
+		protected.GET("/media/:id", handler.GetMediaItem)
+		protected.PATCH("/media/:id", handler.UpdateMedia)
+		protected.DELETE("/media/:id", handler.DeleteMedia)
 
 		// Post routes
+		protected.GET("/manage/posts", handler.GetManagedPosts)
+		protected.GET("/manage/posts/:slug", handler.GetManagedPost)
 		protected.POST("/posts", handler.CreatePost)
 		protected.PUT("/posts/:slug", handler.UpdatePost)
+		protected.PATCH("/posts/:slug", handler.PatchPost)
 		protected.DELETE("/posts/:slug", handler.DeletePost)
+		protected.GET("/posts/:slug/revisions", handler.GetPostRevisions)
+		protected.GET("/posts/:slug/revisions/diff", handler.DiffPostRevisions)
+		protected.GET("/posts/:slug/revisions/:id", handler.GetPostRevision)
+		protected.POST("/posts/:slug/revisions/:id/restore", handler.RestorePostRevision)
+		protected.GET("/posts/:slug/transitions", handler.GetPostTransitions)
+		protected.POST("/posts/:slug/transitions", handler.TransitionPost)
+		protected.GET("/review-queue", handler.GetReviewQueue)
+		protected.POST("/posts/:slug/preview-link", handler.CreatePreviewLink)
+		protected.GET("/posts/:slug/preview-links", handler.GetPreviewLinks)
+		protected.DELETE("/posts/:slug/preview-links/:id", handler.RevokePreviewLink)
+
+		// Series routes
+		protected.POST("/series", handler.CreateSeries)
+		protected.PUT("/series/:slug", handler.UpdateSeries)
+		protected.DELETE("/series/:slug", handler.DeleteSeries)
+		protected.PUT("/series/:slug/posts", handler.SetSeriesPosts)
+
+		// Comment moderation routes
+		protected.GET("/comments", handler.GetComments)
+		protected.PATCH("/comments", handler.ModerateComments)
+
+		// Contact inbox routes
+		protected.GET("/contact", handler.GetContactMessages)
+		protected.GET("/contact/:id", handler.GetContactMessage)
+		protected.PATCH("/contact/:id", handler.UpdateContactMessage)
+		protected.POST("/contact/:id/reply", handler.RecordContactReply)
 
 		// Activity routes
 		protected.GET("/activities", handler.GetActivities)
 		protected.POST("/activities", handler.CreateActivity)
+
+		// Trash routes
+		protected.GET("/trash", handler.GetTrash)
+		protected.POST("/trash/:type/:id/restore", handler.RestoreFromTrash)
+		protected.DELETE("/trash/:type/:id", handler.DeleteFromTrash)
 	}
 	// Serve uploaded files
-	router.Static("/uploads", "./uploads")
+	// Presigned redirects only make sense for object stores; local files are
+	// served from /uploads itself
+	redirectTTL := time.Duration(0)
+	if storageConfig.Driver == config.StorageS3 {
+		redirectTTL = storageConfig.RedirectTTL
+	}
+	fileHandler := handlers.NewFileHandler(store, redirectTTL)
+	uploads := router.Group("/uploads", middleware.UploadHeaders(), middleware.NoTimeouts())
+	uploads.GET("/*key", fileHandler.Serve)
+	uploads.HEAD("/*key", fileHandler.Serve)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	srv := &http.Server{
+		Addr:              ":" + serverConfig.Port,
+		Handler:           router,
+		ReadTimeout:       serverConfig.ReadTimeout,
+		ReadHeaderTimeout: serverConfig.ReadHeaderTimeout,
+		WriteTimeout:      serverConfig.WriteTimeout,
+		IdleTimeout:       serverConfig.IdleTimeout,
 	}
 
-	log.Printf("Server running on port %s", port)
-	if err := router.Run(":" + port); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server running on port %s", serverConfig.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+	lc.SetReady(true)
+
+	select {
+	case err := <-serverErr:
 		log.Fatal("Server failed to start:", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// Stop advertising readiness first so the load balancer drains us
+	log.Println("Shutdown signal received, draining connections")
+	lc.SetReady(false)
+	time.Sleep(serverConfig.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serverConfig.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown did not complete cleanly: %v", err)
+	}
+	if err := lc.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Background workers did not stop in time: %v", err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+	log.Println("Server stopped")
+}
+
+// newStorage opens the upload storage backend selected by cfg
+func newStorage(cfg config.StorageConfig) (storage.Backend, error) {
+	switch cfg.Driver {
+	case config.StorageLocal:
+		return storage.NewLocal(cfg.Dir, "/uploads")
+	case config.StorageS3:
+		store, err := storage.NewS3(storage.S3Config{
+			Endpoint:  cfg.Endpoint,
+			Region:    cfg.Region,
+			Bucket:    cfg.Bucket,
+			AccessKey: cfg.AccessKey,
+			SecretKey: cfg.SecretKey,
+			UseSSL:    cfg.UseSSL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return store, store.CheckBucket(ctx)
 	}
+	return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
 }
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "blog"
+
+// HTTP metrics
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route template and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Database metrics
+var (
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "GORM query latency by operation and table.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	DBQueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "GORM queries that returned an error, by operation and table.",
+	}, []string{"operation", "table"})
+)
+
+// Business metrics
+var (
+	PostsPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "posts_published_total",
+		Help:      "Posts that were published.",
+	})
+
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result (success or failure).",
+	}, []string{"result"})
+
+	UploadsStored = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploads_stored_total",
+		Help:      "Uploaded files that were stored.",
+	})
+
+	UploadBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_bytes_total",
+		Help:      "Bytes of uploaded files that were stored.",
+	})
+
+	SpamVerdicts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "spam_verdicts_total",
+		Help:      "Public submissions scored for spam, by kind and result (spam or ham).",
+	}, []string{"kind", "result"})
+)
+
+// RegisterDBStats exposes the connection pool statistics of db
+func RegisterDBStats(db *sql.DB, dbName string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, dbName))
+}
+
+// RecordLogin counts a login attempt
+func RecordLogin(success bool) {
+	if success {
+		Logins.WithLabelValues("success").Inc()
+		return
+	}
+	Logins.WithLabelValues("failure").Inc()
+}
+
+// RecordSpamVerdict counts a scored submission of the given kind
+func RecordSpamVerdict(kind string, isSpam bool) {
+	if isSpam {
+		SpamVerdicts.WithLabelValues(kind, "spam").Inc()
+		return
+	}
+	SpamVerdicts.WithLabelValues(kind, "ham").Inc()
+}
+
+// RecordUpload counts a stored upload and its size
+func RecordUpload(size int64) {
+	UploadsStored.Inc()
+	UploadBytes.Add(float64(size))
+}
@@ -1,49 +1,72 @@
 package middleware
 
 import (
+	"blog-backend/logging"
+	"blog-backend/service"
+	"blog-backend/tracing"
 	"blog-backend/utils"
-	"log"
-	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // AuthMiddleware handles JWT token validation
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			log.Printf("Missing Authorization header")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+		if c.GetHeader("Authorization") == "" {
+			logging.Printf(c.Request.Context(), "Missing Authorization header")
+			AbortWithError(c, service.Unauthorized("authorization_required", "Authorization header is required"))
 			return
 		}
-
-		// Extract the token
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			log.Printf("Invalid Authorization format: %s", authHeader)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header must be in format: Bearer <token>"})
-			return
+		if authenticate(c) {
+			c.Next()
 		}
+	}
+}
 
-		token := parts[1]
-		claims, err := utils.ValidateToken(token, nil)
-		if err != nil {
-			log.Printf("Token validation failed: %v", err)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			return
+// OptionalAuthMiddleware authenticates requests that carry an Authorization
+// header and lets anonymous requests through. A header with a bad token is
+// still rejected rather than silently treated as anonymous.
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" || authenticate(c) {
+			c.Next()
 		}
+	}
+}
 
-		// Set claims in context
-		if userID, ok := claims["user_id"].(float64); ok {
-			c.Set("user_id", uint(userID))
-		}
-		if email, ok := claims["email"].(string); ok {
-			c.Set("user_email", email)
-		}
+// authenticate validates the bearer token and stores its claims on the
+// request, aborting with 401 and returning false when it is not valid
+func authenticate(c *gin.Context) bool {
+	authHeader := c.GetHeader("Authorization")
+
+	// Extract the token
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		logging.Printf(c.Request.Context(), "Invalid Authorization format: %s", authHeader)
+		AbortWithError(c, service.Unauthorized("authorization_malformed", "Authorization header must be in format: Bearer <token>"))
+		return false
+	}
 
-		log.Printf("Authenticated user ID: %v", claims["user_id"])
-		c.Next()
+	token := parts[1]
+	claims, err := utils.ValidateToken(token, nil)
+	if err != nil {
+		logging.Printf(c.Request.Context(), "Token validation failed: %v", err)
+		AbortWithError(c, service.Unauthorized("token_invalid", "Invalid or expired token"))
+		return false
 	}
-}
\ No newline at end of file
+
+	// Set claims in context
+	if userID, ok := claims["user_id"].(float64); ok {
+		c.Set("user_id", uint(userID))
+		c.Request = c.Request.WithContext(service.WithUserID(c.Request.Context(), uint(userID)))
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(tracing.UserID(uint(userID)))
+	}
+	if email, ok := claims["email"].(string); ok {
+		c.Set("user_email", email)
+	}
+
+	logging.Printf(c.Request.Context(), "Authenticated user ID: %v", claims["user_id"])
+	return true
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"blog-backend/logging"
+	"blog-backend/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// ProblemContentType is the media type of RFC 7807 error responses
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details document. Code is a stable,
+// machine-readable error identifier and Errors lists validation failures by
+// field.
+type Problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      string            `json:"code"`
+	Errors    map[string]string `json:"errors,omitempty"`
+	RequestID string            `json:"requestId,omitempty"`
+}
+
+var registerFieldNames sync.Once
+
+// ErrorHandler renders the last error attached with c.Error as a problem
+// response. Domain errors from the service package keep their status, code and
+// message; binding errors become validation problems; anything else is logged
+// and reported as a generic 500 so database and driver messages never reach
+// the client.
+func ErrorHandler() gin.HandlerFunc {
+	registerFieldNames.Do(useJSONFieldNames)
+
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		problem := newProblem(c.Errors.Last())
+		problem.Instance = c.Request.URL.Path
+		problem.RequestID = logging.RequestID(c.Request.Context())
+
+		if problem.Status >= http.StatusInternalServerError {
+			logging.Printf(c.Request.Context(), "Internal error: %v", c.Errors.Last().Err)
+		}
+
+		body, err := json.Marshal(problem)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Data(problem.Status, ProblemContentType, body)
+	}
+}
+
+// AbortWithError attaches err for ErrorHandler to render and stops the chain
+func AbortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+func newProblem(ginErr *gin.Error) Problem {
+	err := ginErr.Err
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		err = service.FieldValidation(validationErrs)
+	}
+
+	var domainErr *service.Error
+	if errors.As(err, &domainErr) {
+		status := statusForKind(domainErr.Kind)
+		problem := Problem{
+			Type:   "about:blank",
+			Title:  statusText(status),
+			Status: status,
+			Detail: domainErr.Message,
+			Code:   domainErr.Code,
+			Errors: domainErr.Fields,
+		}
+		if status >= http.StatusInternalServerError {
+			problem.Detail = ""
+			problem.Code = "internal_error"
+		}
+		return problem
+	}
+
+	if ginErr.IsType(gin.ErrorTypeBind) {
+		return Problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(http.StatusBadRequest),
+			Status: http.StatusBadRequest,
+			Detail: "The request body could not be parsed",
+			Code:   "invalid_request_body",
+		}
+	}
+
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusInternalServerError),
+		Status: http.StatusInternalServerError,
+		Code:   "internal_error",
+	}
+}
+
+func statusForKind(kind service.Kind) int {
+	switch kind {
+	case service.KindNotFound:
+		return http.StatusNotFound
+	case service.KindConflict:
+		return http.StatusConflict
+	case service.KindValidation:
+		return http.StatusBadRequest
+	case service.KindForbidden:
+		return http.StatusForbidden
+	case service.KindUnauthorized:
+		return http.StatusUnauthorized
+	case service.KindPreconditionFailed:
+		return http.StatusPreconditionFailed
+	case service.KindTooManyRequests:
+		return http.StatusTooManyRequests
+	case service.KindChecksumMismatch:
+		return StatusChecksumMismatch
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// statusText is http.StatusText, knowing the tus checksum status too
+func statusText(status int) string {
+	if status == StatusChecksumMismatch {
+		return "Checksum Mismatch"
+	}
+	return http.StatusText(status)
+}
+
+// useJSONFieldNames makes binding errors report fields by their JSON name
+func useJSONFieldNames() {
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		engine.RegisterTagNameFunc(service.JSONFieldName)
+	}
+}
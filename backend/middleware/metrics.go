@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net"
+	"strings"
+
+	"blog-backend/config"
+	"blog-backend/logging"
+	"blog-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsGuard restricts access to the metrics endpoint to requests that
+// present the configured bearer token or come from an allowlisted address.
+// The direct peer address is used so the check cannot be bypassed with a
+// forged X-Forwarded-For header.
+func MetricsGuard(cfg config.MetricsConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.Token != "" {
+			token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) == 1 {
+				c.Next()
+				return
+			}
+		}
+
+		if ip := net.ParseIP(c.RemoteIP()); ip != nil {
+			for _, allowed := range cfg.AllowedNets {
+				if allowed.Contains(ip) {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		logging.Printf(c.Request.Context(), "Metrics access denied for %s", c.RemoteIP())
+		AbortWithError(c, service.Forbidden("metrics_forbidden", "Metrics access is restricted"))
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"blog-backend/logging"
+	"blog-backend/pow"
+	"blog-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers carrying a solved proof-of-work challenge
+const (
+	ChallengeHeader = "X-PoW-Challenge"
+	NonceHeader     = "X-PoW-Nonce"
+)
+
+// ProofOfWork requires anonymous requests to carry a solved challenge from
+// GET /api/challenge. Requests authenticated by an earlier
+// OptionalAuthMiddleware pass without one.
+func ProofOfWork(issuer *pow.Issuer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("user_id"); ok {
+			c.Next()
+			return
+		}
+
+		token, nonce := c.GetHeader(ChallengeHeader), c.GetHeader(NonceHeader)
+		if token == "" || nonce == "" {
+			AbortWithError(c, service.Forbidden("challenge_required", "Solve a challenge from /api/challenge and send it in the "+ChallengeHeader+" and "+NonceHeader+" headers"))
+			return
+		}
+		if err := issuer.Verify(token, nonce, c.ClientIP()); err != nil {
+			logging.Printf(c.Request.Context(), "Proof of work rejected for %s: %v", c.ClientIP(), err)
+			AbortWithError(c, service.Forbidden("challenge_failed", "The challenge was not solved: "+err.Error()))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"blog-backend/logging"
+	"blog-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit allows each client IP at most limit requests per window and
+// rejects the rest with 429 and a Retry-After header. Counts are kept in
+// memory per process and per route it is attached to. If throttled is not
+// nil it is called with every rejected IP.
+func RateLimit(limit int, window time.Duration, throttled func(ip string)) gin.HandlerFunc {
+	limiter := &rateLimiter{limit: limit, window: window, hits: map[string][]time.Time{}}
+
+	return func(c *gin.Context) {
+		retryAfter, ok := limiter.allow(c.ClientIP(), time.Now())
+		if !ok {
+			logging.Printf(c.Request.Context(), "Rate limit exceeded for %s on %s", c.ClientIP(), c.FullPath())
+			if throttled != nil {
+				throttled(c.ClientIP())
+			}
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			AbortWithError(c, service.TooManyRequests("rate_limited", "Too many requests, please try again later"))
+			return
+		}
+		c.Next()
+	}
+}
+
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu    sync.Mutex
+	hits  map[string][]time.Time
+	swept time.Time
+}
+
+// allow records a request from ip and reports whether it is within the
+// limit, or how long until the next one will be
+func (l *rateLimiter) allow(ip string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-l.window)
+	if now.Sub(l.swept) > l.window {
+		for key, times := range l.hits {
+			if len(times) == 0 || !times[len(times)-1].After(cutoff) {
+				delete(l.hits, key)
+			}
+		}
+		l.swept = now
+	}
+
+	recent := l.hits[ip][:0]
+	for _, t := range l.hits[ip] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= l.limit {
+		l.hits[ip] = recent
+		return recent[0].Sub(cutoff), false
+	}
+	l.hits[ip] = append(recent, now)
+	return 0, true
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+
+	"blog-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers of the tus resumable upload protocol
+const (
+	TusResumableHeader = "Tus-Resumable"
+	TusVersionHeader   = "Tus-Version"
+)
+
+// TusVersion is the only tus protocol version the server speaks
+const TusVersion = "1.0.0"
+
+// StatusChecksumMismatch is the tus status for a chunk that does not match
+// its Upload-Checksum
+const StatusChecksumMismatch = 460
+
+// TusResumable marks responses with the tus version and rejects requests
+// other than OPTIONS that ask for another one
+func TusResumable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header(TusResumableHeader, TusVersion)
+		if c.Request.Method != http.MethodOptions && c.GetHeader(TusResumableHeader) != TusVersion {
+			c.Header(TusVersionHeader, TusVersion)
+			AbortWithError(c, service.PreconditionFailed("tus_version_unsupported", "Send "+TusResumableHeader+": "+TusVersion))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"blog-backend/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxBodySize caps the request body at limit bytes. Reading past it fails
+// with *http.MaxBytesError.
+func MaxBodySize(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// NoTimeouts lifts the server's read and write timeouts for routes that move
+// whole files, which take longer than they allow on a slow link. The header
+// and idle timeouts still apply.
+func NoTimeouts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rc := http.NewResponseController(c.Writer)
+		_ = rc.SetReadDeadline(time.Time{})
+		_ = rc.SetWriteDeadline(time.Time{})
+		c.Next()
+	}
+}
+
+// UploadHeaders hardens responses for uploaded files: browsers must not
+// sniff another content type, and anything but an image or video is served
+// as a download named after the stored file rather than rendered
+func UploadHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Content-Disposition", storage.ContentDisposition(c.Request.URL.Path))
+		c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+		c.Next()
+	}
+}
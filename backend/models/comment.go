@@ -0,0 +1,35 @@
+package models
+
+import "gorm.io/gorm"
+
+// Comment moderation states
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentSpam     = "spam"
+	CommentDeleted  = "deleted"
+)
+
+// Comment is a reader's comment on a post. Guests leave a name and email;
+// signed-in users are linked by UserID. Body holds the Markdown source and
+// BodyHTML its sanitized rendering, which is produced when comments are read.
+// Guest comments are scored for spam when they are submitted.
+type Comment struct {
+	gorm.Model
+	PostID      uint       `json:"post_id" gorm:"index"`
+	ParentID    *uint      `json:"parent_id,omitempty" gorm:"index"`
+	Depth       int        `json:"depth" gorm:"default:0"`
+	UserID      *uint      `json:"user_id,omitempty"`
+	AuthorName  string     `json:"authorName"`
+	AuthorEmail string     `json:"-"`
+	Body        string     `json:"body"`
+	BodyHTML    string     `json:"bodyHtml" gorm:"-"`
+	Status      string     `json:"status" gorm:"not null;default:'pending';index"`
+	Replies     []*Comment `json:"replies,omitempty" gorm:"-"`
+	// Spam scoring results, shown to moderators only
+	SpamScore     float64  `json:"spamScore,omitempty"`
+	SpamReasons   []string `json:"spamReasons,omitempty" gorm:"serializer:json"`
+	SpamTrainedAs string   `json:"-"`
+	IP            string   `json:"-"`
+	UserAgent     string   `json:"-"`
+}
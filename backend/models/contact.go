@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ContactMessage is a message sent through the public contact form. ReadAt
+// and ArchivedAt track the inbox state; RepliedAt, RepliedByID and ReplyNote
+// record that someone answered it outside the site. Messages the spam filter
+// catches are kept with Spam set so they can be reviewed.
+type ContactMessage struct {
+	gorm.Model
+	Name        string     `json:"name"`
+	Email       string     `json:"email"`
+	Company     string     `json:"company,omitempty"`
+	Subject     string     `json:"subject"`
+	Body        string     `json:"body"`
+	ReadAt      *time.Time `json:"readAt"`
+	ArchivedAt  *time.Time `json:"archivedAt" gorm:"index"`
+	RepliedAt   *time.Time `json:"repliedAt"`
+	RepliedByID *uint      `json:"repliedById,omitempty"`
+	ReplyNote   string     `json:"replyNote,omitempty"`
+	Spam        bool       `json:"spam" gorm:"default:false;index"`
+	// Spam scoring results
+	SpamScore     float64  `json:"spamScore,omitempty"`
+	SpamReasons   []string `json:"spamReasons,omitempty" gorm:"serializer:json"`
+	SpamTrainedAs string   `json:"-"`
+	IP            string   `json:"-"`
+	UserAgent     string   `json:"-"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Owners that can reference media
+const (
+	MediaOwnerPost    = "post"
+	MediaOwnerProject = "project"
+)
+
+// Media is an uploaded file in the media library. StorageKey names the
+// stored object and Checksum is the SHA-256 of its content; media with the
+// same content share one MediaObject. UploadChecksum is the SHA-256 of the
+// file as uploaded, before its metadata was stripped. Width and Height are
+// set for images, along with resized Variants and the Blurhash and LQIP
+// placeholders. URL, Srcset and References are filled in when media is read;
+// Srcset maps each variant MIME type to a srcset attribute value.
+type Media struct {
+	gorm.Model
+	StorageKey     string            `json:"storageKey" gorm:"index:idx_media_object_key;size:255"`
+	Filename       string            `json:"filename"`
+	MimeType       string            `json:"mimeType" gorm:"index"`
+	Size           int64             `json:"size"`
+	Width          int               `json:"width,omitempty"`
+	Height         int               `json:"height,omitempty"`
+	AltText        string            `json:"altText"`
+	Checksum       string            `json:"checksum" gorm:"index;size:64"`
+	UploadChecksum string            `json:"-" gorm:"index;size:64"`
+	UploadedByID   uint              `json:"uploadedById" gorm:"index"`
+	UploadedBy     *User             `json:"uploadedBy,omitempty" gorm:"foreignKey:UploadedByID" binding:"-"`
+	Variants       []MediaVariant    `json:"variants,omitempty" gorm:"serializer:json"`
+	Blurhash       string            `json:"blurhash,omitempty" gorm:"size:64"`
+	LQIP           string            `json:"lqip,omitempty" gorm:"type:text"`
+	URL            string            `json:"url" gorm:"-"`
+	Srcset         map[string]string `json:"srcset,omitempty" gorm:"-"`
+	References     []MediaReference  `json:"references,omitempty" gorm:"-"`
+}
+
+// MediaObject is a stored file and its variants. RefCount is the number of
+// media items using it; the files are deleted with the last of them.
+type MediaObject struct {
+	StorageKey string    `json:"storageKey" gorm:"primaryKey;size:255"`
+	Checksum   string    `json:"checksum" gorm:"index;size:64"`
+	RefCount   int       `json:"refCount"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// MediaVariant is a resized copy of an image, stored next to the original
+type MediaVariant struct {
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	MimeType   string `json:"mimeType"`
+	StorageKey string `json:"storageKey"`
+	Size       int64  `json:"size"`
+	URL        string `json:"url,omitempty"`
+}
+
+// MediaReference records that a post's content or a project's image or
+// description uses a media item
+type MediaReference struct {
+	ID        uint   `json:"-" gorm:"primaryKey"`
+	MediaID   uint   `json:"mediaId" gorm:"uniqueIndex:idx_media_reference"`
+	OwnerType string `json:"ownerType" gorm:"size:20;uniqueIndex:idx_media_reference;index:idx_media_reference_owner"`
+	OwnerID   uint   `json:"ownerId" gorm:"uniqueIndex:idx_media_reference;index:idx_media_reference_owner"`
+}
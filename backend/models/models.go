@@ -11,16 +11,28 @@ type User struct {
 	Password string    `json:"-" binding:"required,min=6"`
 	Avatar   string    `json:"avatar,omitempty"`
 	IsAdmin  bool      `json:"isAdmin" gorm:"default:false"`
+	Role     string    `json:"role" gorm:"not null;default:'editor'"`
 	Posts    []Post    `json:"posts,omitempty" gorm:"foreignKey:AuthorID"`
 	Projects []Project `json:"projects,omitempty" gorm:"foreignKey:UserID"`
 }
 
+// User roles. Authors may only submit their own posts for review; editors
+// run the editorial workflow for every post.
+const (
+	RoleAuthor = "author"
+	RoleEditor = "editor"
+)
+
+// IsEditor reports whether the user may review and publish any post
+func (u *User) IsEditor() bool {
+	return u.IsAdmin || u.Role == RoleEditor
+}
 
 type Activity struct {
 	gorm.Model
 	Type        string   `json:"type" binding:"required"`
 	Description string   `json:"description" binding:"required"`
 	UserID      uint     `json:"user_id"`
-	User        User     `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	User        User     `json:"user,omitempty" gorm:"foreignKey:UserID" binding:"-"`
 	Links       []string `json:"links,omitempty" gorm:"type:text[]"`
 }
@@ -1,25 +1,57 @@
 package models
 
 import (
+	"fmt"
 	"gorm.io/gorm"
+	"strings"
 	"time"
 )
 
 type Post struct {
 	gorm.Model
-	Title       string    `json:"title" binding:"required"`
-	Content     string    `json:"content" binding:"required"`
-	Excerpt     string    `json:"excerpt" binding:"required"`
-	Slug        string    `json:"slug" gorm:"uniqueIndex"`
-	Published   bool      `json:"published" gorm:"default:false"`
+	Title       string     `json:"title" binding:"required"`
+	Content     string     `json:"content" binding:"required"`
+	Excerpt     string     `json:"excerpt" binding:"required"`
+	Slug        string     `json:"slug" gorm:"uniqueIndex"`
+	Published   bool       `json:"published" gorm:"default:false"`
 	PublishedAt *time.Time `json:"publishedAt,omitempty"`
-	Likes       int       `json:"likes" gorm:"default:0"`
-	Views       int       `json:"views" gorm:"default:0"`
-	ReadTime    int       `json:"readTime" gorm:"default:0"`
-	AuthorID    uint      `json:"author_id"`
-	Author      User      `json:"author,omitempty" gorm:"foreignKey:AuthorID"`
-	Tags        []string  `json:"tags,omitempty" gorm:"type:text[]"`
-	SocialData  string    `json:"social_data,omitempty"`
+	Status      string     `json:"status" gorm:"not null;default:'draft';index"`
+	ScheduledAt *time.Time `json:"scheduledAt,omitempty"`
+	Likes       int        `json:"likes" gorm:"default:0"`
+	Views       int        `json:"views" gorm:"default:0"`
+	ReadTime    int        `json:"readTime" gorm:"default:0"`
+	AuthorID    uint       `json:"author_id"`
+	Author      User       `json:"author,omitempty" gorm:"foreignKey:AuthorID" binding:"-"`
+	Tags        []string   `json:"tags,omitempty" gorm:"type:text[]"`
+	SocialData  string     `json:"social_data,omitempty"`
+	// CommentCount is the number of approved comments, kept up to date by
+	// the comment service
+	CommentCount int `json:"commentCount" gorm:"not null;default:0"`
+	// Version is bumped on every update and backs the ETag
+	Version int `json:"version" gorm:"not null;default:1"`
+	// Series is filled in when a single post is read
+	Series *SeriesNav `json:"series,omitempty" gorm:"-" binding:"-"`
+}
+
+// ETag identifies this version of the post for conditional requests
+func (p *Post) ETag() string {
+	return fmt.Sprintf(`"%d-%d"`, p.ID, p.Version)
+}
+
+// TrashSlug is the slug a post is stored under while it is in the trash. The
+// unique index on slug also covers deleted rows, so moving the slug aside lets
+// a new post take it over.
+func (p *Post) TrashSlug() string {
+	return p.Slug + trashSuffix(p.ID)
+}
+
+// OriginalSlug returns the slug the post had before it was moved to the trash
+func (p *Post) OriginalSlug() string {
+	return strings.TrimSuffix(p.Slug, trashSuffix(p.ID))
+}
+
+func trashSuffix(id uint) string {
+	return fmt.Sprintf("~trashed-%d", id)
 }
 
 type Author struct {
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PreviewLink grants read access to a post, published or not, to anyone
+// holding its signed token until it expires or is revoked
+type PreviewLink struct {
+	gorm.Model
+	PostID      uint       `json:"post_id" gorm:"index"`
+	CreatedByID uint       `json:"created_by_id"`
+	CreatedBy   User       `json:"createdBy,omitempty" gorm:"foreignKey:CreatedByID" binding:"-"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty"`
+	Views       int        `json:"views" gorm:"default:0"`
+}
+
+// Active reports whether the link may still be used at now
+func (l *PreviewLink) Active(now time.Time) bool {
+	return l.RevokedAt == nil && now.Before(l.ExpiresAt)
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// RelatedPost is a precomputed recommendation of Related for readers of Post.
+// Rank 1 is the best match.
+type RelatedPost struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	PostID    uint `gorm:"index"`
+	RelatedID uint `gorm:"index"`
+	Score     float64
+	Rank      int
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// ResumableUpload is a file being uploaded in chunks. Received bytes are
+// stored as parts under PartKeys, in order, until they reach Length; the
+// assembled file is then added to the media library as MediaID. Checksum is the
+// SHA-256 the client expects the whole file to have. An upload whose file is
+// refused keeps the reason in ErrorCode and Error. Uploads are deleted once
+// ExpiresAt passes, whether they finished or not.
+type ResumableUpload struct {
+	ID           string    `json:"id" gorm:"primaryKey;size:36"`
+	Filename     string    `json:"filename"`
+	MimeType     string    `json:"mimeType,omitempty"`
+	Length       int64     `json:"length"`
+	Received     int64     `json:"received"`
+	PartKeys     []string  `json:"-" gorm:"serializer:json"`
+	Checksum     string    `json:"checksum,omitempty" gorm:"size:64"`
+	UploadedByID uint      `json:"uploadedById" gorm:"index"`
+	MediaID      *uint     `json:"mediaId,omitempty"`
+	Media        *Media    `json:"media,omitempty" gorm:"-"`
+	ErrorCode    string    `json:"-" gorm:"size:50"`
+	Error        string    `json:"-"`
+	ExpiresAt    time.Time `json:"expiresAt" gorm:"index"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// Failed reports whether the assembled file was refused
+func (u *ResumableUpload) Failed() bool {
+	return u.ErrorCode != ""
+}
+
+// Complete reports whether every byte has been received
+func (u *ResumableUpload) Complete() bool {
+	return u.Received == u.Length
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// PostRevision is a snapshot of a post's text as saved by an editor
+type PostRevision struct {
+	gorm.Model
+	PostID   uint     `json:"post_id" gorm:"index"`
+	Version  int      `json:"version"`
+	Title    string   `json:"title"`
+	Excerpt  string   `json:"excerpt"`
+	Content  string   `json:"content,omitempty"`
+	Tags     []string `json:"tags,omitempty" gorm:"type:text[]"`
+	EditorID uint     `json:"editor_id"`
+	Editor   User     `json:"editor,omitempty" gorm:"foreignKey:EditorID" binding:"-"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Series groups posts, such as the parts of a tutorial, in a fixed order
+type Series struct {
+	gorm.Model
+	Title       string       `json:"title" binding:"required"`
+	Slug        string       `json:"slug" gorm:"uniqueIndex"`
+	Description string       `json:"description"`
+	Posts       []SeriesPost `json:"posts" gorm:"-" binding:"-"`
+}
+
+// SeriesEntry places a post in a series. A post belongs to at most one series.
+type SeriesEntry struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	SeriesID  uint `gorm:"index"`
+	PostID    uint `gorm:"uniqueIndex"`
+	Position  int
+	Post      Post
+	Series    Series
+}
+
+// SeriesPost is a post as listed in its series. Position starts at 1.
+type SeriesPost struct {
+	Position  int    `json:"position"`
+	Title     string `json:"title"`
+	Slug      string `json:"slug"`
+	Excerpt   string `json:"excerpt,omitempty"`
+	Published bool   `json:"published"`
+}
+
+// SeriesNav locates a post within its series
+type SeriesNav struct {
+	ID       uint        `json:"id"`
+	Title    string      `json:"title"`
+	Slug     string      `json:"slug"`
+	Position int         `json:"position"`
+	Total    int         `json:"total"`
+	Previous *SeriesPost `json:"previous,omitempty"`
+	Next     *SeriesPost `json:"next,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// SpamToken holds how many spam and ham submissions contained Token. The row
+// for SpamTotalsToken counts the trained submissions themselves.
+type SpamToken struct {
+	Token string `gorm:"primaryKey;size:64"`
+	Spam  int    `gorm:"not null;default:0"`
+	Ham   int    `gorm:"not null;default:0"`
+}
+
+// SpamTotalsToken is the reserved token whose row counts trained submissions
+const SpamTotalsToken = "__documents__"
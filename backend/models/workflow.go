@@ -0,0 +1,25 @@
+package models
+
+import "gorm.io/gorm"
+
+// Post workflow states
+const (
+	StatusDraft     = "draft"
+	StatusInReview  = "in_review"
+	StatusApproved  = "approved"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+// PostTransition records a move of a post between workflow states together
+// with the reviewer's comment
+type PostTransition struct {
+	gorm.Model
+	PostID     uint   `json:"post_id" gorm:"index"`
+	FromStatus string `json:"fromStatus"`
+	ToStatus   string `json:"toStatus"`
+	Comment    string `json:"comment,omitempty"`
+	UserID     uint   `json:"user_id"`
+	User       User   `json:"user,omitempty" gorm:"foreignKey:UserID" binding:"-"`
+}
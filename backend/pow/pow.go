@@ -0,0 +1,236 @@
+// Package pow issues and verifies self-hosted proof-of-work challenges for
+// anonymous submissions. A challenge is an HMAC-signed token bound to the
+// client IP; it is solved by finding a nonce whose SHA-256 hash together with
+// the token starts with the required number of zero bits.
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Algorithm names the hash clients must use to solve a challenge
+const Algorithm = "sha256"
+
+var (
+	ErrMalformed    = errors.New("challenge is malformed")
+	ErrSignature    = errors.New("challenge signature does not match")
+	ErrExpired      = errors.New("challenge has expired")
+	ErrReplayed     = errors.New("challenge was already used")
+	ErrInsufficient = errors.New("nonce does not solve the challenge")
+)
+
+// Challenge is issued to a client to solve before submitting
+type Challenge struct {
+	Token      string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Algorithm  string    `json:"algorithm"`
+}
+
+// Config tunes how hard challenges are. Difficulty is the number of leading
+// zero bits required; it rises by one bit for every time a rate limiter
+// reported an IP as throttled within ThrottleWindow, up to MaxDifficulty.
+type Config struct {
+	Difficulty     int
+	MaxDifficulty  int
+	TTL            time.Duration
+	ThrottleWindow time.Duration
+}
+
+// Issuer creates and verifies challenges. Used challenges are remembered
+// until they expire so that each one is accepted once.
+type Issuer struct {
+	secret []byte
+	cfg    Config
+	now    func() time.Time
+
+	mu        sync.Mutex
+	used      map[string]time.Time
+	throttled map[string][]time.Time
+	swept     time.Time
+}
+
+// NewIssuer creates an issuer signing with secret. Without a secret a random
+// one is generated, so challenges do not survive a restart.
+func NewIssuer(secret []byte, cfg Config) (*Issuer, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.MaxDifficulty < cfg.Difficulty {
+		cfg.MaxDifficulty = cfg.Difficulty
+	}
+	return &Issuer{
+		secret:    secret,
+		cfg:       cfg,
+		now:       time.Now,
+		used:      map[string]time.Time{},
+		throttled: map[string][]time.Time{},
+	}, nil
+}
+
+// Issue creates a challenge for the client at ip
+func (i *Issuer) Issue(ip string) (Challenge, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return Challenge{}, err
+	}
+
+	now := i.now()
+	difficulty := i.difficultyFor(ip, now)
+	expiresAt := now.Add(i.cfg.TTL).Truncate(time.Second)
+	payload := fmt.Sprintf("%s.%d.%d", base64.RawURLEncoding.EncodeToString(salt), difficulty, expiresAt.Unix())
+	return Challenge{
+		Token:      payload + "." + i.sign(payload, ip),
+		Difficulty: difficulty,
+		ExpiresAt:  expiresAt,
+		Algorithm:  Algorithm,
+	}, nil
+}
+
+// Verify checks that nonce solves token for the client at ip and marks the
+// token as used
+func (i *Issuer) Verify(token, nonce, ip string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 {
+		return ErrMalformed
+	}
+	difficulty, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return ErrMalformed
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(i.sign(payload, ip))) {
+		return ErrSignature
+	}
+	expiresAt := time.Unix(expires, 0)
+	now := i.now()
+	if !now.Before(expiresAt) {
+		return ErrExpired
+	}
+	if LeadingZeroBits(hash(token, nonce)) < difficulty {
+		return ErrInsufficient
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.sweep(now)
+	if _, ok := i.used[token]; ok {
+		return ErrReplayed
+	}
+	i.used[token] = expiresAt
+	return nil
+}
+
+// Throttled records that a rate limiter rejected a request from ip, making
+// the challenges it gets harder for a while
+func (i *Issuer) Throttled(ip string) {
+	now := i.now()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.sweep(now)
+
+	i.throttled[ip] = append(i.recentThrottles(ip, now), now)
+}
+
+// difficultyFor returns the difficulty of a challenge for ip
+func (i *Issuer) difficultyFor(ip string, now time.Time) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.sweep(now)
+
+	difficulty := i.cfg.Difficulty + len(i.recentThrottles(ip, now))
+	if difficulty > i.cfg.MaxDifficulty {
+		difficulty = i.cfg.MaxDifficulty
+	}
+	return difficulty
+}
+
+// recentThrottles drops the reports for ip that are older than the window and
+// returns the rest. The caller holds i.mu.
+func (i *Issuer) recentThrottles(ip string, now time.Time) []time.Time {
+	cutoff := now.Add(-i.cfg.ThrottleWindow)
+	recent := i.throttled[ip][:0]
+	for _, t := range i.throttled[ip] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) == 0 {
+		delete(i.throttled, ip)
+		return nil
+	}
+	i.throttled[ip] = recent
+	return recent
+}
+
+// sweep forgets expired tokens and idle IPs, at most once a minute. The
+// caller holds i.mu.
+func (i *Issuer) sweep(now time.Time) {
+	if now.Sub(i.swept) < time.Minute {
+		return
+	}
+	i.swept = now
+	for token, expiresAt := range i.used {
+		if !now.Before(expiresAt) {
+			delete(i.used, token)
+		}
+	}
+	cutoff := now.Add(-i.cfg.ThrottleWindow)
+	for ip, times := range i.throttled {
+		if len(times) == 0 || !times[len(times)-1].After(cutoff) {
+			delete(i.throttled, ip)
+		}
+	}
+}
+
+func (i *Issuer) sign(payload, ip string) string {
+	mac := hmac.New(sha256.New, i.secret)
+	mac.Write([]byte("pow|" + payload + "|" + ip))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func hash(token, nonce string) []byte {
+	sum := sha256.Sum256([]byte(token + ":" + nonce))
+	return sum[:]
+}
+
+// LeadingZeroBits counts the zero bits at the start of b
+func LeadingZeroBits(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if c != 0 {
+			return n + bits.LeadingZeros8(c)
+		}
+		n += 8
+	}
+	return n
+}
+
+// Solve finds a nonce for token at the given difficulty. Browsers do the same
+// in JavaScript; this is the reference implementation.
+func Solve(token string, difficulty int) string {
+	for n := 0; ; n++ {
+		nonce := strconv.Itoa(n)
+		if LeadingZeroBits(hash(token, nonce)) >= difficulty {
+			return nonce
+		}
+	}
+}
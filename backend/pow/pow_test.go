@@ -0,0 +1,91 @@
+package pow
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestIssuer(t *testing.T) *Issuer {
+	t.Helper()
+
+	issuer, err := NewIssuer([]byte("secret"), Config{Difficulty: 8, MaxDifficulty: 10, TTL: time.Minute, ThrottleWindow: time.Minute})
+	if err != nil {
+		t.Fatalf("NewIssuer returned error: %v", err)
+	}
+	return issuer
+}
+
+func TestVerify(t *testing.T) {
+	issuer := newTestIssuer(t)
+	challenge, err := issuer.Issue("10.0.0.1")
+	if err != nil {
+		t.Fatalf("Issue returned error: %v", err)
+	}
+	nonce := Solve(challenge.Token, challenge.Difficulty)
+
+	// Tampering with the difficulty breaks the signature
+	parts := strings.Split(challenge.Token, ".")
+	parts[1] = "0"
+	easier := strings.Join(parts, ".")
+
+	wrongNonce := "x"
+	for LeadingZeroBits(hash(challenge.Token, wrongNonce)) >= challenge.Difficulty {
+		wrongNonce += "x"
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		nonce  string
+		ip     string
+		expect error
+	}{
+		{"malformed", "abc", nonce, "10.0.0.1", ErrMalformed},
+		{"tampered", easier, Solve(easier, 0), "10.0.0.1", ErrSignature},
+		{"other client", challenge.Token, nonce, "10.0.0.2", ErrSignature},
+		{"unsolved", challenge.Token, wrongNonce, "10.0.0.1", ErrInsufficient},
+		{"solved", challenge.Token, nonce, "10.0.0.1", nil},
+		{"replayed", challenge.Token, nonce, "10.0.0.1", ErrReplayed},
+	}
+	for _, tt := range tests {
+		if err := issuer.Verify(tt.token, tt.nonce, tt.ip); !errors.Is(err, tt.expect) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expect, err)
+		}
+	}
+
+	expiring, _ := issuer.Issue("10.0.0.1")
+	issuer.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if err := issuer.Verify(expiring.Token, Solve(expiring.Token, expiring.Difficulty), "10.0.0.1"); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected an expired challenge to be rejected, got %v", err)
+	}
+}
+
+func TestDifficultyRisesForThrottledIPs(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	var got []int
+	for i := 0; i < 4; i++ {
+		challenge, err := issuer.Issue("10.0.0.1")
+		if err != nil {
+			t.Fatalf("Issue returned error: %v", err)
+		}
+		got = append(got, challenge.Difficulty)
+		issuer.Throttled("10.0.0.1")
+	}
+	want := []int{8, 9, 10, 10}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected difficulties %v, got %v", want, got)
+		}
+	}
+
+	if challenge, _ := issuer.Issue("10.0.0.2"); challenge.Difficulty != 8 {
+		t.Errorf("expected other IPs to keep the base difficulty, got %d", challenge.Difficulty)
+	}
+	issuer.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if challenge, _ := issuer.Issue("10.0.0.1"); challenge.Difficulty != 8 {
+		t.Errorf("expected the difficulty to fall back once the window passes, got %d", challenge.Difficulty)
+	}
+}
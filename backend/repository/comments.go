@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+
+	"blog-backend/models"
+	"blog-backend/tracing"
+
+	"gorm.io/gorm"
+)
+
+// Comment operations
+func (r *Repository) CreateComment(ctx context.Context, comment *models.Comment) error {
+	ctx, span := tracing.Start(ctx, "Repository.CreateComment")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Create(comment).Error
+}
+
+func (r *Repository) FindComment(ctx context.Context, id uint) (*models.Comment, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindComment")
+	defer span.End()
+
+	var comment models.Comment
+	err := r.db.WithContext(ctx).First(&comment, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// FindComments returns the comments with the given IDs
+func (r *Repository) FindComments(ctx context.Context, ids []uint) ([]models.Comment, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindComments")
+	defer span.End()
+
+	var comments []models.Comment
+	err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&comments).Error
+	return comments, err
+}
+
+// SetCommentTrainedAs records the label the spam filter learnt a comment as
+func (r *Repository) SetCommentTrainedAs(ctx context.Context, id uint, label string) error {
+	ctx, span := tracing.Start(ctx, "Repository.SetCommentTrainedAs")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Model(&models.Comment{}).Where("id = ?", id).
+		UpdateColumn("spam_trained_as", label).Error
+}
+
+// ListPostComments returns the comments of a post in the given states, oldest
+// first
+func (r *Repository) ListPostComments(ctx context.Context, postID uint, statuses []string) ([]models.Comment, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListPostComments")
+	defer span.End()
+
+	var comments []models.Comment
+	err := r.db.WithContext(ctx).Where("post_id = ? AND status IN ?", postID, statuses).Order("id asc").Find(&comments).Error
+	return comments, err
+}
+
+// ListComments returns a page of comments across posts for moderation, newest
+// first, together with the total number matching. An empty status matches
+// every state.
+func (r *Repository) ListComments(ctx context.Context, status string, limit, offset int) ([]models.Comment, int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListComments")
+	defer span.End()
+
+	query := r.db.WithContext(ctx).Model(&models.Comment{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var comments []models.Comment
+	err := query.Order("id desc").Limit(limit).Offset(offset).Find(&comments).Error
+	return comments, total, err
+}
+
+// SetCommentStatus moves the given comments to status and recounts the
+// approved comments of the affected posts
+func (r *Repository) SetCommentStatus(ctx context.Context, ids []uint, status string) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.SetCommentStatus")
+	defer span.End()
+
+	var rows int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var postIDs []uint
+		if err := tx.Model(&models.Comment{}).Where("id IN ?", ids).Distinct().Pluck("post_id", &postIDs).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Comment{}).Where("id IN ? AND status <> ?", ids, status).Update("status", status)
+		if result.Error != nil {
+			return result.Error
+		}
+		rows = result.RowsAffected
+		return recountComments(tx, postIDs)
+	})
+	return rows, err
+}
+
+// RecountComments refreshes the denormalized comment count of a post
+func (r *Repository) RecountComments(ctx context.Context, postID uint) error {
+	ctx, span := tracing.Start(ctx, "Repository.RecountComments")
+	defer span.End()
+
+	return recountComments(r.db.WithContext(ctx), []uint{postID})
+}
+
+// recountComments refreshes the comment count of the posts and bumps the
+// version of those whose count changed, since the count is part of their ETag
+func recountComments(tx *gorm.DB, postIDs []uint) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+	approved := tx.Model(&models.Comment{}).Select("COUNT(*)").
+		Where("comments.post_id = posts.id AND comments.status = ?", models.CommentApproved)
+	return tx.Unscoped().Model(&models.Post{}).Where("id IN ? AND comment_count <> (?)", postIDs, approved).
+		UpdateColumns(map[string]interface{}{"comment_count": approved, "version": gorm.Expr("version + 1")}).Error
+}
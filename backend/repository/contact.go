@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+
+	"blog-backend/models"
+	"blog-backend/tracing"
+)
+
+// Contact inbox folders
+const (
+	ContactInbox    = "inbox"
+	ContactUnread   = "unread"
+	ContactArchived = "archived"
+	ContactSpam     = "spam"
+	ContactAll      = "all"
+)
+
+// Contact message operations
+func (r *Repository) CreateContactMessage(ctx context.Context, msg *models.ContactMessage) error {
+	ctx, span := tracing.Start(ctx, "Repository.CreateContactMessage")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Create(msg).Error
+}
+
+func (r *Repository) FindContactMessage(ctx context.Context, id uint) (*models.ContactMessage, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindContactMessage")
+	defer span.End()
+
+	var msg models.ContactMessage
+	if err := r.db.WithContext(ctx).First(&msg, id).Error; err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// ListContactMessages returns a page of messages in folder, newest first,
+// together with the total number in the folder. The inbox and unread folders
+// leave out archived messages and spam.
+func (r *Repository) ListContactMessages(ctx context.Context, folder string, limit, offset int) ([]models.ContactMessage, int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListContactMessages")
+	defer span.End()
+
+	query := r.db.WithContext(ctx).Model(&models.ContactMessage{})
+	switch folder {
+	case ContactInbox:
+		query = query.Where("archived_at IS NULL AND spam = ?", false)
+	case ContactUnread:
+		query = query.Where("read_at IS NULL AND archived_at IS NULL AND spam = ?", false)
+	case ContactArchived:
+		query = query.Where("archived_at IS NOT NULL AND spam = ?", false)
+	case ContactSpam:
+		query = query.Where("spam = ?", true)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var messages []models.ContactMessage
+	err := query.Order("id desc").Limit(limit).Offset(offset).Find(&messages).Error
+	return messages, total, err
+}
+
+// CountUnreadContactMessages counts unread messages in the inbox
+func (r *Repository) CountUnreadContactMessages(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.CountUnreadContactMessages")
+	defer span.End()
+
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.ContactMessage{}).
+		Where("read_at IS NULL AND archived_at IS NULL AND spam = ?", false).Count(&count).Error
+	return count, err
+}
+
+// UpdateContactMessage saves the given fields of msg, including zero values
+func (r *Repository) UpdateContactMessage(ctx context.Context, msg *models.ContactMessage, fields ...string) error {
+	ctx, span := tracing.Start(ctx, "Repository.UpdateContactMessage")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Model(msg).Select(fields).Updates(msg).Error
+}
@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"blog-backend/models"
+	"blog-backend/tracing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MediaFilter narrows the media library listing. Query matches the filename
+// and alt text; MimePrefix matches types such as "image/".
+type MediaFilter struct {
+	Query      string
+	MimePrefix string
+	Orphaned   bool
+}
+
+// Media operations
+
+// CreateMedia adds a media item and takes a reference on its stored object,
+// recording the object when its content is new
+func (r *Repository) CreateMedia(ctx context.Context, media *models.Media) error {
+	ctx, span := tracing.Start(ctx, "Repository.CreateMedia")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		object := models.MediaObject{StorageKey: media.StorageKey, Checksum: media.Checksum, RefCount: 1}
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "storage_key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"ref_count": gorm.Expr("media_objects.ref_count + 1")}),
+		}).Create(&object).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(media).Error
+	})
+}
+
+// FindMediaByChecksum returns the oldest media item uploaded by uploaderID
+// whose stored or uploaded content has the given checksum
+func (r *Repository) FindMediaByChecksum(ctx context.Context, checksum string, uploaderID uint) (*models.Media, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindMediaByChecksum")
+	defer span.End()
+
+	var media models.Media
+	err := r.db.WithContext(ctx).Preload("UploadedBy").
+		Where("(checksum = ? OR upload_checksum = ?) AND uploaded_by_id = ?", checksum, checksum, uploaderID).Order("id").First(&media).Error
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// FindMediaByStorageKey returns the oldest media item using the stored
+// object under key
+func (r *Repository) FindMediaByStorageKey(ctx context.Context, key string) (*models.Media, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindMediaByStorageKey")
+	defer span.End()
+
+	var media models.Media
+	if err := r.db.WithContext(ctx).Where("storage_key = ?", key).Order("id").First(&media).Error; err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+func (r *Repository) FindMedia(ctx context.Context, id uint) (*models.Media, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindMedia")
+	defer span.End()
+
+	var media models.Media
+	if err := r.db.WithContext(ctx).Preload("UploadedBy").First(&media, id).Error; err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// ListMedia returns a page of the media library, newest first, together with
+// the total number matching filter
+func (r *Repository) ListMedia(ctx context.Context, filter MediaFilter, limit, offset int) ([]models.Media, int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListMedia")
+	defer span.End()
+
+	query := r.db.WithContext(ctx).Model(&models.Media{})
+	if q := strings.TrimSpace(filter.Query); q != "" {
+		pattern := "%" + escapeLike(strings.ToLower(q)) + "%"
+		query = query.Where("LOWER(filename) LIKE ? ESCAPE '\\' OR LOWER(alt_text) LIKE ? ESCAPE '\\'", pattern, pattern)
+	}
+	if filter.MimePrefix != "" {
+		query = query.Where("mime_type LIKE ? ESCAPE '\\'", escapeLike(filter.MimePrefix)+"%")
+	}
+	if filter.Orphaned {
+		query = query.Where("NOT EXISTS (?)", r.db.Model(&models.MediaReference{}).
+			Select("1").Where("media_references.media_id = media.id"))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var media []models.Media
+	err := query.Order("id desc").Limit(limit).Offset(offset).Find(&media).Error
+	return media, total, err
+}
+
+// UpdateMediaAltText sets the alt text of a media item
+func (r *Repository) UpdateMediaAltText(ctx context.Context, media *models.Media, altText string) error {
+	ctx, span := tracing.Start(ctx, "Repository.UpdateMediaAltText")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Model(media).Update("alt_text", altText).Error
+}
+
+// DeleteMedia permanently removes a media item and its references and drops
+// its reference on the stored object. It reports whether that was the last
+// reference, in which case the object's files should be deleted too.
+func (r *Repository) DeleteMedia(ctx context.Context, media *models.Media) (bool, error) {
+	ctx, span := tracing.Start(ctx, "Repository.DeleteMedia")
+	defer span.End()
+
+	last := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("media_id = ?", media.ID).Delete(&models.MediaReference{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(media).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.MediaObject{}).Where("storage_key = ?", media.StorageKey).
+			Update("ref_count", gorm.Expr("ref_count - 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Uploaded before objects were shared
+			last = true
+			return nil
+		}
+		var object models.MediaObject
+		if err := tx.Where("storage_key = ?", media.StorageKey).First(&object).Error; err != nil {
+			return err
+		}
+		if object.RefCount > 0 {
+			return nil
+		}
+		last = true
+		return tx.Delete(&object).Error
+	})
+	return last, err
+}
+
+// ListMediaReferences returns the references to the given media items
+func (r *Repository) ListMediaReferences(ctx context.Context, mediaIDs []uint) ([]models.MediaReference, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListMediaReferences")
+	defer span.End()
+
+	var refs []models.MediaReference
+	err := r.db.WithContext(ctx).Where("media_id IN ?", mediaIDs).Order("owner_type, owner_id").Find(&refs).Error
+	return refs, err
+}
+
+// SetMediaReferences replaces the media referenced by one owner with the
+// media stored under keys. Keys that match no media are ignored.
+func (r *Repository) SetMediaReferences(ctx context.Context, ownerType string, ownerID uint, keys []string) error {
+	ctx, span := tracing.Start(ctx, "Repository.SetMediaReferences")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).Delete(&models.MediaReference{}).Error; err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+
+		var ids []uint
+		if err := tx.Model(&models.Media{}).Where("storage_key IN ?", keys).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		refs := make([]models.MediaReference, len(ids))
+		for i, id := range ids {
+			refs[i] = models.MediaReference{MediaID: id, OwnerType: ownerType, OwnerID: ownerID}
+		}
+		if len(refs) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&refs).Error
+	})
+}
+
+// ListMediaOwners returns the text of every post and project that may
+// reference media, trashed ones included since they can be restored
+func (r *Repository) ListMediaOwners(ctx context.Context) ([]models.Post, []models.Project, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListMediaOwners")
+	defer span.End()
+
+	var posts []models.Post
+	if err := r.db.WithContext(ctx).Unscoped().Select("id", "content").Find(&posts).Error; err != nil {
+		return nil, nil, err
+	}
+	var projects []models.Project
+	if err := r.db.WithContext(ctx).Unscoped().Select("id", "image_url", "description").Find(&projects).Error; err != nil {
+		return nil, nil, err
+	}
+	return posts, projects, nil
+}
+
+// ListOrphanedMedia returns media with no references that was uploaded
+// before cutoff
+func (r *Repository) ListOrphanedMedia(ctx context.Context, cutoff time.Time) ([]models.Media, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListOrphanedMedia")
+	defer span.End()
+
+	var media []models.Media
+	err := r.db.WithContext(ctx).Where("created_at < ?", cutoff).
+		Where("NOT EXISTS (?)", r.db.Model(&models.MediaReference{}).
+			Select("1").Where("media_references.media_id = media.id")).
+		Find(&media).Error
+	return media, err
+}
+
+// escapeLike escapes the LIKE wildcards in s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"blog-backend/models"
+	"blog-backend/tracing"
+
+	"gorm.io/gorm"
+)
+
+// Preview link operations
+func (r *Repository) CreatePreviewLink(ctx context.Context, link *models.PreviewLink) error {
+	ctx, span := tracing.Start(ctx, "Repository.CreatePreviewLink")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Create(link).Error
+}
+
+// ListPreviewLinks returns the preview links of a post, newest first
+func (r *Repository) ListPreviewLinks(ctx context.Context, postID uint) ([]models.PreviewLink, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListPreviewLinks")
+	defer span.End()
+
+	var links []models.PreviewLink
+	err := r.db.WithContext(ctx).Preload("CreatedBy").Where("post_id = ?", postID).Order("id desc").Find(&links).Error
+	return links, err
+}
+
+func (r *Repository) FindPreviewLink(ctx context.Context, postID, id uint) (*models.PreviewLink, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindPreviewLink")
+	defer span.End()
+
+	var link models.PreviewLink
+	err := r.db.WithContext(ctx).Where("post_id = ?", postID).First(&link, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// RevokePreviewLink marks the link revoked unless it already is
+func (r *Repository) RevokePreviewLink(ctx context.Context, link *models.PreviewLink, at time.Time) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.RevokePreviewLink")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).Model(link).Where("revoked_at IS NULL").Update("revoked_at", at)
+	return result.RowsAffected, result.Error
+}
+
+// RecordPreviewView counts one view of the preview link
+func (r *Repository) RecordPreviewView(ctx context.Context, id uint) error {
+	ctx, span := tracing.Start(ctx, "Repository.RecordPreviewView")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Model(&models.PreviewLink{}).Where("id = ?", id).
+		UpdateColumn("views", gorm.Expr("views + 1")).Error
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+
+	"blog-backend/models"
+	"blog-backend/tracing"
+
+	"gorm.io/gorm"
+)
+
+// Related post operations
+
+// ListPostsForRelated returns the fields of every post that scoring needs
+func (r *Repository) ListPostsForRelated(ctx context.Context) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListPostsForRelated")
+	defer span.End()
+
+	var posts []models.Post
+	err := r.db.WithContext(ctx).
+		Select("id", "title", "excerpt", "tags", "published", "published_at", "created_at").
+		Find(&posts).Error
+	return posts, err
+}
+
+// ReplaceRelatedPosts swaps the stored recommendations for related in one
+// transaction so readers never see a partial set
+func (r *Repository) ReplaceRelatedPosts(ctx context.Context, related []models.RelatedPost) error {
+	ctx, span := tracing.Start(ctx, "Repository.ReplaceRelatedPosts")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.RelatedPost{}).Error; err != nil {
+			return err
+		}
+		if len(related) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(related, 500).Error
+	})
+}
+
+// ListRelatedPosts returns up to limit published posts recommended for
+// postID, best first, without their content
+func (r *Repository) ListRelatedPosts(ctx context.Context, postID uint, limit int) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListRelatedPosts")
+	defer span.End()
+
+	var posts []models.Post
+	err := r.db.WithContext(ctx).Omit("content").
+		Joins("JOIN related_posts ON related_posts.related_id = posts.id").
+		Where("related_posts.post_id = ? AND posts.status = ?", postID, models.StatusPublished).
+		Order("related_posts.rank asc").Limit(limit).Find(&posts).Error
+	return posts, err
+}
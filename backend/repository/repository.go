@@ -2,7 +2,13 @@ package repository
 
 import (
 	"blog-backend/models"
+	"blog-backend/tracing"
+	"context"
+	"errors"
+	"time"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Repository provides all database operations
@@ -15,92 +21,324 @@ func NewRepository(db *gorm.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// Transaction runs fn with a repository bound to a single database
+// transaction, committing when fn returns nil
+func (r *Repository) Transaction(ctx context.Context, fn func(tx *Repository) error) error {
+	ctx, span := tracing.Start(ctx, "Repository.Transaction")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&Repository{db: tx})
+	})
+}
+
 // User operations
-func (r *Repository) FindUserByEmail(email string) (*models.User, error) {
+func (r *Repository) FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindUserByEmail")
+	defer span.End()
+
 	var user models.User
-	err := r.db.Where("email = ?", email).First(&user).Error
+	err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *Repository) FindUserByID(id uint) (*models.User, error) {
+func (r *Repository) FindUserByID(ctx context.Context, id uint) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindUserByID", tracing.UserID(id))
+	defer span.End()
+
 	var user models.User
-	err := r.db.First(&user, id).Error
+	err := r.db.WithContext(ctx).First(&user, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *Repository) CreateUser(user *models.User) error {
-	return r.db.Create(user).Error
+func (r *Repository) CreateUser(ctx context.Context, user *models.User) error {
+	ctx, span := tracing.Start(ctx, "Repository.CreateUser")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Create(user).Error
 }
 
 // Post operations
-func (r *Repository) ListPosts() ([]models.Post, error) {
+
+// ListPublishedPosts returns the posts readers may see, newest first
+func (r *Repository) ListPublishedPosts(ctx context.Context) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListPublishedPosts")
+	defer span.End()
+
 	var posts []models.Post
-	err := r.db.Preload("Author").Order("created_at desc").Find(&posts).Error
+	err := r.db.WithContext(ctx).Preload("Author").Where("status = ?", models.StatusPublished).
+		Order("created_at desc").Find(&posts).Error
 	return posts, err
 }
 
-func (r *Repository) FindPostBySlug(slug string) (*models.Post, error) {
+// FindPublishedPostBySlug loads a post readers may see; posts in any other
+// workflow state are reported as not found
+func (r *Repository) FindPublishedPostBySlug(ctx context.Context, slug string) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindPublishedPostBySlug", tracing.PostSlug(slug))
+	defer span.End()
+
 	var post models.Post
-	err := r.db.Preload("Author").Where("slug = ?", slug).First(&post).Error
+	err := r.db.WithContext(ctx).Preload("Author").
+		Where("slug = ? AND status = ?", slug, models.StatusPublished).First(&post).Error
 	if err != nil {
 		return nil, err
 	}
 	return &post, nil
 }
 
-func (r *Repository) CreatePost(post *models.Post) error {
-	return r.db.Create(post).Error
+// ListPosts returns posts in every workflow state, newest first. A non-zero
+// authorID limits them to that author's posts.
+func (r *Repository) ListPosts(ctx context.Context, authorID uint) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListPosts")
+	defer span.End()
+
+	query := r.db.WithContext(ctx).Preload("Author")
+	if authorID != 0 {
+		query = query.Where("author_id = ?", authorID)
+	}
+	var posts []models.Post
+	err := query.Order("created_at desc").Find(&posts).Error
+	return posts, err
+}
+
+// FindPostBySlug loads a post in any workflow state
+func (r *Repository) FindPostBySlug(ctx context.Context, slug string) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindPostBySlug", tracing.PostSlug(slug))
+	defer span.End()
+
+	var post models.Post
+	err := r.db.WithContext(ctx).Preload("Author").Where("slug = ?", slug).First(&post).Error
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (r *Repository) FindPostByID(ctx context.Context, id uint) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindPostByID")
+	defer span.End()
+
+	var post models.Post
+	err := r.db.WithContext(ctx).Preload("Author").First(&post, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (r *Repository) CreatePost(ctx context.Context, post *models.Post) error {
+	ctx, span := tracing.Start(ctx, "Repository.CreatePost")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Create(post).Error
+}
+
+// UpdatePost writes every column of an existing post, apart from the
+// denormalized comment count, and returns the number of rows affected. Unlike
+// Save it never inserts, and it only matches while the stored version equals
+// post.Version, so a post that has gone missing or was changed concurrently is
+// reported as zero rows. On success the version is bumped.
+func (r *Repository) UpdatePost(ctx context.Context, post *models.Post) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.UpdatePost", tracing.PostSlug(post.Slug))
+	defer span.End()
+
+	return r.updateVersioned(ctx, post, &post.Version, nil, "CommentCount")
+}
+
+// UpdatePostFields writes only the given fields of an existing post, with the
+// same version check as UpdatePost
+func (r *Repository) UpdatePostFields(ctx context.Context, post *models.Post, fields []string) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.UpdatePostFields", tracing.PostSlug(post.Slug))
+	defer span.End()
+
+	return r.updateVersioned(ctx, post, &post.Version, fields)
+}
+
+// DeletePost moves the post to the trash if its stored version still equals
+// post.Version. The row is soft-deleted under post.TrashSlug() so the slug
+// becomes available again.
+func (r *Repository) DeletePost(ctx context.Context, post *models.Post) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.DeletePost", tracing.PostSlug(post.Slug))
+	defer span.End()
+
+	result := r.db.WithContext(ctx).Model(post).Where("version = ?", post.Version).
+		Updates(map[string]interface{}{"slug": post.TrashSlug(), "deleted_at": time.Now()})
+	return result.RowsAffected, result.Error
+}
+
+// Post revision operations
+func (r *Repository) CreatePostRevision(ctx context.Context, revision *models.PostRevision) error {
+	ctx, span := tracing.Start(ctx, "Repository.CreatePostRevision")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Create(revision).Error
 }
 
-func (r *Repository) UpdatePost(post *models.Post) error {
-	return r.db.Save(post).Error
+func (r *Repository) CountPostRevisions(ctx context.Context, postID uint) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.CountPostRevisions")
+	defer span.End()
+
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.PostRevision{}).Where("post_id = ?", postID).Count(&count).Error
+	return count, err
+}
+
+// ListPostRevisions returns the revisions of a post, newest first, without
+// their content
+func (r *Repository) ListPostRevisions(ctx context.Context, postID uint) ([]models.PostRevision, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListPostRevisions")
+	defer span.End()
+
+	var revisions []models.PostRevision
+	err := r.db.WithContext(ctx).Omit("content").Preload("Editor").
+		Where("post_id = ?", postID).Order("id desc").Find(&revisions).Error
+	return revisions, err
 }
 
-func (r *Repository) DeletePost(slug string) error {
-	return r.db.Where("slug = ?", slug).Delete(&models.Post{}).Error
+func (r *Repository) FindPostRevision(ctx context.Context, postID, id uint) (*models.PostRevision, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindPostRevision")
+	defer span.End()
+
+	var revision models.PostRevision
+	err := r.db.WithContext(ctx).Preload("Editor").Where("post_id = ?", postID).First(&revision, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// PrunePostRevisions permanently deletes the revisions of a post beyond the
+// newest keep (when keep > 0) and those created before cutoff (when set). The
+// newest revision is always kept.
+func (r *Repository) PrunePostRevisions(ctx context.Context, postID uint, keep int, cutoff time.Time) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.PrunePostRevisions")
+	defer span.End()
+
+	var newest models.PostRevision
+	if err := r.db.WithContext(ctx).Where("post_id = ?", postID).Order("id desc").First(&newest).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	query := r.db.WithContext(ctx).Unscoped().Where("post_id = ? AND id <> ?", postID, newest.ID)
+	switch {
+	case keep > 0 && !cutoff.IsZero():
+		query = query.Where("id NOT IN (?) OR created_at < ?", r.newestRevisionIDs(ctx, postID, keep), cutoff)
+	case keep > 0:
+		query = query.Where("id NOT IN (?)", r.newestRevisionIDs(ctx, postID, keep))
+	case !cutoff.IsZero():
+		query = query.Where("created_at < ?", cutoff)
+	default:
+		return 0, nil
+	}
+
+	result := query.Delete(&models.PostRevision{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *Repository) newestRevisionIDs(ctx context.Context, postID uint, keep int) *gorm.DB {
+	return r.db.WithContext(ctx).Model(&models.PostRevision{}).Select("id").
+		Where("post_id = ?", postID).Order("id desc").Limit(keep)
 }
 
 // Project operations
-func (r *Repository) ListProjects() ([]models.Project, error) {
+func (r *Repository) ListProjects(ctx context.Context) ([]models.Project, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListProjects")
+	defer span.End()
+
 	var projects []models.Project
-	err := r.db.Order("priority desc").Find(&projects).Error
+	err := r.db.WithContext(ctx).Order("priority desc").Find(&projects).Error
 	return projects, err
 }
 
-func (r *Repository) FindProjectByID(id uint) (*models.Project, error) {
+func (r *Repository) FindProjectByID(ctx context.Context, id uint) (*models.Project, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindProjectByID", tracing.ProjectID(id))
+	defer span.End()
+
 	var project models.Project
-	err := r.db.First(&project, id).Error
+	err := r.db.WithContext(ctx).First(&project, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &project, nil
 }
 
-func (r *Repository) CreateProject(project *models.Project) error {
-	return r.db.Create(project).Error
+func (r *Repository) CreateProject(ctx context.Context, project *models.Project) error {
+	ctx, span := tracing.Start(ctx, "Repository.CreateProject")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Create(project).Error
 }
 
-func (r *Repository) UpdateProject(project *models.Project) error {
-	return r.db.Save(project).Error
+// UpdateProject writes every column of an existing project, with the same
+// version check as UpdatePost
+func (r *Repository) UpdateProject(ctx context.Context, project *models.Project) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.UpdateProject", tracing.ProjectID(project.ID))
+	defer span.End()
+
+	return r.updateVersioned(ctx, project, &project.Version, nil)
 }
 
-func (r *Repository) DeleteProject(id uint) error {
-	return r.db.Delete(&models.Project{}, id).Error
+// UpdateProjectFields writes only the given fields of an existing project
+func (r *Repository) UpdateProjectFields(ctx context.Context, project *models.Project, fields []string) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.UpdateProjectFields", tracing.ProjectID(project.ID))
+	defer span.End()
+
+	return r.updateVersioned(ctx, project, &project.Version, fields)
+}
+
+// DeleteProject deletes the project if its stored version still equals
+// project.Version
+func (r *Repository) DeleteProject(ctx context.Context, project *models.Project) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.DeleteProject", tracing.ProjectID(project.ID))
+	defer span.End()
+
+	result := r.db.WithContext(ctx).Where("version = ?", project.Version).Delete(project)
+	return result.RowsAffected, result.Error
+}
+
+// updateVersioned updates model (all columns except omit when fields is empty)
+// only where the stored version is still *version, and increments *version on
+// success
+func (r *Repository) updateVersioned(ctx context.Context, model interface{}, version *int, fields []string, omit ...string) (int64, error) {
+	expected := *version
+	*version = expected + 1
+
+	query := r.db.WithContext(ctx).Model(model).Where("version = ?", expected)
+	if len(fields) == 0 {
+		query = query.Select("*").Omit(append(omit, clause.Associations)...)
+	} else {
+		query = query.Select(append(append([]string{}, fields...), "Version"))
+	}
+
+	result := query.Updates(model)
+	if result.Error != nil || result.RowsAffected == 0 {
+		*version = expected
+	}
+	return result.RowsAffected, result.Error
 }
 
 // Activity operations
-func (r *Repository) ListActivities() ([]models.Activity, error) {
+func (r *Repository) ListActivities(ctx context.Context) ([]models.Activity, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListActivities")
+	defer span.End()
+
 	var activities []models.Activity
-	err := r.db.Preload("User").Order("created_at desc").Find(&activities).Error
+	err := r.db.WithContext(ctx).Preload("User").Order("created_at desc").Find(&activities).Error
 	return activities, err
 }
 
-func (r *Repository) CreateActivity(activity *models.Activity) error {
-	return r.db.Create(activity).Error
+func (r *Repository) CreateActivity(ctx context.Context, activity *models.Activity) error {
+	ctx, span := tracing.Start(ctx, "Repository.CreateActivity")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Create(activity).Error
 }
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"blog-backend/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Post{}, &models.Project{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return NewRepository(db)
+}
+
+func TestUpdatePostReportsRowsAffected(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	post := &models.Post{Title: "T", Content: "C", Excerpt: "E", Slug: "post"}
+	if err := repo.CreatePost(ctx, post); err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+
+	post.Title = "Updated"
+	if rows, err := repo.UpdatePost(ctx, post); err != nil || rows != 1 {
+		t.Fatalf("expected 1 row affected, got %d (err %v)", rows, err)
+	}
+
+	stale := *post
+	stale.Version--
+	if rows, err := repo.UpdatePost(ctx, &stale); err != nil || rows != 0 {
+		t.Fatalf("expected 0 rows affected for a stale version, got %d (err %v)", rows, err)
+	}
+	if stale.Version != post.Version-1 {
+		t.Errorf("version must not be bumped when nothing was written")
+	}
+
+	if _, err := repo.DeletePost(ctx, post); err != nil {
+		t.Fatalf("failed to delete post: %v", err)
+	}
+	if rows, err := repo.UpdatePost(ctx, post); err != nil || rows != 0 {
+		t.Fatalf("expected 0 rows affected for a deleted post, got %d (err %v)", rows, err)
+	}
+}
+
+func TestDeleteReportsRowsAffected(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	post := &models.Post{Title: "T", Content: "C", Excerpt: "E", Slug: "post"}
+	if err := repo.CreatePost(ctx, post); err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	project := &models.Project{Title: "T", Description: "D"}
+	if err := repo.CreateProject(ctx, project); err != nil {
+		t.Fatalf("failed to create project: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		delete func() (int64, error)
+		want   int64
+	}{
+		{"stale post", func() (int64, error) {
+			return repo.DeletePost(ctx, &models.Post{Model: post.Model, Version: post.Version + 1})
+		}, 0},
+		{"post", func() (int64, error) { return repo.DeletePost(ctx, post) }, 1},
+		{"post again", func() (int64, error) { return repo.DeletePost(ctx, post) }, 0},
+		{"missing post", func() (int64, error) {
+			return repo.DeletePost(ctx, &models.Post{Model: gorm.Model{ID: 404}, Version: 1})
+		}, 0},
+		{"project", func() (int64, error) { return repo.DeleteProject(ctx, project) }, 1},
+		{"missing project", func() (int64, error) {
+			return repo.DeleteProject(ctx, &models.Project{Model: gorm.Model{ID: 404}, Version: 1})
+		}, 0},
+	}
+
+	for _, tt := range tests {
+		rows, err := tt.delete()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if rows != tt.want {
+			t.Errorf("%s: expected %d rows affected, got %d", tt.name, tt.want, rows)
+		}
+	}
+}
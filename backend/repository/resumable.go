@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"blog-backend/models"
+	"blog-backend/tracing"
+)
+
+// Resumable upload operations
+func (r *Repository) CreateResumableUpload(ctx context.Context, upload *models.ResumableUpload) error {
+	ctx, span := tracing.Start(ctx, "Repository.CreateResumableUpload")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Create(upload).Error
+}
+
+func (r *Repository) FindResumableUpload(ctx context.Context, id string) (*models.ResumableUpload, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindResumableUpload")
+	defer span.End()
+
+	var upload models.ResumableUpload
+	if err := r.db.WithContext(ctx).First(&upload, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// AppendResumableUpload records a part of n bytes stored under key at the
+// upload's current offset. It reports 0 rows when another request moved the
+// offset first.
+func (r *Repository) AppendResumableUpload(ctx context.Context, upload *models.ResumableUpload, key string, n int64) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.AppendResumableUpload")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).Model(&models.ResumableUpload{ID: upload.ID}).
+		Where("received = ?", upload.Received).
+		Select("Received", "PartKeys", "MimeType", "ExpiresAt").
+		Updates(&models.ResumableUpload{
+			Received:  upload.Received + n,
+			PartKeys:  append(append([]string{}, upload.PartKeys...), key),
+			MimeType:  upload.MimeType,
+			ExpiresAt: upload.ExpiresAt,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// CompleteResumableUpload links a finished upload to its media item
+func (r *Repository) CompleteResumableUpload(ctx context.Context, upload *models.ResumableUpload, mediaID uint) error {
+	ctx, span := tracing.Start(ctx, "Repository.CompleteResumableUpload")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Model(upload).Update("media_id", mediaID).Error
+}
+
+// FailResumableUpload records why the file of an upload was refused. Its
+// parts are forgotten; the caller removes them.
+func (r *Repository) FailResumableUpload(ctx context.Context, upload *models.ResumableUpload, code, message string) error {
+	ctx, span := tracing.Start(ctx, "Repository.FailResumableUpload")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Model(&models.ResumableUpload{ID: upload.ID}).
+		Select("ErrorCode", "Error", "PartKeys").
+		Updates(&models.ResumableUpload{ErrorCode: code, Error: message, PartKeys: []string{}}).Error
+}
+
+func (r *Repository) DeleteResumableUpload(ctx context.Context, upload *models.ResumableUpload) error {
+	ctx, span := tracing.Start(ctx, "Repository.DeleteResumableUpload")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Delete(upload).Error
+}
+
+// ListExpiredResumableUploads returns uploads that expired before now
+func (r *Repository) ListExpiredResumableUploads(ctx context.Context, now time.Time) ([]models.ResumableUpload, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListExpiredResumableUploads")
+	defer span.End()
+
+	var uploads []models.ResumableUpload
+	err := r.db.WithContext(ctx).Where("expires_at < ?", now).Find(&uploads).Error
+	return uploads, err
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+
+	"blog-backend/models"
+	"blog-backend/tracing"
+
+	"gorm.io/gorm"
+)
+
+// Series operations
+func (r *Repository) ListSeries(ctx context.Context) ([]models.Series, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListSeries")
+	defer span.End()
+
+	var series []models.Series
+	err := r.db.WithContext(ctx).Order("title asc").Find(&series).Error
+	return series, err
+}
+
+func (r *Repository) FindSeriesBySlug(ctx context.Context, slug string) (*models.Series, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindSeriesBySlug")
+	defer span.End()
+
+	var series models.Series
+	err := r.db.WithContext(ctx).Where("slug = ?", slug).First(&series).Error
+	if err != nil {
+		return nil, err
+	}
+	return &series, nil
+}
+
+func (r *Repository) CreateSeries(ctx context.Context, series *models.Series) error {
+	ctx, span := tracing.Start(ctx, "Repository.CreateSeries")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Create(series).Error
+}
+
+// UpdateSeries writes the title and description of a series and gives its
+// posts, which show them, a new version
+func (r *Repository) UpdateSeries(ctx context.Context, series *models.Series) error {
+	ctx, span := tracing.Start(ctx, "Repository.UpdateSeries")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(series).Select("Title", "Description").Updates(series).Error; err != nil {
+			return err
+		}
+		members := tx.Model(&models.SeriesEntry{}).Select("post_id").Where("series_id = ?", series.ID)
+		return bumpSeriesVersions(tx, "id IN (?)", members)
+	})
+}
+
+// DeleteSeries permanently deletes a series and its entries. The posts
+// themselves are kept.
+func (r *Repository) DeleteSeries(ctx context.Context, series *models.Series) error {
+	ctx, span := tracing.Start(ctx, "Repository.DeleteSeries")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		members := tx.Model(&models.SeriesEntry{}).Select("post_id").Where("series_id = ?", series.ID)
+		if err := bumpSeriesVersions(tx, "id IN (?)", members); err != nil {
+			return err
+		}
+		if err := tx.Where("series_id = ?", series.ID).Delete(&models.SeriesEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(series).Error
+	})
+}
+
+// SetSeriesPosts replaces the posts of a series with postIDs, in order. Posts
+// that were part of another series are moved. Every post whose series
+// navigation changes gets a new version.
+func (r *Repository) SetSeriesPosts(ctx context.Context, seriesID uint, postIDs []uint) error {
+	ctx, span := tracing.Start(ctx, "Repository.SetSeriesPosts")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The old members of this series and of the series the posts are
+		// moved out of, plus the posts themselves
+		affected := tx.Model(&models.SeriesEntry{}).Select("post_id").
+			Where("series_id = ? OR series_id IN (?)", seriesID, tx.Model(&models.SeriesEntry{}).Select("series_id").Where("post_id IN ?", postIDs))
+		if err := bumpSeriesVersions(tx, "id IN (?) OR id IN ?", affected, postIDs); err != nil {
+			return err
+		}
+
+		if err := tx.Where("series_id = ?", seriesID).Delete(&models.SeriesEntry{}).Error; err != nil {
+			return err
+		}
+		if len(postIDs) == 0 {
+			return nil
+		}
+		if err := tx.Where("post_id IN ?", postIDs).Delete(&models.SeriesEntry{}).Error; err != nil {
+			return err
+		}
+
+		entries := make([]models.SeriesEntry, len(postIDs))
+		for i, id := range postIDs {
+			entries[i] = models.SeriesEntry{SeriesID: seriesID, PostID: id, Position: i + 1}
+		}
+		return tx.Omit("Post", "Series").Create(&entries).Error
+	})
+}
+
+// ListSeriesEntries returns the entries of a series in order, with the
+// listing fields of their posts in any workflow state. Trashed posts are left
+// out.
+func (r *Repository) ListSeriesEntries(ctx context.Context, seriesID uint) ([]models.SeriesEntry, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListSeriesEntries")
+	defer span.End()
+
+	return r.listSeriesEntries(ctx, seriesID, r.db)
+}
+
+// ListPublishedSeriesEntries is ListSeriesEntries limited to published posts
+func (r *Repository) ListPublishedSeriesEntries(ctx context.Context, seriesID uint) ([]models.SeriesEntry, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListPublishedSeriesEntries")
+	defer span.End()
+
+	return r.listSeriesEntries(ctx, seriesID, r.db.Where(&models.Post{Status: models.StatusPublished}))
+}
+
+// listSeriesEntries lists the entries of a series whose posts match posts
+func (r *Repository) listSeriesEntries(ctx context.Context, seriesID uint, posts *gorm.DB) ([]models.SeriesEntry, error) {
+	var entries []models.SeriesEntry
+	err := r.db.WithContext(ctx).
+		InnerJoins("Post", posts.Select("id", "title", "slug", "excerpt", "published")).
+		Where("series_id = ?", seriesID).Order("position asc").Find(&entries).Error
+	return entries, err
+}
+
+// BumpSeriesVersions gives the other posts in the series of postID a new
+// version, for changes to postID that alter their series navigation
+func (r *Repository) BumpSeriesVersions(ctx context.Context, postID uint) error {
+	ctx, span := tracing.Start(ctx, "Repository.BumpSeriesVersions")
+	defer span.End()
+
+	db := r.db.WithContext(ctx)
+	members := db.Model(&models.SeriesEntry{}).Select("post_id").
+		Where("post_id <> ? AND series_id IN (?)", postID, db.Model(&models.SeriesEntry{}).Select("series_id").Where("post_id = ?", postID))
+	return bumpSeriesVersions(db, "id IN (?)", members)
+}
+
+// bumpSeriesVersions increments the version of the posts matching the
+// condition, so cached copies of their series navigation are revalidated
+func bumpSeriesVersions(db *gorm.DB, query interface{}, args ...interface{}) error {
+	return db.Model(&models.Post{}).Where(query, args...).
+		UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
+
+// FindSeriesEntry returns the entry of a post with its series
+func (r *Repository) FindSeriesEntry(ctx context.Context, postID uint) (*models.SeriesEntry, error) {
+	ctx, span := tracing.Start(ctx, "Repository.FindSeriesEntry")
+	defer span.End()
+
+	var entry models.SeriesEntry
+	err := r.db.WithContext(ctx).Joins("Series").Where("post_id = ?", postID).First(&entry).Error
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
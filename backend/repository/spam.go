@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+
+	"blog-backend/models"
+	"blog-backend/spam"
+	"blog-backend/tracing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TokenCounts implements spam.TokenStore
+func (r *Repository) TokenCounts(ctx context.Context, tokens []string) (map[string]spam.Counts, spam.Counts, error) {
+	ctx, span := tracing.Start(ctx, "Repository.TokenCounts")
+	defer span.End()
+
+	var rows []models.SpamToken
+	lookup := append([]string{models.SpamTotalsToken}, tokens...)
+	if err := r.db.WithContext(ctx).Where("token IN ?", lookup).Find(&rows).Error; err != nil {
+		return nil, spam.Counts{}, err
+	}
+
+	counts := make(map[string]spam.Counts, len(rows))
+	var docs spam.Counts
+	for _, row := range rows {
+		c := spam.Counts{Spam: row.Spam, Ham: row.Ham}
+		if row.Token == models.SpamTotalsToken {
+			docs = c
+			continue
+		}
+		counts[row.Token] = c
+	}
+	return counts, docs, nil
+}
+
+// AddTokenCounts implements spam.TokenStore
+func (r *Repository) AddTokenCounts(ctx context.Context, tokens []string, delta spam.Counts) error {
+	ctx, span := tracing.Start(ctx, "Repository.AddTokenCounts")
+	defer span.End()
+
+	rows := make([]models.SpamToken, 0, len(tokens)+1)
+	for _, token := range append([]string{models.SpamTotalsToken}, tokens...) {
+		if len(token) > 64 {
+			continue
+		}
+		rows = append(rows, models.SpamToken{Token: token, Spam: max(delta.Spam, 0), Ham: max(delta.Ham, 0)})
+	}
+
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "token"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"spam": gorm.Expr("spam_tokens.spam + ?", delta.Spam),
+			"ham":  gorm.Expr("spam_tokens.ham + ?", delta.Ham),
+		}),
+	}).CreateInBatches(rows, 200).Error
+}
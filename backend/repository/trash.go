@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"blog-backend/models"
+	"blog-backend/tracing"
+
+	"gorm.io/gorm"
+)
+
+// Trash operations
+func (r *Repository) ListTrashedPosts(ctx context.Context) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListTrashedPosts")
+	defer span.End()
+
+	var posts []models.Post
+	err := r.trashed(ctx).Omit("content").Find(&posts).Error
+	return posts, err
+}
+
+func (r *Repository) ListTrashedProjects(ctx context.Context) ([]models.Project, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListTrashedProjects")
+	defer span.End()
+
+	var projects []models.Project
+	err := r.trashed(ctx).Find(&projects).Error
+	return projects, err
+}
+
+func (r *Repository) ListTrashedActivities(ctx context.Context) ([]models.Activity, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListTrashedActivities")
+	defer span.End()
+
+	var activities []models.Activity
+	err := r.trashed(ctx).Find(&activities).Error
+	return activities, err
+}
+
+// FindTrashed loads the soft-deleted record with the given ID into model
+func (r *Repository) FindTrashed(ctx context.Context, model interface{}, id uint) error {
+	ctx, span := tracing.Start(ctx, "Repository.FindTrashed")
+	defer span.End()
+
+	return r.trashed(ctx).First(model, id).Error
+}
+
+// SlugTaken reports whether a post other than exceptID, live or trashed,
+// holds slug
+func (r *Repository) SlugTaken(ctx context.Context, slug string, exceptID uint) (bool, error) {
+	ctx, span := tracing.Start(ctx, "Repository.SlugTaken")
+	defer span.End()
+
+	var count int64
+	err := r.db.WithContext(ctx).Unscoped().Model(&models.Post{}).
+		Where("slug = ? AND id <> ?", slug, exceptID).Count(&count).Error
+	return count > 0, err
+}
+
+// RestorePost takes a trashed post out of the trash under the given slug
+func (r *Repository) RestorePost(ctx context.Context, post *models.Post, slug string) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.RestorePost")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).Unscoped().Model(post).Where("deleted_at IS NOT NULL").
+		Updates(map[string]interface{}{"slug": slug, "deleted_at": nil})
+	return result.RowsAffected, result.Error
+}
+
+// Restore takes a trashed project or activity out of the trash
+func (r *Repository) Restore(ctx context.Context, model interface{}) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.Restore")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).Unscoped().Model(model).Where("deleted_at IS NOT NULL").
+		Update("deleted_at", nil)
+	return result.RowsAffected, result.Error
+}
+
+// Purge permanently deletes a trashed record. Purging a post also removes its
+// revisions, workflow history, preview links, series entry, comments and
+// media references; purging a project its media references.
+func (r *Repository) Purge(ctx context.Context, model interface{}) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.Purge")
+	defer span.End()
+
+	var rows int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		switch m := model.(type) {
+		case *models.Post:
+			if err := deletePostDependents(tx, m.ID); err != nil {
+				return err
+			}
+		case *models.Project:
+			if err := deleteMediaReferences(tx, models.MediaOwnerProject, m.ID); err != nil {
+				return err
+			}
+		}
+		result := tx.Unscoped().Where("deleted_at IS NOT NULL").Delete(model)
+		rows = result.RowsAffected
+		return result.Error
+	})
+	return rows, err
+}
+
+// PurgeTrash permanently deletes every post, project and activity that was
+// moved to the trash before cutoff, returning the number of records removed
+func (r *Repository) PurgeTrash(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.PurgeTrash")
+	defer span.End()
+
+	var rows int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		expired := tx.Unscoped().Model(&models.Post{}).Select("id").Where("deleted_at < ?", cutoff)
+		if err := deletePostDependents(tx, expired); err != nil {
+			return err
+		}
+		expiredProjects := tx.Unscoped().Model(&models.Project{}).Select("id").Where("deleted_at < ?", cutoff)
+		if err := deleteMediaReferences(tx, models.MediaOwnerProject, expiredProjects); err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{&models.Post{}, &models.Project{}, &models.Activity{}} {
+			result := tx.Unscoped().Where("deleted_at < ?", cutoff).Delete(model)
+			if result.Error != nil {
+				return result.Error
+			}
+			rows += result.RowsAffected
+		}
+		return nil
+	})
+	return rows, err
+}
+
+// deletePostDependents permanently deletes the rows that belong to the posts
+// matched by postIDs, a single ID or a subquery
+func deletePostDependents(tx *gorm.DB, postIDs interface{}) error {
+	dependents := []interface{}{
+		&models.PostRevision{}, &models.PostTransition{}, &models.PreviewLink{},
+		&models.SeriesEntry{}, &models.RelatedPost{}, &models.Comment{},
+	}
+	for _, model := range dependents {
+		if err := tx.Unscoped().Where("post_id IN (?)", postIDs).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return deleteMediaReferences(tx, models.MediaOwnerPost, postIDs)
+}
+
+// deleteMediaReferences removes the media references of the owners matched
+// by ownerIDs, a single ID or a subquery
+func deleteMediaReferences(tx *gorm.DB, ownerType string, ownerIDs interface{}) error {
+	return tx.Where("owner_type = ? AND owner_id IN (?)", ownerType, ownerIDs).Delete(&models.MediaReference{}).Error
+}
+
+func (r *Repository) trashed(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at desc")
+}
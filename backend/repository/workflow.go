@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"blog-backend/models"
+	"blog-backend/tracing"
+)
+
+// Workflow operations
+func (r *Repository) CreatePostTransition(ctx context.Context, transition *models.PostTransition) error {
+	ctx, span := tracing.Start(ctx, "Repository.CreatePostTransition")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Create(transition).Error
+}
+
+// ListPostTransitions returns the workflow history of a post, newest first
+func (r *Repository) ListPostTransitions(ctx context.Context, postID uint) ([]models.PostTransition, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListPostTransitions")
+	defer span.End()
+
+	var transitions []models.PostTransition
+	err := r.db.WithContext(ctx).Preload("User").Where("post_id = ?", postID).Order("id desc").Find(&transitions).Error
+	return transitions, err
+}
+
+// LatestPostTransition returns the most recent move of a post into status
+func (r *Repository) LatestPostTransition(ctx context.Context, postID uint, status string) (*models.PostTransition, error) {
+	ctx, span := tracing.Start(ctx, "Repository.LatestPostTransition")
+	defer span.End()
+
+	var transition models.PostTransition
+	err := r.db.WithContext(ctx).Where("post_id = ? AND to_status = ?", postID, status).Order("id desc").First(&transition).Error
+	if err != nil {
+		return nil, err
+	}
+	return &transition, nil
+}
+
+// ListPostsByStatus returns the posts in a workflow state, longest waiting
+// first
+func (r *Repository) ListPostsByStatus(ctx context.Context, status string) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListPostsByStatus")
+	defer span.End()
+
+	var posts []models.Post
+	err := r.db.WithContext(ctx).Preload("Author").Where("status = ?", status).Order("updated_at asc").Find(&posts).Error
+	return posts, err
+}
+
+// ListDuePosts returns scheduled posts whose publication time has passed
+func (r *Repository) ListDuePosts(ctx context.Context, now time.Time) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ListDuePosts")
+	defer span.End()
+
+	var posts []models.Post
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND scheduled_at <= ?", models.StatusScheduled, now).
+		Order("scheduled_at asc").Find(&posts).Error
+	return posts, err
+}
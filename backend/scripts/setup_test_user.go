@@ -1,6 +1,7 @@
 package main
 
 import (
+	"blog-backend/config"
 	"blog-backend/models"
 	"fmt"
 	"log"
@@ -33,8 +34,7 @@ func main() {
 	}
 
 	// Auto migrate the schema
-	err = db.AutoMigrate(&models.User{}, &models.Post{}, &models.Project{}, &models.Activity{})
-	if err != nil {
+	if err := config.Migrate(db); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
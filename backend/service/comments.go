@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"blog-backend/logging"
+	"blog-backend/models"
+	"blog-backend/spam"
+	"blog-backend/tracing"
+	"blog-backend/utils"
+)
+
+// maxCommentDepth limits how deeply replies nest; 0 is a top-level comment
+const maxCommentDepth = 4
+
+// Moderation listing page sizes
+const (
+	defaultCommentPageSize = 50
+	maxCommentPageSize     = 200
+)
+
+// CommentInput is a new comment. Guests must give a name and email; for
+// signed-in users both are taken from their account. Website is a honeypot
+// the form hides from people and StartedAt the Unix time in milliseconds the
+// form was shown; both feed the spam filter. IP and UserAgent are set by the
+// handler.
+type CommentInput struct {
+	Body        string `json:"body" binding:"required,max=5000"`
+	ParentID    *uint  `json:"parentId"`
+	AuthorName  string `json:"authorName" binding:"max=100"`
+	AuthorEmail string `json:"authorEmail" binding:"omitempty,email,max=254"`
+	Website     string `json:"website"`
+	StartedAt   int64  `json:"startedAt"`
+	IP          string `json:"-"`
+	UserAgent   string `json:"-"`
+}
+
+// CommentPage is one page of the moderation listing
+type CommentPage struct {
+	Comments []models.Comment `json:"comments"`
+	Total    int64            `json:"total"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"pageSize"`
+}
+
+// ListPostComments returns the approved comments of a post as a thread.
+// Deleted comments are kept as empty placeholders while they have visible
+// replies.
+func (s *Service) ListPostComments(ctx context.Context, slug string) ([]*models.Comment, error) {
+	ctx, span := tracing.Start(ctx, "Service.ListPostComments", tracing.PostSlug(slug))
+	defer span.End()
+
+	post, err := s.repo.FindPublishedPostBySlug(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "post"))
+	}
+
+	comments, err := s.repo.ListPostComments(ctx, post.ID, []string{models.CommentApproved, models.CommentDeleted})
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	for i := range comments {
+		renderComment(ctx, &comments[i])
+		hideSpamDetails(&comments[i])
+	}
+	return buildThread(comments), nil
+}
+
+// CreateComment adds a comment to a published post. Comments by signed-in
+// users are approved straight away; guest comments wait for moderation.
+func (s *Service) CreateComment(ctx context.Context, slug string, input CommentInput) (*models.Comment, error) {
+	ctx, span := tracing.Start(ctx, "Service.CreateComment", tracing.PostSlug(slug))
+	defer span.End()
+
+	post, err := s.repo.FindPublishedPostBySlug(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "post"))
+	}
+
+	comment := &models.Comment{
+		PostID:    post.ID,
+		Body:      strings.TrimSpace(input.Body),
+		Status:    models.CommentPending,
+		IP:        input.IP,
+		UserAgent: input.UserAgent,
+	}
+	if comment.Body == "" {
+		return nil, tracing.RecordError(span, Validation("validation_failed", "The comment is empty",
+			map[string]string{"body": "is required"}))
+	}
+
+	if UserIDFromContext(ctx) != 0 {
+		user, err := s.currentUser(ctx)
+		if err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+		comment.UserID = &user.ID
+		comment.AuthorName = user.Name
+		comment.AuthorEmail = user.Email
+		comment.Status = models.CommentApproved
+	} else {
+		comment.AuthorName = strings.TrimSpace(input.AuthorName)
+		comment.AuthorEmail = strings.TrimSpace(input.AuthorEmail)
+		fields := map[string]string{}
+		if comment.AuthorName == "" {
+			fields["authorName"] = "is required"
+		}
+		if comment.AuthorEmail == "" {
+			fields["authorEmail"] = "is required"
+		}
+		if len(fields) > 0 {
+			return nil, tracing.RecordError(span, Validation("validation_failed", "Guests must give a name and email", fields))
+		}
+
+		verdict, isSpam := s.scoreSubmission(ctx, &spam.Submission{
+			Kind:      "comment",
+			IP:        input.IP,
+			Name:      comment.AuthorName,
+			Email:     comment.AuthorEmail,
+			Body:      comment.Body,
+			Honeypot:  input.Website,
+			StartedAt: formStartedAt(input.StartedAt),
+		})
+		comment.SpamScore = verdict.Score
+		comment.SpamReasons = verdict.Reasons
+		if isSpam {
+			comment.Status = models.CommentSpam
+		}
+	}
+
+	if input.ParentID != nil {
+		parent, err := s.repo.FindComment(ctx, *input.ParentID)
+		if err != nil || parent.PostID != post.ID || parent.Status != models.CommentApproved {
+			return nil, tracing.RecordError(span, Validation("invalid_parent", "The comment being replied to does not exist",
+				map[string]string{"parentId": "must be an approved comment on this post"}))
+		}
+		if parent.Depth >= maxCommentDepth {
+			return nil, tracing.RecordError(span, Validation("thread_too_deep", "Replies cannot be nested any deeper",
+				map[string]string{"parentId": "is nested too deeply"}))
+		}
+		comment.ParentID = &parent.ID
+		comment.Depth = parent.Depth + 1
+	}
+
+	if err := s.repo.CreateComment(ctx, comment); err != nil {
+		return nil, tracing.RecordError(span, translate(err, "comment"))
+	}
+	if comment.Status == models.CommentApproved {
+		if err := s.repo.RecountComments(ctx, post.ID); err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+	}
+
+	renderComment(ctx, comment)
+	hideSpamDetails(comment)
+	return comment, nil
+}
+
+// ListCommentsForModeration returns a page of comments in the given state
+// (all states when empty), newest first. Only editors may moderate.
+func (s *Service) ListCommentsForModeration(ctx context.Context, status string, page, pageSize int) (*CommentPage, error) {
+	ctx, span := tracing.Start(ctx, "Service.ListCommentsForModeration")
+	defer span.End()
+
+	if err := s.requireEditor(ctx, "moderation_forbidden", "Only editors may moderate comments"); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	if status != "" && !validCommentStatus(status) {
+		return nil, tracing.RecordError(span, invalidCommentStatus())
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = defaultCommentPageSize
+	}
+	if pageSize > maxCommentPageSize {
+		pageSize = maxCommentPageSize
+	}
+
+	comments, total, err := s.repo.ListComments(ctx, status, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	for i := range comments {
+		renderComment(ctx, &comments[i])
+	}
+	return &CommentPage{Comments: comments, Total: total, Page: page, PageSize: pageSize}, nil
+}
+
+// ModerateComments moves the given comments to status and refreshes the
+// comment counts of their posts. It returns the number of comments changed.
+func (s *Service) ModerateComments(ctx context.Context, ids []uint, status string) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Service.ModerateComments")
+	defer span.End()
+
+	if err := s.requireEditor(ctx, "moderation_forbidden", "Only editors may moderate comments"); err != nil {
+		return 0, tracing.RecordError(span, err)
+	}
+	if !validCommentStatus(status) {
+		return 0, tracing.RecordError(span, invalidCommentStatus())
+	}
+
+	comments, err := s.repo.FindComments(ctx, ids)
+	if err != nil {
+		return 0, tracing.RecordError(span, err)
+	}
+	rows, err := s.repo.SetCommentStatus(ctx, ids, status)
+	if err != nil {
+		return 0, tracing.RecordError(span, err)
+	}
+	span.SetAttributes(tracing.RowsAffected(rows))
+
+	// Approving and marking as spam are the decisions the classifier learns
+	// from; a changed decision replaces the earlier one
+	label := spam.Unlabeled
+	switch status {
+	case models.CommentApproved:
+		label = spam.Ham
+	case models.CommentSpam:
+		label = spam.Spam
+	}
+	if label == spam.Unlabeled {
+		return rows, nil
+	}
+	for i := range comments {
+		comment := &comments[i]
+		previous := spam.Label(comment.SpamTrainedAs)
+		if previous == label {
+			continue
+		}
+		if err := s.learnSpam(ctx, commentSubmission(comment), label, previous); err != nil {
+			return rows, tracing.RecordError(span, err)
+		}
+		if err := s.repo.SetCommentTrainedAs(ctx, comment.ID, string(label)); err != nil {
+			return rows, tracing.RecordError(span, err)
+		}
+	}
+	return rows, nil
+}
+
+func commentSubmission(comment *models.Comment) *spam.Submission {
+	return &spam.Submission{
+		Kind:  "comment",
+		IP:    comment.IP,
+		Name:  comment.AuthorName,
+		Email: comment.AuthorEmail,
+		Body:  comment.Body,
+	}
+}
+
+// hideSpamDetails removes the spam score from comments shown to the public
+func hideSpamDetails(comment *models.Comment) {
+	comment.SpamScore = 0
+	comment.SpamReasons = nil
+}
+
+func validCommentStatus(status string) bool {
+	switch status {
+	case models.CommentPending, models.CommentApproved, models.CommentSpam, models.CommentDeleted:
+		return true
+	}
+	return false
+}
+
+func invalidCommentStatus() *Error {
+	return Validation("invalid_comment_status", "Unknown comment status",
+		map[string]string{"status": "must be pending, approved, spam or deleted"})
+}
+
+// renderComment fills BodyHTML from the Markdown body, blanking deleted
+// comments
+func renderComment(ctx context.Context, comment *models.Comment) {
+	if comment.Status == models.CommentDeleted {
+		comment.Body = ""
+		comment.AuthorName = ""
+		return
+	}
+
+	html, err := utils.RenderMarkdown(comment.Body)
+	if err != nil {
+		logging.Printf(ctx, "Failed to render comment %d: %v", comment.ID, err)
+		return
+	}
+	comment.BodyHTML = html
+}
+
+// buildThread nests comments (ordered oldest first) under their parents.
+// Replies whose parent is not visible are dropped, as are deleted comments
+// left without replies.
+func buildThread(comments []models.Comment) []*models.Comment {
+	byID := make(map[uint]*models.Comment, len(comments))
+	var roots []*models.Comment
+	for i := range comments {
+		comment := &comments[i]
+		byID[comment.ID] = comment
+		if comment.ParentID == nil {
+			roots = append(roots, comment)
+		} else if parent, ok := byID[*comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		}
+	}
+	return pruneDeleted(roots)
+}
+
+func pruneDeleted(comments []*models.Comment) []*models.Comment {
+	kept := make([]*models.Comment, 0, len(comments))
+	for _, comment := range comments {
+		comment.Replies = pruneDeleted(comment.Replies)
+		if comment.Status == models.CommentDeleted && len(comment.Replies) == 0 {
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"blog-backend/models"
+	"blog-backend/spam"
+)
+
+func TestCommentThreadAndCounts(t *testing.T) {
+	svc, db := newTestService(t)
+	editor := createUser(t, db, "editor@example.com", models.RoleEditor)
+	post := createPost(t, db, "discussed")
+	publishPost(t, db, post)
+	editorCtx := WithUserID(context.Background(), editor.ID)
+	guest := context.Background()
+
+	if _, err := svc.CreateComment(guest, "discussed", CommentInput{Body: "Hi"}); !IsKind(err, KindValidation) {
+		t.Errorf("expected guests without name and email to be rejected, got %v", err)
+	}
+
+	pending, err := svc.CreateComment(guest, "discussed", CommentInput{Body: "**Nice** <script>x</script>", AuthorName: "Ann", AuthorEmail: "ann@example.com"})
+	if err != nil {
+		t.Fatalf("CreateComment returned error: %v", err)
+	}
+	if pending.Status != models.CommentPending {
+		t.Errorf("expected guest comment to be pending, got %s", pending.Status)
+	}
+	if !strings.Contains(pending.BodyHTML, "<strong>Nice</strong>") || strings.Contains(pending.BodyHTML, "<script>") {
+		t.Errorf("expected sanitized Markdown, got %q", pending.BodyHTML)
+	}
+
+	root, err := svc.CreateComment(editorCtx, "discussed", CommentInput{Body: "Thanks for reading"})
+	if err != nil {
+		t.Fatalf("CreateComment returned error: %v", err)
+	}
+	if root.Status != models.CommentApproved || root.AuthorName != editor.Name {
+		t.Errorf("expected signed-in comment to be approved under the account name, got %+v", root)
+	}
+	if _, err := svc.CreateComment(guest, "discussed", CommentInput{Body: "Reply", ParentID: &pending.ID, AuthorName: "Bo", AuthorEmail: "bo@example.com"}); !IsKind(err, KindValidation) {
+		t.Errorf("expected replies to pending comments to be rejected, got %v", err)
+	}
+	reply, err := svc.CreateComment(guest, "discussed", CommentInput{Body: "Reply", ParentID: &root.ID, AuthorName: "Bo", AuthorEmail: "bo@example.com"})
+	if err != nil {
+		t.Fatalf("CreateComment returned error: %v", err)
+	}
+
+	if n, err := svc.ModerateComments(editorCtx, []uint{pending.ID, reply.ID}, models.CommentApproved); err != nil || n != 2 {
+		t.Fatalf("expected two comments approved, got %d (err %v)", n, err)
+	}
+	if _, err := svc.ModerateComments(guest, []uint{reply.ID}, models.CommentSpam); !IsKind(err, KindUnauthorized) {
+		t.Errorf("expected anonymous moderation to be rejected, got %v", err)
+	}
+
+	stored, _ := svc.GetPost(guest, "discussed")
+	if stored.CommentCount != 3 {
+		t.Errorf("expected 3 approved comments counted, got %d", stored.CommentCount)
+	}
+
+	// Deleting a comment with replies leaves a placeholder
+	if _, err := svc.ModerateComments(editorCtx, []uint{root.ID}, models.CommentDeleted); err != nil {
+		t.Fatalf("ModerateComments returned error: %v", err)
+	}
+	thread, err := svc.ListPostComments(guest, "discussed")
+	if err != nil {
+		t.Fatalf("ListPostComments returned error: %v", err)
+	}
+	if len(thread) != 2 {
+		t.Fatalf("expected two top-level comments, got %d", len(thread))
+	}
+	placeholder := thread[1]
+	if placeholder.Body != "" || len(placeholder.Replies) != 1 || placeholder.Replies[0].ID != reply.ID {
+		t.Errorf("expected a blank placeholder holding the reply, got %+v", placeholder)
+	}
+
+	counted := stored.ETag()
+	stored, _ = svc.GetPost(guest, "discussed")
+	if stored.CommentCount != 2 {
+		t.Errorf("expected 2 approved comments counted after deletion, got %d", stored.CommentCount)
+	}
+	if stored.ETag() == counted {
+		t.Errorf("expected a new ETag once the comment count changed")
+	}
+	if _, err := svc.CreateComment(guest, "discussed", CommentInput{Body: "Later", AuthorName: "Cy", AuthorEmail: "cy@example.com"}); err != nil {
+		t.Fatalf("CreateComment returned error: %v", err)
+	}
+	if unchanged, _ := svc.GetPost(guest, "discussed"); unchanged.ETag() != stored.ETag() {
+		t.Errorf("expected a pending comment to keep the ETag, got %s and %s", unchanged.ETag(), stored.ETag())
+	}
+}
+
+func TestCommentsClosedOnDrafts(t *testing.T) {
+	svc, db := newTestService(t)
+	createPost(t, db, "draft")
+
+	_, err := svc.CreateComment(context.Background(), "draft", CommentInput{Body: "Hi", AuthorName: "Ann", AuthorEmail: "ann@example.com"})
+	if !IsKind(err, KindNotFound) {
+		t.Errorf("expected drafts to be hidden from commenters, got %v", err)
+	}
+}
+
+func TestCommentSpamFilter(t *testing.T) {
+	svc, db := newTestService(t)
+	editor := createUser(t, db, "editor@example.com", models.RoleEditor)
+	post := createPost(t, db, "discussed")
+	publishPost(t, db, post)
+	editorCtx := WithUserID(context.Background(), editor.ID)
+	guest := context.Background()
+
+	WithSpamFilter(spam.NewPipeline(spam.Honeypot(), spam.NewBayes(svc.repo, 1)), 1)(svc)
+
+	caught, err := svc.CreateComment(guest, "discussed", CommentInput{Body: "Cheap pills", AuthorName: "Bot", AuthorEmail: "bot@example.com", Website: "http://pills.example"})
+	if err != nil {
+		t.Fatalf("CreateComment returned error: %v", err)
+	}
+	if caught.SpamScore != 0 || caught.SpamReasons != nil {
+		t.Errorf("expected spam details to be hidden from the commenter, got %v", caught.SpamReasons)
+	}
+	var stored models.Comment
+	db.First(&stored, caught.ID)
+	if stored.Status != models.CommentSpam || stored.SpamScore < 1 || len(stored.SpamReasons) != 1 {
+		t.Errorf("expected the honeypot comment to be filed as spam with its reason, got %s %.2f %v", stored.Status, stored.SpamScore, stored.SpamReasons)
+	}
+
+	ham, err := svc.CreateComment(guest, "discussed", CommentInput{Body: "Lovely write-up", AuthorName: "Ann", AuthorEmail: "ann@example.com"})
+	if err != nil {
+		t.Fatalf("CreateComment returned error: %v", err)
+	}
+	if ham.Status != models.CommentPending {
+		t.Errorf("expected a clean comment to await moderation, got %s", ham.Status)
+	}
+
+	// Moderation trains the classifier, and a changed decision replaces the old one
+	for _, step := range []struct {
+		id     uint
+		status string
+	}{{caught.ID, models.CommentSpam}, {ham.ID, models.CommentApproved}, {ham.ID, models.CommentSpam}} {
+		if _, err := svc.ModerateComments(editorCtx, []uint{step.id}, step.status); err != nil {
+			t.Fatalf("ModerateComments returned error: %v", err)
+		}
+	}
+	_, docs, err := svc.repo.TokenCounts(guest, []string{"lovely"})
+	if err != nil {
+		t.Fatalf("TokenCounts returned error: %v", err)
+	}
+	if docs != (spam.Counts{Spam: 2}) {
+		t.Errorf("expected two spam and no ham trained, got %+v", docs)
+	}
+	var relabelled models.Comment
+	db.First(&relabelled, ham.ID)
+	if relabelled.SpamTrainedAs != string(spam.Spam) {
+		t.Errorf("expected the comment to be recorded as trained as spam, got %q", relabelled.SpamTrainedAs)
+	}
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"blog-backend/logging"
+	"blog-backend/mail"
+	"blog-backend/models"
+	"blog-backend/repository"
+	"blog-backend/spam"
+	"blog-backend/tracing"
+)
+
+// contactNotifyTimeout bounds how long a notification email may take
+const contactNotifyTimeout = 30 * time.Second
+
+// Inbox page sizes
+const (
+	defaultContactPageSize = 25
+	maxContactPageSize     = 100
+)
+
+// ContactInput is a message from the public contact form. Website and
+// StartedAt feed the spam filter like in CommentInput; IP and UserAgent are
+// set by the handler.
+type ContactInput struct {
+	Name      string `json:"name" binding:"required,max=100"`
+	Email     string `json:"email" binding:"required,email,max=254"`
+	Company   string `json:"company" binding:"max=100"`
+	Subject   string `json:"subject" binding:"required,max=200"`
+	Body      string `json:"body" binding:"required,min=10,max=10000"`
+	Website   string `json:"website"`
+	StartedAt int64  `json:"startedAt"`
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
+}
+
+// ContactUpdate changes the inbox state of a message. Nil fields are left
+// alone.
+type ContactUpdate struct {
+	Read     *bool `json:"read"`
+	Archived *bool `json:"archived"`
+	Spam     *bool `json:"spam"`
+}
+
+// ContactPage is one page of an inbox folder
+type ContactPage struct {
+	Messages []models.ContactMessage `json:"messages"`
+	Total    int64                   `json:"total"`
+	Unread   int64                   `json:"unread"`
+	Page     int                     `json:"page"`
+	PageSize int                     `json:"pageSize"`
+}
+
+// WithMailer sends a notification to notify for every contact message that
+// is not spam
+func WithMailer(mailer mail.Mailer, notify []string) Option {
+	return func(s *Service) {
+		s.mailer = mailer
+		s.contactNotify = notify
+	}
+}
+
+// SubmitContactMessage stores a message from the contact form and notifies
+// the site owner unless the spam filter catches it
+func (s *Service) SubmitContactMessage(ctx context.Context, input ContactInput) (*models.ContactMessage, error) {
+	ctx, span := tracing.Start(ctx, "Service.SubmitContactMessage")
+	defer span.End()
+
+	msg := &models.ContactMessage{
+		Name:      strings.TrimSpace(input.Name),
+		Email:     strings.TrimSpace(input.Email),
+		Company:   strings.TrimSpace(input.Company),
+		Subject:   strings.TrimSpace(input.Subject),
+		Body:      strings.TrimSpace(input.Body),
+		IP:        input.IP,
+		UserAgent: input.UserAgent,
+	}
+	fields := map[string]string{}
+	if msg.Name == "" {
+		fields["name"] = "is required"
+	}
+	if msg.Subject == "" {
+		fields["subject"] = "is required"
+	}
+	if msg.Body == "" {
+		fields["body"] = "is required"
+	}
+	if len(fields) > 0 {
+		return nil, tracing.RecordError(span, Validation("validation_failed", "The request has invalid fields", fields))
+	}
+
+	verdict, isSpam := s.scoreSubmission(ctx, &spam.Submission{
+		Kind:      "contact",
+		IP:        input.IP,
+		Name:      msg.Name,
+		Email:     msg.Email,
+		Body:      msg.Subject + "\n" + msg.Body,
+		Honeypot:  input.Website,
+		StartedAt: formStartedAt(input.StartedAt),
+	})
+	msg.SpamScore = verdict.Score
+	msg.SpamReasons = verdict.Reasons
+	msg.Spam = isSpam
+
+	if err := s.repo.CreateContactMessage(ctx, msg); err != nil {
+		return nil, tracing.RecordError(span, translate(err, "contact_message"))
+	}
+	if !msg.Spam {
+		s.notifyContact(ctx, msg)
+	}
+	return msg, nil
+}
+
+// notifyContact emails the site owner about msg in the background. Failures
+// are logged; the message is already in the inbox.
+func (s *Service) notifyContact(ctx context.Context, msg *models.ContactMessage) {
+	if s.mailer == nil || len(s.contactNotify) == 0 {
+		return
+	}
+
+	from := msg.Name
+	if msg.Company != "" {
+		from += " (" + msg.Company + ")"
+	}
+	email := mail.Message{
+		To:      s.contactNotify,
+		ReplyTo: msg.Email,
+		Subject: "Contact: " + msg.Subject,
+		Body:    fmt.Sprintf("From: %s <%s>\n\n%s\n", from, msg.Email, msg.Body),
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	s.background("contact-notification", func(context.Context) {
+		// Shutdown waits for a send in progress instead of cancelling it
+		ctx, cancel := context.WithTimeout(ctx, contactNotifyTimeout)
+		defer cancel()
+		if err := s.mailer.Send(ctx, email); err != nil {
+			logging.Printf(ctx, "Failed to send notification for contact message %d: %v", msg.ID, err)
+		}
+	})
+}
+
+// ListContactMessages returns a page of an inbox folder: inbox (the
+// default), unread, archived, spam or all. Only editors may read the inbox.
+func (s *Service) ListContactMessages(ctx context.Context, folder string, page, pageSize int) (*ContactPage, error) {
+	ctx, span := tracing.Start(ctx, "Service.ListContactMessages")
+	defer span.End()
+
+	if err := s.requireEditor(ctx, "contact_forbidden", "Only editors may read contact messages"); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	switch folder {
+	case "":
+		folder = repository.ContactInbox
+	case repository.ContactInbox, repository.ContactUnread, repository.ContactArchived, repository.ContactSpam, repository.ContactAll:
+	default:
+		return nil, tracing.RecordError(span, Validation("invalid_folder", "Folder must be one of inbox, unread, archived, spam or all", nil))
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = defaultContactPageSize
+	}
+	if pageSize > maxContactPageSize {
+		pageSize = maxContactPageSize
+	}
+
+	messages, total, err := s.repo.ListContactMessages(ctx, folder, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	unread, err := s.repo.CountUnreadContactMessages(ctx)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return &ContactPage{Messages: messages, Total: total, Unread: unread, Page: page, PageSize: pageSize}, nil
+}
+
+// GetContactMessage returns a message and marks it read
+func (s *Service) GetContactMessage(ctx context.Context, id uint) (*models.ContactMessage, error) {
+	ctx, span := tracing.Start(ctx, "Service.GetContactMessage")
+	defer span.End()
+
+	msg, err := s.findContactMessage(ctx, id)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	if msg.ReadAt == nil {
+		now := time.Now()
+		msg.ReadAt = &now
+		if err := s.repo.UpdateContactMessage(ctx, msg, "ReadAt"); err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+	}
+	return msg, nil
+}
+
+// UpdateContactMessage changes the read, archived and spam state of a
+// message. Marking a message as spam or not spam trains the spam filter.
+func (s *Service) UpdateContactMessage(ctx context.Context, id uint, update ContactUpdate) (*models.ContactMessage, error) {
+	ctx, span := tracing.Start(ctx, "Service.UpdateContactMessage")
+	defer span.End()
+
+	msg, err := s.findContactMessage(ctx, id)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	now := time.Now()
+	var fields []string
+	if update.Read != nil {
+		msg.ReadAt = toggleTime(msg.ReadAt, *update.Read, now)
+		fields = append(fields, "ReadAt")
+	}
+	if update.Archived != nil {
+		msg.ArchivedAt = toggleTime(msg.ArchivedAt, *update.Archived, now)
+		fields = append(fields, "ArchivedAt")
+	}
+	if update.Spam != nil {
+		msg.Spam = *update.Spam
+		fields = append(fields, "Spam")
+
+		label := spam.Ham
+		if msg.Spam {
+			label = spam.Spam
+		}
+		if previous := spam.Label(msg.SpamTrainedAs); previous != label {
+			sub := &spam.Submission{Kind: "contact", IP: msg.IP, Name: msg.Name, Email: msg.Email, Body: msg.Subject + "\n" + msg.Body}
+			if err := s.learnSpam(ctx, sub, label, previous); err != nil {
+				return nil, tracing.RecordError(span, err)
+			}
+			msg.SpamTrainedAs = string(label)
+			fields = append(fields, "SpamTrainedAs")
+		}
+	}
+	if len(fields) == 0 {
+		return nil, tracing.RecordError(span, Validation("empty_update", "The update does not change anything", nil))
+	}
+
+	if err := s.repo.UpdateContactMessage(ctx, msg, fields...); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return msg, nil
+}
+
+// RecordContactReply notes that the current user answered a message, with an
+// optional note such as a summary of the reply, and marks it read
+func (s *Service) RecordContactReply(ctx context.Context, id uint, note string) (*models.ContactMessage, error) {
+	ctx, span := tracing.Start(ctx, "Service.RecordContactReply")
+	defer span.End()
+
+	msg, err := s.findContactMessage(ctx, id)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	now := time.Now()
+	userID := UserIDFromContext(ctx)
+	msg.RepliedAt = &now
+	msg.RepliedByID = &userID
+	msg.ReplyNote = strings.TrimSpace(note)
+	if msg.ReadAt == nil {
+		msg.ReadAt = &now
+	}
+	if err := s.repo.UpdateContactMessage(ctx, msg, "RepliedAt", "RepliedByID", "ReplyNote", "ReadAt"); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return msg, nil
+}
+
+// findContactMessage loads a message for an editor
+func (s *Service) findContactMessage(ctx context.Context, id uint) (*models.ContactMessage, error) {
+	if err := s.requireEditor(ctx, "contact_forbidden", "Only editors may read contact messages"); err != nil {
+		return nil, err
+	}
+	msg, err := s.repo.FindContactMessage(ctx, id)
+	return msg, translate(err, "contact_message")
+}
+
+// toggleTime sets a state timestamp when on and clears it when off, keeping
+// the original time if the state does not change
+func toggleTime(current *time.Time, on bool, now time.Time) *time.Time {
+	if !on {
+		return nil
+	}
+	if current != nil {
+		return current
+	}
+	return &now
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"blog-backend/mail"
+	"blog-backend/models"
+	"blog-backend/spam"
+)
+
+type recordingMailer struct {
+	sent []mail.Message
+}
+
+func (m *recordingMailer) Send(_ context.Context, msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestContactInbox(t *testing.T) {
+	svc, db := newTestService(t)
+	editor := createUser(t, db, "editor@example.com", models.RoleEditor)
+	author := createUser(t, db, "author@example.com", models.RoleAuthor)
+	editorCtx := WithUserID(context.Background(), editor.ID)
+	authorCtx := WithUserID(context.Background(), author.ID)
+	guest := context.Background()
+
+	mailer := &recordingMailer{}
+	var tasks []func(context.Context)
+	WithMailer(mailer, []string{"me@example.com"})(svc)
+	WithBackground(func(name string, fn func(ctx context.Context)) {
+		tasks = append(tasks, fn)
+	})(svc)
+	WithSpamFilter(spam.NewPipeline(spam.Honeypot()), 1)(svc)
+
+	input := ContactInput{Name: " Rita ", Email: "rita@recruit.example", Company: " Acme ", Subject: "Role", Body: "We would like to talk."}
+	msg, err := svc.SubmitContactMessage(guest, input)
+	if err != nil {
+		t.Fatalf("SubmitContactMessage returned error: %v", err)
+	}
+	if msg.Name != "Rita" || msg.Company != "Acme" || msg.Spam {
+		t.Errorf("expected a trimmed, clean message, got %+v", msg)
+	}
+	if len(tasks) != 1 || len(mailer.sent) != 0 {
+		t.Fatalf("expected the notification to be handed to the background runner, got %d tasks", len(tasks))
+	}
+	tasks[0](context.Background())
+	if len(mailer.sent) != 1 || mailer.sent[0].ReplyTo != input.Email || !strings.Contains(mailer.sent[0].Body, "Rita (Acme)") {
+		t.Errorf("expected a notification replying to the sender, got %+v", mailer.sent)
+	}
+
+	input.Website = "http://spam.example"
+	caught, err := svc.SubmitContactMessage(guest, input)
+	if err != nil {
+		t.Fatalf("SubmitContactMessage returned error: %v", err)
+	}
+	if !caught.Spam {
+		t.Error("expected the honeypot message to be filed as spam")
+	}
+	if len(tasks) != 1 {
+		t.Errorf("expected no notification for spam, got %d tasks", len(tasks))
+	}
+
+	if _, err := svc.ListContactMessages(authorCtx, "", 1, 10); !IsKind(err, KindForbidden) {
+		t.Errorf("expected authors to be refused, got %v", err)
+	}
+	if _, err := svc.GetContactMessage(authorCtx, msg.ID); !IsKind(err, KindForbidden) {
+		t.Errorf("expected authors to be refused, got %v", err)
+	}
+	inbox, err := svc.ListContactMessages(editorCtx, "", 1, 1000)
+	if err != nil {
+		t.Fatalf("ListContactMessages returned error: %v", err)
+	}
+	if inbox.Total != 1 || inbox.Unread != 1 || inbox.Messages[0].ID != msg.ID || inbox.PageSize != maxContactPageSize {
+		t.Errorf("expected the inbox to hold the one unread message, got %+v", inbox)
+	}
+
+	read, err := svc.GetContactMessage(editorCtx, msg.ID)
+	if err != nil {
+		t.Fatalf("GetContactMessage returned error: %v", err)
+	}
+	if read.ReadAt == nil {
+		t.Error("expected reading a message to mark it read")
+	}
+
+	replied, err := svc.RecordContactReply(editorCtx, msg.ID, "Booked a call")
+	if err != nil {
+		t.Fatalf("RecordContactReply returned error: %v", err)
+	}
+	if replied.RepliedAt == nil || replied.RepliedByID == nil || *replied.RepliedByID != editor.ID {
+		t.Errorf("expected the reply to be recorded, got %+v", replied)
+	}
+
+	archived := true
+	if _, err := svc.UpdateContactMessage(editorCtx, msg.ID, ContactUpdate{Archived: &archived}); err != nil {
+		t.Fatalf("UpdateContactMessage returned error: %v", err)
+	}
+	notSpam := false
+	released, err := svc.UpdateContactMessage(editorCtx, caught.ID, ContactUpdate{Spam: &notSpam})
+	if err != nil {
+		t.Fatalf("UpdateContactMessage returned error: %v", err)
+	}
+	if released.Spam || released.SpamTrainedAs != string(spam.Ham) {
+		t.Errorf("expected the message to be released and trained as ham, got %+v", released)
+	}
+	for folder, want := range map[string]int64{"inbox": 1, "archived": 1, "spam": 0, "all": 2} {
+		page, err := svc.ListContactMessages(editorCtx, folder, 1, 10)
+		if err != nil {
+			t.Fatalf("ListContactMessages(%s) returned error: %v", folder, err)
+		}
+		if page.Total != want {
+			t.Errorf("expected %d messages in %s, got %d", want, folder, page.Total)
+		}
+	}
+	if _, err := svc.ListContactMessages(editorCtx, "trash", 1, 10); !IsKind(err, KindValidation) {
+		t.Errorf("expected an unknown folder to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"blog-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type userIDKey struct{}
+
+// WithUserID returns a copy of ctx carrying the authenticated user's ID
+func WithUserID(ctx context.Context, id uint) context.Context {
+	return context.WithValue(ctx, userIDKey{}, id)
+}
+
+// UserIDFromContext returns the authenticated user's ID, or 0 for anonymous
+// requests
+func UserIDFromContext(ctx context.Context) uint {
+	id, _ := ctx.Value(userIDKey{}).(uint)
+	return id
+}
+
+// currentUser loads the authenticated user of the request
+func (s *Service) currentUser(ctx context.Context) (*models.User, error) {
+	id := UserIDFromContext(ctx)
+	if id == 0 {
+		return nil, Unauthorized("authorization_required", "Authentication is required")
+	}
+	user, err := s.repo.FindUserByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, Unauthorized("token_invalid", "The account no longer exists")
+	}
+	return user, err
+}
+
+// requireEditor fails unless the current user is an editor
+func (s *Service) requireEditor(ctx context.Context, code, message string) error {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return err
+	}
+	if !user.IsEditor() {
+		return Forbidden(code, message)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Kind classifies a domain error so the HTTP layer can pick a status code
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindNotFound
+	KindConflict
+	KindValidation
+	KindForbidden
+	KindUnauthorized
+	KindPreconditionFailed
+	KindTooManyRequests
+	KindChecksumMismatch
+)
+
+// Error is a domain error that is safe to show to clients. Code is a stable
+// machine-readable identifier, Message is human readable and Fields holds
+// per-field validation messages. Err keeps the underlying cause for logs.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  map[string]string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NotFound reports a missing resource
+func NotFound(code, message string) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: message}
+}
+
+// Conflict reports a request that clashes with the current state, such as a
+// duplicate unique key
+func Conflict(code, message string) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: message}
+}
+
+// Validation reports invalid input, optionally with per-field messages
+func Validation(code, message string, fields map[string]string) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message, Fields: fields}
+}
+
+// Forbidden reports an authenticated caller that may not perform the action
+func Forbidden(code, message string) *Error {
+	return &Error{Kind: KindForbidden, Code: code, Message: message}
+}
+
+// Unauthorized reports a caller that is not authenticated
+func Unauthorized(code, message string) *Error {
+	return &Error{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+// PreconditionFailed reports a conditional request whose If-Match does not
+// match the current version
+func PreconditionFailed(code, message string) *Error {
+	return &Error{Kind: KindPreconditionFailed, Code: code, Message: message}
+}
+
+// TooManyRequests reports a caller that exceeded a rate limit
+func TooManyRequests(code, message string) *Error {
+	return &Error{Kind: KindTooManyRequests, Code: code, Message: message}
+}
+
+// ChecksumMismatch reports uploaded data that does not match the checksum
+// sent with it
+func ChecksumMismatch(code, message string) *Error {
+	return &Error{Kind: KindChecksumMismatch, Code: code, Message: message}
+}
+
+// IsKind reports whether err is a domain error of the given kind
+func IsKind(err error, kind Kind) bool {
+	var domainErr *Error
+	return errors.As(err, &domainErr) && domainErr.Kind == kind
+}
+
+// notFound reports that resource does not exist, e.g. post_not_found
+func notFound(resource string) *Error {
+	return NotFound(resource+"_not_found", title(resource)+" not found")
+}
+
+// checkIfMatch enforces an If-Match precondition against the current ETag of
+// resource. No tags means the request is unconditional; "*" matches any
+// existing version.
+func checkIfMatch(ifMatch []string, etag, resource string) error {
+	if len(ifMatch) == 0 {
+		return nil
+	}
+	for _, tag := range ifMatch {
+		if tag == "*" || tag == etag {
+			return nil
+		}
+	}
+	return PreconditionFailed(resource+"_version_mismatch", title(resource)+" has changed since it was fetched")
+}
+
+// staleWrite explains a versioned write that matched no rows: another request
+// changed or deleted resource between our read and write
+func staleWrite(ifMatch []string, resource string) error {
+	if len(ifMatch) > 0 {
+		return PreconditionFailed(resource+"_version_mismatch", title(resource)+" has changed since it was fetched")
+	}
+	return Conflict(resource+"_modified", title(resource)+" was modified by another request, please retry")
+}
+
+func title(resource string) string {
+	return strings.ToUpper(resource[:1]) + strings.ReplaceAll(resource[1:], "_", " ")
+}
+
+// translate turns repository errors about resource into domain errors, e.g.
+// a missing post into post_not_found. Other errors are returned unchanged.
+func translate(err error, resource string) error {
+	if err == nil {
+		return nil
+	}
+
+	name := title(resource)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		e := notFound(resource)
+		e.Err = err
+		return e
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		e := Conflict(resource+"_already_exists", name+" already exists")
+		e.Err = err
+		return e
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		e := Conflict(resource+"_reference_invalid", name+" references a record that does not exist")
+		e.Err = err
+		return e
+	}
+	return err
+}
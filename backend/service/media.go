@@ -0,0 +1,519 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"blog-backend/imaging"
+	"blog-backend/logging"
+	"blog-backend/metrics"
+	"blog-backend/models"
+	"blog-backend/repository"
+	"blog-backend/storage"
+	"blog-backend/tracing"
+
+	"gorm.io/gorm"
+)
+
+// Media library listing page sizes
+const (
+	defaultMediaPageSize = 50
+	maxMediaPageSize     = 200
+)
+
+// mediaKeyPattern matches the storage keys UploadMedia generates, wherever
+// they appear in a URL: content hashes, or UUIDs for media uploaded before
+// content addressing. The first group is the key without its extension,
+// shared by an original and its variants.
+var mediaKeyPattern = regexp.MustCompile(`([0-9a-f]{64}|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})(?:-[0-9]+w)?\.[a-z0-9]+`)
+
+// MediaUpload is a file to add to the media library. Filename is the name
+// the client gave it and is kept for display only.
+type MediaUpload struct {
+	Filename string
+	Data     []byte
+}
+
+// MediaQuery filters and pages the media library listing
+type MediaQuery struct {
+	Query    string
+	Type     string
+	Orphaned bool
+	Page     int
+	PageSize int
+}
+
+// MediaPage is one page of the media library
+type MediaPage struct {
+	Media    []models.Media `json:"media"`
+	Total    int64          `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+}
+
+// WithStorage keeps uploaded media in store, whose objects are served under
+// /uploads
+func WithStorage(store storage.Backend) Option {
+	return func(s *Service) {
+		s.store = store
+	}
+}
+
+// WithImageProcessor strips metadata from uploaded images and renders their
+// variants and placeholders with p. Without it images are stored as sent.
+func WithImageProcessor(p *imaging.Processor) Option {
+	return func(s *Service) {
+		s.images = p
+	}
+}
+
+// WithMediaOrphanRetention deletes media that nothing references once it is
+// older than retention. Zero keeps orphans.
+func WithMediaOrphanRetention(retention time.Duration) Option {
+	return func(s *Service) {
+		s.mediaOrphanRetention = retention
+	}
+}
+
+// UploadMedia checks a file against the upload limits and adds it to the
+// media library, owned by the current user. Files are stored under the
+// SHA-256 of their content: uploading a file the user already has returns
+// the existing media item, and media with the same content as another
+// user's shares its stored object. Images are stripped of their metadata and
+// stored with their variants.
+func (s *Service) UploadMedia(ctx context.Context, upload MediaUpload) (*models.Media, error) {
+	ctx, span := tracing.Start(ctx, "Service.UploadMedia")
+	defer span.End()
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	media, err := s.addMedia(ctx, user.ID, upload)
+	return media, tracing.RecordError(span, err)
+}
+
+// addMedia checks, processes and stores an upload held in memory for
+// UploadMedia
+func (s *Service) addMedia(ctx context.Context, userID uint, upload MediaUpload) (*models.Media, error) {
+	mimeType, err := s.uploadLimits.Check(upload.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Re-uploads of a stored file are recognised before any processing
+	checksum := checksumOf(upload.Data)
+	if media, err := s.findDuplicateMedia(ctx, userID, checksum); media != nil || err != nil {
+		return media, err
+	}
+
+	media := &models.Media{
+		Filename:       displayFilename(upload.Filename),
+		MimeType:       mimeType,
+		UploadChecksum: checksum,
+		UploadedByID:   userID,
+	}
+	data := upload.Data
+	var variants []imaging.Variant
+	if strings.HasPrefix(mimeType, "image/") {
+		if s.images != nil {
+			result, err := s.images.Process(ctx, data, mimeType)
+			if err != nil {
+				return nil, imageError(err)
+			}
+			data, variants = result.Original, result.Variants
+			media.Width, media.Height = result.Width, result.Height
+			media.Blurhash, media.LQIP = result.Blurhash, result.LQIP
+		} else if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			media.Width, media.Height = cfg.Width, cfg.Height
+		}
+	}
+	media.Checksum = checksumOf(data)
+	media.Size = int64(len(data))
+	media.StorageKey = media.Checksum + UploadExtension(mimeType)
+	if media.Checksum != checksum {
+		// Stripping metadata may turn the upload into a file the user has
+		if existing, err := s.findDuplicateMedia(ctx, userID, media.Checksum); existing != nil || err != nil {
+			return existing, err
+		}
+	}
+
+	if err := s.storeMedia(ctx, media, bytes.NewReader(data), variants); err != nil {
+		return nil, err
+	}
+	fillMediaURLs(media)
+	return media, nil
+}
+
+// storeMedia writes the original of media from r and its variants, then
+// records media with a reference on the stored object. Keys follow the
+// content, so content another media item already stored is written again
+// with the same bytes; that keeps the files in place should the other item
+// be deleted meanwhile.
+func (s *Service) storeMedia(ctx context.Context, media *models.Media, r io.Reader, variants []imaging.Variant) error {
+	stem := strings.TrimSuffix(media.StorageKey, path.Ext(media.StorageKey))
+	for _, v := range variants {
+		key := fmt.Sprintf("%s-%dw%s", stem, v.Width, UploadExtension(v.MimeType))
+		media.Variants = append(media.Variants, models.MediaVariant{
+			Width: v.Width, Height: v.Height, MimeType: v.MimeType, StorageKey: key, Size: int64(len(v.Data)),
+		})
+	}
+	if err := s.writeMediaFiles(ctx, media, r, variants); err != nil {
+		return err
+	}
+	if err := s.repo.CreateMedia(ctx, media); err != nil {
+		s.removeUnsharedFiles(ctx, media)
+		return translate(err, "media")
+	}
+	metrics.RecordUpload(media.Size)
+	return nil
+}
+
+// findDuplicateMedia returns the media item of the user with the given
+// content, or nil when there is none
+func (s *Service) findDuplicateMedia(ctx context.Context, userID uint, checksum string) (*models.Media, error) {
+	media, err := s.repo.FindMediaByChecksum(ctx, checksum, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fillMediaURLs(media)
+	return media, nil
+}
+
+// imageError turns image processing failures into validation errors
+func imageError(err error) error {
+	switch {
+	case errors.Is(err, imaging.ErrTooLarge):
+		return Validation("image_too_large", fmt.Sprintf("Images may have at most %d pixels", imaging.MaxPixels),
+			map[string]string{"image": "has too many pixels"})
+	case errors.Is(err, imaging.ErrMalformed):
+		return Validation("invalid_image", "The uploaded image could not be read", map[string]string{"image": "is not a valid image"})
+	}
+	return err
+}
+
+// ListMedia returns a page of the media library, newest first. Query searches
+// filenames and alt text; Type is a MIME type prefix such as "image".
+func (s *Service) ListMedia(ctx context.Context, q MediaQuery) (*MediaPage, error) {
+	ctx, span := tracing.Start(ctx, "Service.ListMedia")
+	defer span.End()
+
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 {
+		q.PageSize = defaultMediaPageSize
+	}
+	if q.PageSize > maxMediaPageSize {
+		q.PageSize = maxMediaPageSize
+	}
+	filter := repository.MediaFilter{Query: q.Query, MimePrefix: q.Type, Orphaned: q.Orphaned}
+	if filter.MimePrefix != "" && !strings.Contains(filter.MimePrefix, "/") {
+		filter.MimePrefix += "/"
+	}
+
+	media, total, err := s.repo.ListMedia(ctx, filter, q.PageSize, (q.Page-1)*q.PageSize)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	if err := s.loadMediaReferences(ctx, media); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return &MediaPage{Media: media, Total: total, Page: q.Page, PageSize: q.PageSize}, nil
+}
+
+// GetMedia returns a media item with the posts and projects using it
+func (s *Service) GetMedia(ctx context.Context, id uint) (*models.Media, error) {
+	ctx, span := tracing.Start(ctx, "Service.GetMedia")
+	defer span.End()
+
+	media, err := s.repo.FindMedia(ctx, id)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "media"))
+	}
+	items := []models.Media{*media}
+	if err := s.loadMediaReferences(ctx, items); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return &items[0], nil
+}
+
+// UpdateMediaAltText changes the alt text of a media item. Only the uploader
+// and editors may change it.
+func (s *Service) UpdateMediaAltText(ctx context.Context, id uint, altText string) (*models.Media, error) {
+	ctx, span := tracing.Start(ctx, "Service.UpdateMediaAltText")
+	defer span.End()
+
+	media, err := s.findOwnMedia(ctx, id)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	media.AltText = strings.TrimSpace(altText)
+	if err := s.repo.UpdateMediaAltText(ctx, media, media.AltText); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	fillMediaURLs(media)
+	return media, nil
+}
+
+// DeleteMedia removes a media item and its file. Media that is still used is
+// only deleted when force is set. Only the uploader and editors may delete.
+func (s *Service) DeleteMedia(ctx context.Context, id uint, force bool) error {
+	ctx, span := tracing.Start(ctx, "Service.DeleteMedia")
+	defer span.End()
+
+	media, err := s.findOwnMedia(ctx, id)
+	if err != nil {
+		return tracing.RecordError(span, err)
+	}
+	if !force {
+		refs, err := s.repo.ListMediaReferences(ctx, []uint{media.ID})
+		if err != nil {
+			return tracing.RecordError(span, err)
+		}
+		if len(refs) > 0 {
+			return tracing.RecordError(span, Conflict("media_in_use", "The media is still used; delete it with force=true to remove it anyway"))
+		}
+	}
+	return tracing.RecordError(span, s.removeMedia(ctx, media))
+}
+
+// PurgeOrphanedMedia rebuilds the media references and deletes media that
+// nothing references and that is older than the orphan retention
+func (s *Service) PurgeOrphanedMedia(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "Service.PurgeOrphanedMedia")
+	defer span.End()
+
+	if s.mediaOrphanRetention <= 0 {
+		return 0, nil
+	}
+	if err := s.rescanMediaReferences(ctx); err != nil {
+		return 0, tracing.RecordError(span, err)
+	}
+	orphans, err := s.repo.ListOrphanedMedia(ctx, time.Now().Add(-s.mediaOrphanRetention))
+	if err != nil {
+		return 0, tracing.RecordError(span, err)
+	}
+	for i := range orphans {
+		if err := s.removeMedia(ctx, &orphans[i]); err != nil {
+			return i, tracing.RecordError(span, err)
+		}
+	}
+	span.SetAttributes(tracing.RowsAffected(int64(len(orphans))))
+	return len(orphans), nil
+}
+
+// RunMediaCleanup calls PurgeOrphanedMedia every interval until ctx is
+// cancelled
+func (s *Service) RunMediaCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.PurgeOrphanedMedia(ctx); err != nil {
+			logging.Printf(ctx, "Failed to clean up media: %v", err)
+		} else if n > 0 {
+			logging.Printf(ctx, "Deleted %d orphaned media items", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// trackMediaReferences records which media text (a post's content or a
+// project's media text) uses. Failures are logged rather than returned: the
+// owner is already saved and the next rescan repairs the references.
+func (s *Service) trackMediaReferences(ctx context.Context, ownerType string, ownerID uint, text string) {
+	if err := s.repo.SetMediaReferences(ctx, ownerType, ownerID, mediaKeys(text)); err != nil {
+		logging.Printf(ctx, "Failed to track media used by %s %d: %v", ownerType, ownerID, err)
+	}
+}
+
+// projectMediaText joins the project fields that may use media: its image
+// and the description, which links demo videos and PDFs
+func projectMediaText(project *models.Project) string {
+	return project.ImageURL + "\n" + project.Description
+}
+
+// rescanMediaReferences rebuilds the references of every post and project
+func (s *Service) rescanMediaReferences(ctx context.Context) error {
+	posts, projects, err := s.repo.ListMediaOwners(ctx)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		if err := s.repo.SetMediaReferences(ctx, models.MediaOwnerPost, post.ID, mediaKeys(post.Content)); err != nil {
+			return err
+		}
+	}
+	for _, project := range projects {
+		if err := s.repo.SetMediaReferences(ctx, models.MediaOwnerProject, project.ID, mediaKeys(projectMediaText(&project))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findOwnMedia loads a media item the current user may change
+func (s *Service) findOwnMedia(ctx context.Context, id uint) (*models.Media, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	media, err := s.repo.FindMedia(ctx, id)
+	if err != nil {
+		return nil, translate(err, "media")
+	}
+	if media.UploadedByID != user.ID && !user.IsEditor() {
+		return nil, Forbidden("media_forbidden", "Only the uploader or an editor may change this media")
+	}
+	return media, nil
+}
+
+// removeMedia deletes the record of a media item, then its files unless
+// other media items share them
+func (s *Service) removeMedia(ctx context.Context, media *models.Media) error {
+	last, err := s.repo.DeleteMedia(ctx, media)
+	if err != nil {
+		return err
+	}
+	if last {
+		s.removeUnsharedFiles(ctx, media)
+	}
+	return nil
+}
+
+// writeMediaFiles stores the original of media from r, then the data of its
+// variants. Either all are written or none are left behind, unless other
+// media items share them.
+func (s *Service) writeMediaFiles(ctx context.Context, media *models.Media, r io.Reader, variants []imaging.Variant) error {
+	if err := s.store.Put(ctx, media.StorageKey, r, media.Size, media.MimeType); err != nil {
+		return err
+	}
+	for i, v := range variants {
+		key := media.Variants[i].StorageKey
+		if err := s.store.Put(ctx, key, bytes.NewReader(v.Data), int64(len(v.Data)), v.MimeType); err != nil {
+			s.removeUnsharedFiles(ctx, media)
+			return err
+		}
+	}
+	return nil
+}
+
+// removeMediaFiles deletes the original and variant files of media. Failures
+// are logged; the record is gone either way.
+func (s *Service) removeMediaFiles(ctx context.Context, media *models.Media) {
+	keys := []string{media.StorageKey}
+	for _, v := range media.Variants {
+		keys = append(keys, v.StorageKey)
+	}
+	for _, key := range keys {
+		if err := s.store.Delete(ctx, key); err != nil {
+			logging.Printf(ctx, "Failed to remove file %s of media %d: %v", key, media.ID, err)
+		}
+	}
+}
+
+// removeUnsharedFiles deletes the files of media unless a media item, such as
+// a concurrent upload of the same content, uses them
+func (s *Service) removeUnsharedFiles(ctx context.Context, media *models.Media) {
+	_, err := s.repo.FindMediaByStorageKey(ctx, media.StorageKey)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		s.removeMediaFiles(ctx, media)
+	case err != nil:
+		logging.Printf(ctx, "Failed to check whether the files of media %d are shared: %v", media.ID, err)
+	}
+}
+
+// loadMediaReferences fills in the URL and references of media
+func (s *Service) loadMediaReferences(ctx context.Context, media []models.Media) error {
+	if len(media) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(media))
+	for i := range media {
+		ids[i] = media[i].ID
+		fillMediaURLs(&media[i])
+	}
+	refs, err := s.repo.ListMediaReferences(ctx, ids)
+	if err != nil {
+		return err
+	}
+	byMedia := map[uint][]models.MediaReference{}
+	for _, ref := range refs {
+		byMedia[ref.MediaID] = append(byMedia[ref.MediaID], ref)
+	}
+	for i := range media {
+		media[i].References = byMedia[media[i].ID]
+	}
+	return nil
+}
+
+// checksumOf returns the hex SHA-256 of data
+func checksumOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// mediaURL is the public URL of a stored file
+func mediaURL(key string) string {
+	return "/uploads/" + key
+}
+
+// fillMediaURLs sets the URLs of media and its variants and builds a srcset
+// per variant type. The original is the largest candidate of every srcset.
+func fillMediaURLs(media *models.Media) {
+	media.URL = mediaURL(media.StorageKey)
+	if len(media.Variants) == 0 {
+		return
+	}
+	media.Srcset = map[string]string{}
+	for i := range media.Variants {
+		v := &media.Variants[i]
+		v.URL = mediaURL(v.StorageKey)
+		if set := media.Srcset[v.MimeType]; set != "" {
+			media.Srcset[v.MimeType] = set + ", "
+		}
+		media.Srcset[v.MimeType] += fmt.Sprintf("%s %dw", v.URL, v.Width)
+	}
+	for mimeType, set := range media.Srcset {
+		media.Srcset[mimeType] = fmt.Sprintf("%s, %s %dw", set, media.URL, media.Width)
+	}
+}
+
+// mediaKeys returns the storage keys of the media mentioned in text. A
+// variant stands for its original, whose extension may differ, so every
+// extension an original can have is returned.
+func mediaKeys(text string) []string {
+	var keys []string
+	seen := map[string]bool{}
+	for _, match := range mediaKeyPattern.FindAllStringSubmatch(text, -1) {
+		stem := match[1]
+		if seen[stem] {
+			continue
+		}
+		seen[stem] = true
+		for _, ext := range uploadExtensions {
+			keys = append(keys, stem+ext)
+		}
+	}
+	return keys
+}
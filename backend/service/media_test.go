@@ -0,0 +1,348 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"blog-backend/imaging"
+	"blog-backend/models"
+	"blog-backend/storage"
+)
+
+func pngBytes(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// useLocalStorage stores the uploads of svc in a temporary directory and
+// returns it
+func useLocalStorage(t *testing.T, svc *Service) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	store, err := storage.NewLocal(dir, "/uploads")
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	WithStorage(store)(svc)
+	return dir
+}
+
+func TestMediaLibrary(t *testing.T) {
+	svc, db := newTestService(t)
+	dir := useLocalStorage(t, svc)
+	author := createUser(t, db, "author@example.com", models.RoleAuthor)
+	other := createUser(t, db, "other@example.com", models.RoleAuthor)
+	ctx := WithUserID(context.Background(), author.ID)
+
+	if _, err := svc.UploadMedia(context.Background(), MediaUpload{Filename: "a.png", Data: pngBytes(t, 1, 1)}); !IsKind(err, KindUnauthorized) {
+		t.Errorf("expected anonymous uploads to be refused, got %v", err)
+	}
+
+	media, err := svc.UploadMedia(ctx, MediaUpload{Filename: "../../Logo.png", Data: pngBytes(t, 40, 20)})
+	if err != nil {
+		t.Fatalf("UploadMedia returned error: %v", err)
+	}
+	if media.MimeType != "image/png" || media.Width != 40 || media.Height != 20 || media.Filename != "Logo.png" || len(media.Checksum) != 64 {
+		t.Errorf("unexpected media record: %+v", media)
+	}
+	if _, err := os.Stat(filepath.Join(dir, media.StorageKey)); err != nil {
+		t.Errorf("expected the file to be stored: %v", err)
+	}
+
+	if _, err := svc.UpdateMediaAltText(WithUserID(context.Background(), other.ID), media.ID, "Nope"); !IsKind(err, KindForbidden) {
+		t.Errorf("expected other authors to be refused, got %v", err)
+	}
+	if _, err := svc.UpdateMediaAltText(ctx, media.ID, " Company logo "); err != nil {
+		t.Fatalf("UpdateMediaAltText returned error: %v", err)
+	}
+	found, err := svc.ListMedia(ctx, MediaQuery{Query: "COMPANY", Type: "image"})
+	if err != nil {
+		t.Fatalf("ListMedia returned error: %v", err)
+	}
+	if found.Total != 1 || found.Media[0].AltText != "Company logo" || found.Media[0].URL != "/uploads/"+media.StorageKey {
+		t.Errorf("expected to find the logo by its alt text, got %+v", found)
+	}
+
+	// Saving a project that shows the image references it
+	project := createProject(t, db)
+	if _, err := svc.PatchProject(ctx, project.ID, Patch{"imageUrl": []byte(`"` + media.URL + `"`)}, nil); err != nil {
+		t.Fatalf("PatchProject returned error: %v", err)
+	}
+	stored, err := svc.GetMedia(ctx, media.ID)
+	if err != nil {
+		t.Fatalf("GetMedia returned error: %v", err)
+	}
+	if len(stored.References) != 1 || stored.References[0].OwnerType != models.MediaOwnerProject || stored.References[0].OwnerID != project.ID {
+		t.Errorf("expected the project reference, got %+v", stored.References)
+	}
+	if err := svc.DeleteMedia(ctx, media.ID, false); !IsKind(err, KindConflict) {
+		t.Errorf("expected deleting used media to be refused, got %v", err)
+	}
+
+	// Once nothing uses it, the image is purged as an orphan
+	unused, err := svc.UploadMedia(ctx, MediaUpload{Filename: "unused.png", Data: pngBytes(t, 2, 2)})
+	if err != nil {
+		t.Fatalf("UploadMedia returned error: %v", err)
+	}
+	db.Model(&models.Project{}).Where("id = ?", project.ID).Update("image_url", "")
+	WithMediaOrphanRetention(time.Nanosecond)(svc)
+	time.Sleep(time.Millisecond)
+	n, err := svc.PurgeOrphanedMedia(context.Background())
+	if err != nil {
+		t.Fatalf("PurgeOrphanedMedia returned error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected both unused items to be purged, got %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, unused.StorageKey)); !os.IsNotExist(err) {
+		t.Errorf("expected the orphaned file to be removed, got %v", err)
+	}
+}
+
+func TestImageVariants(t *testing.T) {
+	svc, db := newTestService(t)
+	dir := useLocalStorage(t, svc)
+	WithImageProcessor(imaging.NewProcessor([]int{16, 100}, 1, 80))(svc)
+	author := createUser(t, db, "author@example.com", models.RoleAuthor)
+	ctx := WithUserID(context.Background(), author.ID)
+
+	media, err := svc.UploadMedia(ctx, MediaUpload{Filename: "clear.png", Data: pngBytes(t, 40, 20)})
+	if err != nil {
+		t.Fatalf("UploadMedia returned error: %v", err)
+	}
+	if len(media.Variants) != 2 || media.Variants[0].MimeType != "image/webp" || media.Variants[1].MimeType != "image/png" || media.Variants[0].Height != 8 {
+		t.Fatalf("expected WebP and PNG variants 16 pixels wide, got %+v", media.Variants)
+	}
+	if media.Blurhash == "" || media.LQIP == "" {
+		t.Errorf("expected placeholders, got %q and %q", media.Blurhash, media.LQIP)
+	}
+	webp := media.Variants[0]
+	if want := webp.URL + " 16w, " + media.URL + " 40w"; media.Srcset["image/webp"] != want {
+		t.Errorf("expected srcset %q, got %q", want, media.Srcset["image/webp"])
+	}
+	if _, err := os.Stat(filepath.Join(dir, webp.StorageKey)); err != nil {
+		t.Errorf("expected the variant to be stored: %v", err)
+	}
+
+	// Linking to a variant uses the media item
+	post := createPost(t, db, "pictured")
+	if _, err := svc.UpdatePost(ctx, "pictured", &models.Post{Title: post.Title, Content: "![](" + webp.URL + ")"}, nil); err != nil {
+		t.Fatalf("UpdatePost returned error: %v", err)
+	}
+	stored, err := svc.GetMedia(ctx, media.ID)
+	if err != nil {
+		t.Fatalf("GetMedia returned error: %v", err)
+	}
+	if len(stored.References) != 1 || stored.Srcset["image/png"] == "" {
+		t.Errorf("expected the post reference and srcsets, got %+v", stored)
+	}
+
+	if err := svc.DeleteMedia(ctx, media.ID, true); err != nil {
+		t.Fatalf("DeleteMedia returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, webp.StorageKey)); !os.IsNotExist(err) {
+		t.Errorf("expected the variant to be removed, got %v", err)
+	}
+}
+
+func TestMediaDeduplication(t *testing.T) {
+	svc, db := newTestService(t)
+	dir := useLocalStorage(t, svc)
+	WithImageProcessor(imaging.NewProcessor([]int{16}, 1, 80))(svc)
+	author := createUser(t, db, "author@example.com", models.RoleAuthor)
+	other := createUser(t, db, "other@example.com", models.RoleAuthor)
+	ctx := WithUserID(context.Background(), author.ID)
+	otherCtx := WithUserID(context.Background(), other.ID)
+
+	logo := pngBytes(t, 40, 20)
+	first, err := svc.UploadMedia(ctx, MediaUpload{Filename: "logo.png", Data: logo})
+	if err != nil {
+		t.Fatalf("UploadMedia returned error: %v", err)
+	}
+	if first.StorageKey != first.Checksum+".png" {
+		t.Errorf("expected the file to be stored under its hash, got %s", first.StorageKey)
+	}
+
+	// The same image with a text chunk is the same file once stripped
+	tagged := append(append(append([]byte{}, logo[:33]...), "\x00\x00\x00\x02tEXtHi\x00\x00\x00\x00"...), logo[33:]...)
+	again, err := svc.UploadMedia(ctx, MediaUpload{Filename: "logo-final.png", Data: tagged})
+	if err != nil {
+		t.Fatalf("UploadMedia returned error: %v", err)
+	}
+	if again.ID != first.ID || again.Filename != "logo.png" {
+		t.Errorf("expected the existing media item back, got %+v", again)
+	}
+
+	shared, err := svc.UploadMedia(otherCtx, MediaUpload{Filename: "their-logo.png", Data: logo})
+	if err != nil {
+		t.Fatalf("UploadMedia returned error: %v", err)
+	}
+	if shared.ID == first.ID || shared.StorageKey != first.StorageKey || len(shared.Variants) != len(first.Variants) {
+		t.Errorf("expected a second media item sharing the stored object, got %+v", shared)
+	}
+	var object models.MediaObject
+	db.First(&object, "storage_key = ?", first.StorageKey)
+	if object.RefCount != 2 {
+		t.Errorf("expected two references to the object, got %d", object.RefCount)
+	}
+
+	// Files outlive every media item but the last
+	if err := svc.DeleteMedia(ctx, first.ID, false); err != nil {
+		t.Fatalf("DeleteMedia returned error: %v", err)
+	}
+	for _, key := range []string{first.StorageKey, first.Variants[0].StorageKey} {
+		if _, err := os.Stat(filepath.Join(dir, key)); err != nil {
+			t.Errorf("expected %s to be kept for the other media item: %v", key, err)
+		}
+	}
+	if err := svc.DeleteMedia(otherCtx, shared.ID, false); err != nil {
+		t.Fatalf("DeleteMedia returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, first.StorageKey)); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be removed with the last media item, got %v", err)
+	}
+	if n := db.Find(&[]models.MediaObject{}).RowsAffected; n != 0 {
+		t.Errorf("expected the object record to be removed, got %d", n)
+	}
+}
+
+func TestSharedMediaRestoresFiles(t *testing.T) {
+	svc, db := newTestService(t)
+	dir := useLocalStorage(t, svc)
+	author := createUser(t, db, "author@example.com", models.RoleAuthor)
+	other := createUser(t, db, "other@example.com", models.RoleAuthor)
+
+	logo := pngBytes(t, 40, 20)
+	first, err := svc.UploadMedia(WithUserID(context.Background(), author.ID), MediaUpload{Filename: "logo.png", Data: logo})
+	if err != nil {
+		t.Fatalf("UploadMedia returned error: %v", err)
+	}
+	// As if a concurrent delete of the last item removed the file
+	if err := os.Remove(filepath.Join(dir, first.StorageKey)); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	shared, err := svc.UploadMedia(WithUserID(context.Background(), other.ID), MediaUpload{Filename: "logo.png", Data: logo})
+	if err != nil {
+		t.Fatalf("UploadMedia returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, shared.StorageKey)); err != nil {
+		t.Errorf("expected the shared file to be written again: %v", err)
+	}
+
+	// An object recorded by a concurrent first upload is shared, not a conflict
+	pdf := []byte("%PDF-1.4\nraced")
+	db.Create(&models.MediaObject{StorageKey: checksumOf(pdf) + ".pdf", Checksum: checksumOf(pdf), RefCount: 1})
+	if _, err := svc.UploadMedia(WithUserID(context.Background(), author.ID), MediaUpload{Filename: "raced.pdf", Data: pdf}); err != nil {
+		t.Fatalf("UploadMedia returned error: %v", err)
+	}
+	var object models.MediaObject
+	db.First(&object, "storage_key = ?", checksumOf(pdf)+".pdf")
+	if object.RefCount != 2 {
+		t.Errorf("expected the upload to take a reference on the object, got %d", object.RefCount)
+	}
+}
+
+func TestMediaRecognisesReuploadsBeforeProcessing(t *testing.T) {
+	svc, db := newTestService(t)
+	useLocalStorage(t, svc)
+	WithImageProcessor(imaging.NewProcessor([]int{16}, 1, 80))(svc)
+	ctx := WithUserID(context.Background(), createUser(t, db, "author@example.com", models.RoleAuthor).ID)
+
+	logo := pngBytes(t, 40, 20)
+	tagged := append(append(append([]byte{}, logo[:33]...), "\x00\x00\x00\x02tEXtHi\x00\x00\x00\x00"...), logo[33:]...)
+	first, err := svc.UploadMedia(ctx, MediaUpload{Filename: "logo.png", Data: tagged})
+	if err != nil {
+		t.Fatalf("UploadMedia returned error: %v", err)
+	}
+	if first.Checksum == checksumOf(tagged) {
+		t.Fatalf("expected the metadata to be stripped before hashing")
+	}
+
+	// Without a processor the upload could only match by its own hash
+	WithImageProcessor(nil)(svc)
+	again, err := svc.UploadMedia(ctx, MediaUpload{Filename: "logo-again.png", Data: tagged})
+	if err != nil {
+		t.Fatalf("UploadMedia returned error: %v", err)
+	}
+	if again.ID != first.ID {
+		t.Errorf("expected the re-upload to be recognised by its upload hash, got media %d", again.ID)
+	}
+}
+
+func TestProjectDescriptionsReferenceMedia(t *testing.T) {
+	svc, db := newTestService(t)
+	useLocalStorage(t, svc)
+	ctx := WithUserID(context.Background(), createUser(t, db, "author@example.com", models.RoleAuthor).ID)
+
+	media, err := svc.UploadMedia(ctx, MediaUpload{Filename: "demo.pdf", Data: []byte("%PDF-1.4\nproject demo")})
+	if err != nil {
+		t.Fatalf("UploadMedia returned error: %v", err)
+	}
+	project := createProject(t, db)
+	description := `"See the [demo](` + media.URL + `)"`
+	if _, err := svc.PatchProject(ctx, project.ID, Patch{"description": []byte(description)}, nil); err != nil {
+		t.Fatalf("PatchProject returned error: %v", err)
+	}
+	stored, err := svc.GetMedia(ctx, media.ID)
+	if err != nil {
+		t.Fatalf("GetMedia returned error: %v", err)
+	}
+	if len(stored.References) != 1 || stored.References[0].OwnerID != project.ID {
+		t.Errorf("expected the project reference, got %+v", stored.References)
+	}
+
+	WithMediaOrphanRetention(time.Nanosecond)(svc)
+	time.Sleep(time.Millisecond)
+	if n, err := svc.PurgeOrphanedMedia(context.Background()); err != nil || n != 0 {
+		t.Errorf("expected media linked from a description to be kept, purged %d (%v)", n, err)
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	limits := NewUploadLimits(200, 1000, 1000)
+	pdf := []byte("%PDF-1.4\n" + strings.Repeat("x", 300))
+
+	tests := []struct {
+		name string
+		data []byte
+		mime string
+		code string
+	}{
+		{"png", pngBytes(t, 1, 1), "image/png", ""},
+		{"pdf over the image limit", pdf, "application/pdf", ""},
+		{"image over its limit", pngBytes(t, 400, 400), "", "file_too_large"},
+		{"html named like an image", []byte("<html><script>alert(1)</script></html>"), "", "unsupported_file_type"},
+		{"truncated png", pngBytes(t, 1, 1)[:20], "", "invalid_image"},
+		{"empty", nil, "", "file_empty"},
+	}
+	for _, tt := range tests {
+		mimeType, err := limits.Check(tt.data)
+		var domainErr *Error
+		switch {
+		case tt.code == "" && err != nil:
+			t.Errorf("%s: expected the file to be accepted, got %v", tt.name, err)
+		case tt.code == "" && mimeType != tt.mime:
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.mime, mimeType)
+		case tt.code != "" && (!errors.As(err, &domainErr) || domainErr.Code != tt.code):
+			t.Errorf("%s: expected %s, got %v", tt.name, tt.code, err)
+		}
+	}
+
+	if name := displayFilename("..\\..\\evil\x00.png"); name != "evil.png" {
+		t.Errorf("expected a bare display name, got %q", name)
+	}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	"blog-backend/models"
+	"blog-backend/tracing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Patch is an RFC 7396 JSON merge patch keyed by JSON field name. A null
+// value resets the field to its zero value.
+type Patch map[string]json.RawMessage
+
+// Fields that may be changed through PATCH. Counters, ownership, slugs,
+// timestamps and the workflow status are managed by the server.
+var (
+	editablePostFields = []string{
+		"title", "content", "excerpt", "readTime", "tags", "social_data",
+	}
+	editableProjectFields = []string{
+		"title", "description", "shortDescription", "imageUrl", "technologies",
+		"githubUrl", "liveUrl", "isVisible", "category", "priority",
+	}
+)
+
+// PatchPost applies a merge patch to the post with the given slug. Only the
+// supplied fields are validated and written. ifMatch and the author check
+// are honoured like in UpdatePost.
+func (s *Service) PatchPost(ctx context.Context, slug string, patch Patch, ifMatch []string) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Service.PatchPost", tracing.PostSlug(slug))
+	defer span.End()
+
+	_, post, err := s.writablePost(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	if err := checkIfMatch(ifMatch, post.ETag(), "post"); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	before := *post
+	fields, err := applyPatch(post, patch, editablePostFields)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	if err := s.savePost(ctx, &before, post, fields, ifMatch); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return post, nil
+}
+
+// PatchProject applies a merge patch to the project with the given ID
+func (s *Service) PatchProject(ctx context.Context, id uint, patch Patch, ifMatch []string) (*models.Project, error) {
+	ctx, span := tracing.Start(ctx, "Service.PatchProject", tracing.ProjectID(id))
+	defer span.End()
+
+	project, err := s.repo.FindProjectByID(ctx, id)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "project"))
+	}
+	if err := checkIfMatch(ifMatch, project.ETag(), "project"); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	fields, err := applyPatch(project, patch, editableProjectFields)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	rows, err := s.repo.UpdateProjectFields(ctx, project, fields)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "project"))
+	}
+	span.SetAttributes(tracing.RowsAffected(rows))
+	if rows == 0 {
+		return nil, tracing.RecordError(span, staleWrite(ifMatch, "project"))
+	}
+	s.trackMediaReferences(ctx, models.MediaOwnerProject, project.ID, projectMediaText(project))
+	return project, nil
+}
+
+// applyPatch merges patch into model (a pointer to a struct) and validates the
+// patched fields against their binding rules. It returns the Go names of the
+// fields to persist. Keys outside editable are rejected.
+func applyPatch(model interface{}, patch Patch, editable []string) ([]string, error) {
+	if len(patch) == 0 {
+		return nil, Validation("empty_patch", "The patch does not change any fields", nil)
+	}
+
+	allowed := make(map[string]bool, len(editable))
+	for _, name := range editable {
+		allowed[name] = true
+	}
+	invalid := map[string]string{}
+	for key := range patch {
+		if !allowed[key] {
+			invalid[key] = "cannot be modified"
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, Validation("field_not_editable", "The patch changes fields that cannot be modified", invalid)
+	}
+
+	// Round-trip through a JSON document so the merge follows RFC 7396:
+	// present keys replace, null keys are removed and fall back to zero values
+	current, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(current, &doc); err != nil {
+		return nil, err
+	}
+	for key, value := range patch {
+		if string(value) == "null" {
+			delete(doc, key)
+			continue
+		}
+		doc[key] = value
+	}
+	merged, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	target := reflect.ValueOf(model).Elem()
+	fresh := reflect.New(target.Type())
+	if err := json.Unmarshal(merged, fresh.Interface()); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, Validation("validation_failed", "The request has invalid fields",
+				map[string]string{typeErr.Field: "has the wrong type"})
+		}
+		return nil, Validation("invalid_patch", "The patch is not valid JSON", nil)
+	}
+
+	fields := goFieldNames(target.Type(), patch)
+	if err := validate.StructPartial(fresh.Interface(), fields...); err != nil {
+		var validationErrs validator.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			return nil, FieldValidation(validationErrs)
+		}
+		return nil, err
+	}
+
+	target.Set(fresh.Elem())
+	return fields, nil
+}
+
+// goFieldNames maps the JSON keys of patch to the struct field names of t
+func goFieldNames(t reflect.Type, patch Patch) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := patch[JSONFieldName(field)]; ok {
+			names = append(names, field.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"blog-backend/logging"
+	"blog-backend/models"
+	"blog-backend/tracing"
+	"blog-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// DefaultPreviewTTL is how long preview links stay valid unless configured
+// otherwise
+const DefaultPreviewTTL = 72 * time.Hour
+
+var errPreviewNotFound = NotFound("preview_not_found", "This preview link is invalid, expired or revoked")
+
+// WithPreviewTTL sets the default lifetime of preview links
+func WithPreviewTTL(ttl time.Duration) Option {
+	return func(s *Service) {
+		s.previewTTL = ttl
+	}
+}
+
+// PreviewLinkRequest configures a new preview link. ExpiresInHours falls back
+// to the default lifetime.
+type PreviewLinkRequest struct {
+	ExpiresInHours int `json:"expiresInHours" binding:"omitempty,min=1,max=720"`
+}
+
+// IssuedPreviewLink is a newly created preview link with its signed token.
+// The token is only returned once.
+type IssuedPreviewLink struct {
+	models.PreviewLink
+	Token string `json:"token"`
+}
+
+// CreatePreviewLink issues a signed, expiring link to the post with the given
+// slug. Only the post's author and editors may share a post.
+func (s *Service) CreatePreviewLink(ctx context.Context, slug string, req PreviewLinkRequest) (*IssuedPreviewLink, error) {
+	ctx, span := tracing.Start(ctx, "Service.CreatePreviewLink", tracing.PostSlug(slug))
+	defer span.End()
+
+	user, post, err := s.sharablePost(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	ttl := s.previewTTL
+	if ttl <= 0 {
+		ttl = DefaultPreviewTTL
+	}
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	link := models.PreviewLink{
+		PostID:      post.ID,
+		CreatedByID: user.ID,
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+	if err := s.repo.CreatePreviewLink(ctx, &link); err != nil {
+		return nil, tracing.RecordError(span, translate(err, "preview_link"))
+	}
+
+	token, err := utils.GeneratePreviewToken(link.ID, post.ID, link.ExpiresAt)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return &IssuedPreviewLink{PreviewLink: link, Token: token}, nil
+}
+
+// ListPreviewLinks returns the preview links issued for a post, newest first
+func (s *Service) ListPreviewLinks(ctx context.Context, slug string) ([]models.PreviewLink, error) {
+	ctx, span := tracing.Start(ctx, "Service.ListPreviewLinks", tracing.PostSlug(slug))
+	defer span.End()
+
+	_, post, err := s.sharablePost(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	links, err := s.repo.ListPreviewLinks(ctx, post.ID)
+	return links, tracing.RecordError(span, err)
+}
+
+// RevokePreviewLink stops a preview link from working. Revoking twice is not
+// an error.
+func (s *Service) RevokePreviewLink(ctx context.Context, slug string, id uint) error {
+	ctx, span := tracing.Start(ctx, "Service.RevokePreviewLink", tracing.PostSlug(slug))
+	defer span.End()
+
+	_, post, err := s.sharablePost(ctx, slug)
+	if err != nil {
+		return tracing.RecordError(span, err)
+	}
+	link, err := s.repo.FindPreviewLink(ctx, post.ID, id)
+	if err != nil {
+		return tracing.RecordError(span, translate(err, "preview_link"))
+	}
+
+	rows, err := s.repo.RevokePreviewLink(ctx, link, time.Now())
+	span.SetAttributes(tracing.RowsAffected(rows))
+	return tracing.RecordError(span, err)
+}
+
+// GetPreview returns the post a preview token was issued for, whatever its
+// workflow state. Invalid, expired and revoked tokens are all reported as not
+// found.
+func (s *Service) GetPreview(ctx context.Context, token string) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Service.GetPreview")
+	defer span.End()
+
+	linkID, postID, err := utils.ValidatePreviewToken(token)
+	if err != nil {
+		return nil, tracing.RecordError(span, errPreviewNotFound)
+	}
+	link, err := s.repo.FindPreviewLink(ctx, postID, linkID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, tracing.RecordError(span, errPreviewNotFound)
+		}
+		return nil, tracing.RecordError(span, err)
+	}
+	if !link.Active(time.Now()) {
+		return nil, tracing.RecordError(span, errPreviewNotFound)
+	}
+
+	post, err := s.repo.FindPostByID(ctx, postID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, tracing.RecordError(span, errPreviewNotFound)
+		}
+		return nil, tracing.RecordError(span, err)
+	}
+	span.SetAttributes(tracing.PostSlug(post.Slug))
+
+	if err := s.repo.RecordPreviewView(ctx, link.ID); err != nil {
+		logging.Printf(ctx, "Failed to count view of preview link %d: %v", link.ID, err)
+	}
+	return post, nil
+}
+
+// sharablePost loads the post with the given slug if the current user may
+// manage its preview links
+func (s *Service) sharablePost(ctx context.Context, slug string) (*models.User, *models.Post, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	post, err := s.repo.FindPostBySlug(ctx, slug)
+	if err != nil {
+		return nil, nil, translate(err, "post")
+	}
+	if !mayEdit(user, post) {
+		return nil, nil, Forbidden("preview_forbidden", "Only the author and editors may share this post")
+	}
+	return user, post, nil
+}
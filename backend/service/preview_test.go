@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"blog-backend/models"
+	"blog-backend/utils"
+)
+
+func TestPreviewLinkLifecycle(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	svc, db := newTestService(t)
+	editor := createUser(t, db, "editor@example.com", models.RoleEditor)
+	createPost(t, db, "draft")
+	ctx := WithUserID(context.Background(), editor.ID)
+
+	link, err := svc.CreatePreviewLink(ctx, "draft", PreviewLinkRequest{ExpiresInHours: 1})
+	if err != nil {
+		t.Fatalf("CreatePreviewLink returned error: %v", err)
+	}
+
+	post, err := svc.GetPreview(context.Background(), link.Token)
+	if err != nil {
+		t.Fatalf("GetPreview returned error: %v", err)
+	}
+	if post.Slug != "draft" {
+		t.Errorf("expected the draft post, got %q", post.Slug)
+	}
+
+	if _, err := utils.ValidateToken(link.Token, nil); err == nil {
+		t.Error("expected a preview token to be rejected as a session token")
+	}
+
+	if err := svc.RevokePreviewLink(ctx, "draft", link.ID); err != nil {
+		t.Fatalf("RevokePreviewLink returned error: %v", err)
+	}
+	if _, err := svc.GetPreview(context.Background(), link.Token); !IsKind(err, KindNotFound) {
+		t.Errorf("expected a revoked link to be not found, got %v", err)
+	}
+
+	links, _ := svc.ListPreviewLinks(ctx, "draft")
+	if len(links) != 1 || links[0].Views != 1 || links[0].RevokedAt == nil {
+		t.Errorf("unexpected preview links: %+v", links)
+	}
+}
+
+func TestPreviewLinkRejectsInvalidTokens(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	svc, db := newTestService(t)
+	createUser(t, db, "author@example.com", models.RoleAuthor)
+	user := createUser(t, db, "stranger@example.com", models.RoleAuthor)
+	createPost(t, db, "draft")
+
+	if _, err := svc.CreatePreviewLink(WithUserID(context.Background(), user.ID), "draft", PreviewLinkRequest{}); !IsKind(err, KindForbidden) {
+		t.Errorf("expected a stranger to be unable to share the post, got %v", err)
+	}
+
+	session, _ := utils.GenerateToken(*user)
+	for _, token := range []string{"garbage", session} {
+		if _, err := svc.GetPreview(context.Background(), token); !IsKind(err, KindNotFound) {
+			t.Errorf("expected token %q to be rejected, got %v", token, err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"blog-backend/logging"
+	"blog-backend/models"
+	"blog-backend/tracing"
+)
+
+// Related post scoring. A candidate must share tags or words with the post;
+// recency only breaks ties between otherwise similar posts.
+const (
+	relatedPerPost     = 10
+	tagWeight          = 0.5
+	textWeight         = 0.35
+	recencyWeight      = 0.15
+	recencyHalfLife    = 180 * 24 * time.Hour
+	defaultRelatedSize = 3
+	maxRelatedSize     = relatedPerPost
+)
+
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "you": true, "your": true,
+	"are": true, "this": true, "that": true, "from": true, "how": true, "what": true,
+	"why": true, "into": true, "about": true, "using": true, "use": true, "can": true,
+	"not": true, "but": true, "all": true, "our": true, "its": true, "was": true,
+}
+
+// ListRelatedPosts returns up to limit published posts recommended for readers
+// of the post with the given slug, best match first
+func (s *Service) ListRelatedPosts(ctx context.Context, slug string, limit int) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Service.ListRelatedPosts", tracing.PostSlug(slug))
+	defer span.End()
+
+	if limit <= 0 {
+		limit = defaultRelatedSize
+	}
+	if limit > maxRelatedSize {
+		limit = maxRelatedSize
+	}
+
+	post, err := s.repo.FindPublishedPostBySlug(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "post"))
+	}
+
+	posts, err := s.repo.ListRelatedPosts(ctx, post.ID, limit)
+	return posts, tracing.RecordError(span, err)
+}
+
+// RecomputeRelatedPosts scores every pair of posts and replaces the stored
+// recommendations
+func (s *Service) RecomputeRelatedPosts(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "Service.RecomputeRelatedPosts")
+	defer span.End()
+
+	posts, err := s.repo.ListPostsForRelated(ctx)
+	if err != nil {
+		return tracing.RecordError(span, err)
+	}
+
+	related := scoreRelatedPosts(posts, time.Now())
+	span.SetAttributes(tracing.RowsAffected(int64(len(related))))
+	return tracing.RecordError(span, s.repo.ReplaceRelatedPosts(ctx, related))
+}
+
+// RunRelatedPosts recomputes related posts at start, whenever posts change
+// and otherwise every interval (to age the recency score) until ctx is
+// cancelled. Bursts of changes are coalesced.
+func (s *Service) RunRelatedPosts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RecomputeRelatedPosts(ctx); err != nil {
+			logging.Printf(ctx, "Failed to recompute related posts: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.postsChanged:
+		}
+	}
+}
+
+// notifyPostsChanged schedules a recomputation of related posts without
+// blocking the caller
+func (s *Service) notifyPostsChanged() {
+	select {
+	case s.postsChanged <- struct{}{}:
+	default:
+	}
+}
+
+// scoreRelatedPosts ranks, for every post, the published posts most similar
+// to it
+func scoreRelatedPosts(posts []models.Post, now time.Time) []models.RelatedPost {
+	vectors := tfidf(posts)
+
+	var related []models.RelatedPost
+	for i, post := range posts {
+		var candidates []models.RelatedPost
+		for j, candidate := range posts {
+			if i == j || !candidate.Published {
+				continue
+			}
+			tags := jaccard(post.Tags, candidate.Tags)
+			text := cosine(vectors[i], vectors[j])
+			if tags == 0 && text == 0 {
+				continue
+			}
+			score := tagWeight*tags + textWeight*text + recencyWeight*recency(candidate, now)
+			candidates = append(candidates, models.RelatedPost{PostID: post.ID, RelatedID: candidate.ID, Score: score})
+		}
+
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return candidates[a].Score > candidates[b].Score
+		})
+		if len(candidates) > relatedPerPost {
+			candidates = candidates[:relatedPerPost]
+		}
+		for rank := range candidates {
+			candidates[rank].Rank = rank + 1
+		}
+		related = append(related, candidates...)
+	}
+	return related
+}
+
+// tfidf builds a normalised TF-IDF vector of the title and excerpt of each
+// post
+func tfidf(posts []models.Post) []map[string]float64 {
+	terms := make([]map[string]float64, len(posts))
+	documents := map[string]int{}
+	for i, post := range posts {
+		terms[i] = map[string]float64{}
+		for _, word := range tokenize(post.Title + " " + post.Excerpt) {
+			if terms[i][word] == 0 {
+				documents[word]++
+			}
+			terms[i][word]++
+		}
+	}
+
+	for i := range terms {
+		var norm float64
+		for word, count := range terms[i] {
+			weight := count * math.Log(float64(len(posts)+1)/float64(documents[word]))
+			terms[i][word] = weight
+			norm += weight * weight
+		}
+		norm = math.Sqrt(norm)
+		for word := range terms[i] {
+			if norm > 0 {
+				terms[i][word] /= norm
+			}
+		}
+	}
+	return terms
+}
+
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := words[:0]
+	for _, word := range words {
+		if len(word) > 2 && !stopWords[word] {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+func cosine(a, b map[string]float64) float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	var dot float64
+	for word, weight := range a {
+		dot += weight * b[word]
+	}
+	return dot
+}
+
+func jaccard(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	set := make(map[string]bool, len(a))
+	for _, tag := range a {
+		set[strings.ToLower(tag)] = true
+	}
+	union := len(set)
+	shared := 0
+	seen := map[string]bool{}
+	for _, tag := range b {
+		tag = strings.ToLower(tag)
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		if set[tag] {
+			shared++
+		} else {
+			union++
+		}
+	}
+	return float64(shared) / float64(union)
+}
+
+// recency decays from 1 for a post published now, halving every
+// recencyHalfLife
+func recency(post models.Post, now time.Time) float64 {
+	published := post.CreatedAt
+	if post.PublishedAt != nil {
+		published = *post.PublishedAt
+	}
+	age := now.Sub(published)
+	if age < 0 {
+		age = 0
+	}
+	return math.Exp2(-float64(age) / float64(recencyHalfLife))
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blog-backend/models"
+
+	"gorm.io/gorm"
+)
+
+func TestScoreRelatedPosts(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-2 * 365 * 24 * time.Hour)
+	posts := []models.Post{
+		{Model: gorm.Model{ID: 1}, Title: "Concurrency in Go", Excerpt: "Goroutines and channels", Tags: []string{"go", "concurrency"}, Published: true},
+		{Model: gorm.Model{ID: 2}, Title: "Channels deep dive", Excerpt: "Buffered channels in Go", Tags: []string{"go", "concurrency"}, Published: true, PublishedAt: &now},
+		{Model: gorm.Model{ID: 3}, Title: "Go modules", Excerpt: "Dependency management", Tags: []string{"go"}, Published: true, PublishedAt: &old},
+		{Model: gorm.Model{ID: 4}, Title: "Baking bread", Excerpt: "Sourdough starter", Tags: []string{"food"}, Published: true},
+		{Model: gorm.Model{ID: 5}, Title: "Draft about channels", Excerpt: "Unfinished", Tags: []string{"go", "concurrency"}},
+	}
+
+	var forFirst []models.RelatedPost
+	for _, r := range scoreRelatedPosts(posts, now) {
+		if r.PostID == 1 {
+			forFirst = append(forFirst, r)
+		}
+	}
+
+	if len(forFirst) != 2 {
+		t.Fatalf("expected two related posts, got %+v", forFirst)
+	}
+	if forFirst[0].RelatedID != 2 || forFirst[0].Rank != 1 || forFirst[1].RelatedID != 3 {
+		t.Errorf("expected the channels post first and the modules post second, got %+v", forFirst)
+	}
+}
+
+func TestRelatedPostsEndpointData(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := context.Background()
+	posts := map[string]*models.Post{}
+	for slug, title := range map[string]string{
+		"kubernetes-intro":   "Kubernetes deployments explained",
+		"kubernetes-scaling": "Scaling kubernetes deployments",
+		"gardening":          "Spring gardening tips",
+	} {
+		posts[slug] = createPost(t, db, slug)
+		db.Model(posts[slug]).Update("title", title)
+		publishPost(t, db, posts[slug])
+	}
+
+	if err := svc.RecomputeRelatedPosts(ctx); err != nil {
+		t.Fatalf("RecomputeRelatedPosts returned error: %v", err)
+	}
+
+	related, err := svc.ListRelatedPosts(ctx, "kubernetes-intro", 0)
+	if err != nil {
+		t.Fatalf("ListRelatedPosts returned error: %v", err)
+	}
+	if len(related) == 0 || related[0].Slug != "kubernetes-scaling" {
+		t.Fatalf("expected the scaling post first, got %+v", related)
+	}
+	if related[0].Content != "" {
+		t.Error("expected related posts without content")
+	}
+
+	// Unpublished posts drop out without waiting for a recomputation
+	db.Model(posts["kubernetes-scaling"]).Updates(map[string]interface{}{"status": models.StatusArchived, "published": false})
+	related, _ = svc.ListRelatedPosts(ctx, "kubernetes-intro", 0)
+	for _, post := range related {
+		if post.Slug == "kubernetes-scaling" {
+			t.Error("expected unpublished post to be left out")
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"blog-backend/logging"
+	"blog-backend/models"
+	"blog-backend/tracing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Resumable upload defaults
+const (
+	defaultMaxChunkSize    = 8 << 20
+	defaultResumableExpiry = 24 * time.Hour
+)
+
+// checksumPattern matches a hex SHA-256
+var checksumPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ResumableInput starts a resumable upload of a file of Length bytes.
+// Checksum is the optional hex SHA-256 of the whole file.
+type ResumableInput struct {
+	Filename string
+	Length   int64
+	Checksum string
+}
+
+// WithResumableUploads accepts chunks of up to maxChunk bytes and deletes
+// uploads that make no progress for expiry
+func WithResumableUploads(maxChunk int64, expiry time.Duration) Option {
+	return func(s *Service) {
+		s.maxChunkSize = maxChunk
+		s.resumableExpiry = expiry
+	}
+}
+
+// MaxUploadSize returns the largest file of any accepted type
+func (s *Service) MaxUploadSize() int64 {
+	return s.uploadLimits.Max()
+}
+
+// CreateResumableUpload starts an upload for the current user. Its content
+// is sent with AppendResumableUpload.
+func (s *Service) CreateResumableUpload(ctx context.Context, in ResumableInput) (*models.ResumableUpload, error) {
+	ctx, span := tracing.Start(ctx, "Service.CreateResumableUpload")
+	defer span.End()
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	if in.Length <= 0 {
+		return nil, tracing.RecordError(span, Validation("file_empty", "The uploaded file is empty", map[string]string{"length": "must be positive"}))
+	}
+	if in.Length > s.uploadLimits.Max() {
+		return nil, tracing.RecordError(span, Validation("file_too_large", fmt.Sprintf("Uploads may be at most %d bytes", s.uploadLimits.Max()),
+			map[string]string{"length": "is too large"}))
+	}
+	checksum := strings.ToLower(in.Checksum)
+	if checksum != "" && !checksumPattern.MatchString(checksum) {
+		return nil, tracing.RecordError(span, Validation("invalid_checksum", "The checksum must be a hex SHA-256",
+			map[string]string{"checksum": "is not a SHA-256"}))
+	}
+
+	upload := &models.ResumableUpload{
+		ID:           uuid.New().String(),
+		Filename:     displayFilename(in.Filename),
+		Length:       in.Length,
+		Checksum:     checksum,
+		UploadedByID: user.ID,
+		ExpiresAt:    time.Now().Add(s.resumableExpiry),
+	}
+	if err := s.repo.CreateResumableUpload(ctx, upload); err != nil {
+		return nil, tracing.RecordError(span, translate(err, "resumable_upload"))
+	}
+	return upload, nil
+}
+
+// GetResumableUpload returns an upload of the current user, with its media
+// item once it is complete. An upload whose file was refused returns the
+// reason as its error.
+func (s *Service) GetResumableUpload(ctx context.Context, id string) (*models.ResumableUpload, error) {
+	ctx, span := tracing.Start(ctx, "Service.GetResumableUpload")
+	defer span.End()
+
+	upload, err := s.findOwnResumableUpload(ctx, id)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	if upload.Failed() {
+		return nil, tracing.RecordError(span, uploadFailure(upload))
+	}
+	if upload.MediaID != nil {
+		media, err := s.repo.FindMedia(ctx, *upload.MediaID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, tracing.RecordError(span, err)
+		}
+		if media != nil {
+			fillMediaURLs(media)
+			upload.Media = media
+		}
+	}
+	return upload, nil
+}
+
+// AppendResumableUpload stores the chunk read from body at offset, which
+// must be the number of bytes received so far. A non-nil digest is the
+// SHA-256 the chunk must have; without one, a chunk cut short by a dropped
+// connection is kept so the client can resume after it. The last chunk
+// starts assembling the file in the background; GetResumableUpload reports
+// its media item once ready. Appending to a complete upload changes nothing,
+// so a retried last chunk succeeds again, and restarts a failed assembly.
+func (s *Service) AppendResumableUpload(ctx context.Context, id string, offset int64, body io.Reader, digest []byte) (*models.ResumableUpload, error) {
+	ctx, span := tracing.Start(ctx, "Service.AppendResumableUpload")
+	defer span.End()
+
+	upload, err := s.findOwnResumableUpload(ctx, id)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	if upload.Failed() {
+		return nil, tracing.RecordError(span, uploadFailure(upload))
+	}
+	if upload.Complete() {
+		if upload.MediaID == nil {
+			s.assembleInBackground(ctx, upload)
+		}
+		return upload, nil
+	}
+	if offset != upload.Received {
+		return nil, tracing.RecordError(span, Conflict("upload_offset_mismatch",
+			fmt.Sprintf("The upload continues at offset %d", upload.Received)))
+	}
+
+	data, readErr := io.ReadAll(io.LimitReader(body, s.maxChunkSize+1))
+	if int64(len(data)) > s.maxChunkSize {
+		return nil, tracing.RecordError(span, Validation("chunk_too_large", fmt.Sprintf("Chunks may be at most %d bytes", s.maxChunkSize),
+			map[string]string{"chunk": "is too large"}))
+	}
+	if readErr != nil && (digest != nil || len(data) == 0) {
+		return nil, tracing.RecordError(span, readErr)
+	}
+	if upload.Received+int64(len(data)) > upload.Length {
+		return nil, tracing.RecordError(span, Validation("upload_too_long", "The chunk runs past the end of the upload",
+			map[string]string{"chunk": "is too long"}))
+	}
+	if digest != nil {
+		if sum := sha256.Sum256(data); !bytes.Equal(sum[:], digest) {
+			return nil, tracing.RecordError(span, ChecksumMismatch("upload_checksum_mismatch", "The chunk does not match its checksum"))
+		}
+	}
+
+	if len(data) > 0 {
+		if upload.Received == 0 {
+			if upload.MimeType, err = s.uploadLimits.CheckType(data, upload.Length); err != nil {
+				return nil, tracing.RecordError(span, err)
+			}
+		}
+		if err := s.appendResumablePart(ctx, upload, data); err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+	}
+
+	if upload.Complete() {
+		s.assembleInBackground(ctx, upload)
+	}
+	return upload, nil
+}
+
+// CancelResumableUpload deletes an upload and the parts received so far.
+// The media item of a complete upload is kept.
+func (s *Service) CancelResumableUpload(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "Service.CancelResumableUpload")
+	defer span.End()
+
+	upload, err := s.findOwnResumableUpload(ctx, id)
+	if err != nil {
+		return tracing.RecordError(span, err)
+	}
+	if err := s.repo.DeleteResumableUpload(ctx, upload); err != nil {
+		return tracing.RecordError(span, err)
+	}
+	s.deleteResumableParts(ctx, upload)
+	return nil
+}
+
+// PurgeExpiredResumableUploads deletes uploads past their expiry and the
+// parts they left behind
+func (s *Service) PurgeExpiredResumableUploads(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "Service.PurgeExpiredResumableUploads")
+	defer span.End()
+
+	uploads, err := s.repo.ListExpiredResumableUploads(ctx, time.Now())
+	if err != nil {
+		return 0, tracing.RecordError(span, err)
+	}
+	for i := range uploads {
+		if err := s.repo.DeleteResumableUpload(ctx, &uploads[i]); err != nil {
+			return i, tracing.RecordError(span, err)
+		}
+		s.deleteResumableParts(ctx, &uploads[i])
+	}
+	span.SetAttributes(tracing.RowsAffected(int64(len(uploads))))
+	return len(uploads), nil
+}
+
+// RunResumableUploadCleanup calls PurgeExpiredResumableUploads every
+// interval until ctx is cancelled
+func (s *Service) RunResumableUploadCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.PurgeExpiredResumableUploads(ctx); err != nil {
+			logging.Printf(ctx, "Failed to clean up resumable uploads: %v", err)
+		} else if n > 0 {
+			logging.Printf(ctx, "Deleted %d expired resumable uploads", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// findOwnResumableUpload loads an unexpired upload of the current user
+func (s *Service) findOwnResumableUpload(ctx context.Context, id string) (*models.ResumableUpload, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	upload, err := s.repo.FindResumableUpload(ctx, id)
+	if err != nil {
+		return nil, translate(err, "resumable_upload")
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, notFound("resumable_upload")
+	}
+	if upload.UploadedByID != user.ID {
+		return nil, Forbidden("resumable_upload_forbidden", "Only the uploader may continue this upload")
+	}
+	return upload, nil
+}
+
+// appendResumablePart stores data as the next part of upload and moves its
+// offset past it, pushing back its expiry. Each attempt writes its own key,
+// so a request that loses a race for the offset removes only its own part.
+func (s *Service) appendResumablePart(ctx context.Context, upload *models.ResumableUpload, data []byte) error {
+	key := resumablePartKey(upload.ID, upload.Received)
+	if err := s.store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+		return err
+	}
+	upload.ExpiresAt = time.Now().Add(s.resumableExpiry)
+	rows, err := s.repo.AppendResumableUpload(ctx, upload, key, int64(len(data)))
+	if err == nil && rows == 0 {
+		err = Conflict("upload_offset_mismatch", "Another request continued the upload first")
+	}
+	if err != nil {
+		s.store.Delete(ctx, key)
+		return err
+	}
+	upload.Received += int64(len(data))
+	upload.PartKeys = append(upload.PartKeys, key)
+	return nil
+}
+
+// assembleInBackground assembles a complete upload off the request path,
+// unless an assembly of it is already running. A refused file is recorded on
+// the upload and its parts removed; other failures are logged, and the
+// client may retry the last chunk.
+func (s *Service) assembleInBackground(ctx context.Context, upload *models.ResumableUpload) {
+	if _, running := s.assembling.LoadOrStore(upload.ID, struct{}{}); running {
+		return
+	}
+	// The request goes on to report the upload it holds
+	copied := *upload
+	upload = &copied
+	ctx = context.WithoutCancel(ctx)
+	s.background("resumable-assembly", func(context.Context) {
+		defer s.assembling.Delete(upload.ID)
+
+		media, err := s.assembleResumableUpload(ctx, upload)
+		if err == nil {
+			err = s.repo.CompleteResumableUpload(ctx, upload, media.ID)
+		}
+		var domainErr *Error
+		if errors.As(err, &domainErr) && (domainErr.Kind == KindValidation || domainErr.Kind == KindChecksumMismatch) {
+			if err := s.repo.FailResumableUpload(ctx, upload, domainErr.Code, domainErr.Message); err != nil {
+				logging.Printf(ctx, "Failed to record the failure of resumable upload %s: %v", upload.ID, err)
+				return
+			}
+			s.deleteResumableParts(ctx, upload)
+			logging.Printf(ctx, "Resumable upload %s was refused: %v", upload.ID, domainErr)
+			return
+		}
+		if err != nil {
+			logging.Printf(ctx, "Failed to assemble resumable upload %s: %v", upload.ID, err)
+			return
+		}
+		s.deleteResumableParts(ctx, upload)
+		logging.Printf(ctx, "Resumable upload %s completed as media %d", upload.ID, media.ID)
+	})
+}
+
+// assembleResumableUpload joins the parts of a complete upload in a
+// temporary file, checks its checksum and adds it to the media library.
+// Images go through the same checks and processing as UploadMedia; other
+// files are streamed to storage.
+func (s *Service) assembleResumableUpload(ctx context.Context, upload *models.ResumableUpload) (*models.Media, error) {
+	f, err := os.CreateTemp("", "resumable-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hash := sha256.New()
+	for _, key := range upload.PartKeys {
+		obj, err := s.store.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(io.MultiWriter(f, hash), obj.Body)
+		obj.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if upload.Checksum != "" && checksum != upload.Checksum {
+		return nil, ChecksumMismatch("upload_checksum_mismatch", "The uploaded file does not match its checksum; start the upload again")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(upload.MimeType, "image/") {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		return s.addMedia(ctx, upload.UploadedByID, MediaUpload{Filename: upload.Filename, Data: data})
+	}
+
+	if media, err := s.findDuplicateMedia(ctx, upload.UploadedByID, checksum); media != nil || err != nil {
+		return media, err
+	}
+	media := &models.Media{
+		StorageKey:     checksum + UploadExtension(upload.MimeType),
+		Filename:       upload.Filename,
+		MimeType:       upload.MimeType,
+		Size:           upload.Length,
+		Checksum:       checksum,
+		UploadChecksum: checksum,
+		UploadedByID:   upload.UploadedByID,
+	}
+	if err := s.storeMedia(ctx, media, f, nil); err != nil {
+		return nil, err
+	}
+	fillMediaURLs(media)
+	return media, nil
+}
+
+// uploadFailure returns the error an upload's file was refused with
+func uploadFailure(upload *models.ResumableUpload) *Error {
+	if upload.ErrorCode == "upload_checksum_mismatch" {
+		return ChecksumMismatch(upload.ErrorCode, upload.Error)
+	}
+	return Validation(upload.ErrorCode, upload.Error, nil)
+}
+
+// deleteResumableParts removes the stored parts of upload. Failures are
+// logged; the parts are unreachable once the upload is gone.
+func (s *Service) deleteResumableParts(ctx context.Context, upload *models.ResumableUpload) {
+	for _, key := range upload.PartKeys {
+		if err := s.store.Delete(ctx, key); err != nil {
+			logging.Printf(ctx, "Failed to remove part %s of upload %s: %v", key, upload.ID, err)
+		}
+	}
+}
+
+// resumablePartKey returns a new key for a part of an upload starting at
+// offset. Keys starting with a dot are never served under /uploads.
+func resumablePartKey(id string, offset int64) string {
+	return fmt.Sprintf(".resumable/%s/%012d-%s", id, offset, uuid.New().String())
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"blog-backend/imaging"
+	"blog-backend/models"
+)
+
+// assembleInline runs background tasks, such as assembling uploads, before
+// the call that started them returns
+func assembleInline(svc *Service) {
+	WithBackground(func(name string, fn func(ctx context.Context)) {
+		fn(context.Background())
+	})(svc)
+}
+
+// partFiles counts the stored parts of an upload
+func partFiles(t *testing.T, dir, id string) int {
+	t.Helper()
+
+	entries, err := os.ReadDir(filepath.Join(dir, ".resumable", id))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("failed to list parts: %v", err)
+	}
+	return len(entries)
+}
+
+func TestResumableUpload(t *testing.T) {
+	svc, db := newTestService(t)
+	dir := useLocalStorage(t, svc)
+	WithResumableUploads(10, time.Hour)(svc)
+	assembleInline(svc)
+	author := createUser(t, db, "author@example.com", models.RoleAuthor)
+	other := createUser(t, db, "other@example.com", models.RoleAuthor)
+	ctx := WithUserID(context.Background(), author.ID)
+
+	data := []byte("%PDF-1.4\nportfolio demo document")
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	if _, err := svc.CreateResumableUpload(ctx, ResumableInput{Filename: "demo.pdf", Length: 1 << 40}); !IsKind(err, KindValidation) {
+		t.Errorf("expected oversized uploads to be refused, got %v", err)
+	}
+	upload, err := svc.CreateResumableUpload(ctx, ResumableInput{Filename: "demo.pdf", Length: int64(len(data)), Checksum: checksum})
+	if err != nil {
+		t.Fatalf("CreateResumableUpload returned error: %v", err)
+	}
+
+	if _, err := svc.GetResumableUpload(WithUserID(context.Background(), other.ID), upload.ID); !IsKind(err, KindForbidden) {
+		t.Errorf("expected other users to be refused, got %v", err)
+	}
+	if _, err := svc.AppendResumableUpload(ctx, upload.ID, 5, bytes.NewReader(data[:10]), nil); !IsKind(err, KindConflict) {
+		t.Errorf("expected a wrong offset to conflict, got %v", err)
+	}
+	if _, err := svc.AppendResumableUpload(ctx, upload.ID, 0, bytes.NewReader(data[:11]), nil); !IsKind(err, KindValidation) {
+		t.Errorf("expected an oversized chunk to be refused, got %v", err)
+	}
+	if _, err := svc.AppendResumableUpload(ctx, upload.ID, 0, bytes.NewReader(data[:10]), make([]byte, 32)); !IsKind(err, KindChecksumMismatch) {
+		t.Errorf("expected a corrupt chunk to be refused, got %v", err)
+	}
+
+	for offset := 0; offset < len(data); offset += 10 {
+		chunk := data[offset:min(offset+10, len(data))]
+		digest := sha256.Sum256(chunk)
+		upload, err = svc.AppendResumableUpload(ctx, upload.ID, int64(offset), bytes.NewReader(chunk), digest[:])
+		if err != nil {
+			t.Fatalf("AppendResumableUpload at %d returned error: %v", offset, err)
+		}
+	}
+	if !upload.Complete() {
+		t.Fatalf("expected the last chunk to complete the upload, got %+v", upload)
+	}
+	upload, err = svc.GetResumableUpload(ctx, upload.ID)
+	if err != nil || upload.Media == nil {
+		t.Fatalf("expected the upload to report its media item, got %+v (%v)", upload, err)
+	}
+	media := upload.Media
+	if media.MimeType != "application/pdf" || media.Checksum != checksum || media.Filename != "demo.pdf" || media.Size != int64(len(data)) {
+		t.Errorf("unexpected media record: %+v", media)
+	}
+	stored, err := os.ReadFile(filepath.Join(dir, media.StorageKey))
+	if err != nil || !bytes.Equal(stored, data) {
+		t.Errorf("expected the assembled file in storage, got %q (%v)", stored, err)
+	}
+	if n := partFiles(t, dir, upload.ID); n != 0 {
+		t.Errorf("expected parts to be removed after assembly, found %d", n)
+	}
+
+	// A retried last chunk succeeds again without changing anything
+	last := int64(len(data) / 10 * 10)
+	retried, err := svc.AppendResumableUpload(ctx, upload.ID, last, bytes.NewReader(data[last:]), nil)
+	if err != nil || retried.Received != retried.Length || retried.MediaID == nil || *retried.MediaID != media.ID {
+		t.Errorf("expected the retry to report the complete upload, got %+v (%v)", retried, err)
+	}
+
+	bad, err := svc.CreateResumableUpload(ctx, ResumableInput{Filename: "bad.pdf", Length: 9, Checksum: checksum})
+	if err != nil {
+		t.Fatalf("CreateResumableUpload returned error: %v", err)
+	}
+	if _, err := svc.AppendResumableUpload(ctx, bad.ID, 0, bytes.NewReader([]byte("%PDF-1.4\n")), nil); err != nil {
+		t.Fatalf("AppendResumableUpload returned error: %v", err)
+	}
+	if _, err := svc.GetResumableUpload(ctx, bad.ID); !IsKind(err, KindChecksumMismatch) {
+		t.Errorf("expected the upload to report the checksum mismatch, got %v", err)
+	}
+	if n := partFiles(t, dir, bad.ID); n != 0 {
+		t.Errorf("expected the parts of the corrupt upload to be removed, found %d", n)
+	}
+}
+
+func TestResumableUploadReportsRefusedFiles(t *testing.T) {
+	svc, db := newTestService(t)
+	useLocalStorage(t, svc)
+	WithImageProcessor(imaging.NewProcessor([]int{16}, 1, 80))(svc)
+	author := createUser(t, db, "author@example.com", models.RoleAuthor)
+	ctx := WithUserID(context.Background(), author.ID)
+	var tasks []func(context.Context)
+	WithBackground(func(name string, fn func(ctx context.Context)) {
+		tasks = append(tasks, fn)
+	})(svc)
+
+	// The header passes the type check, the pixel data does not decode
+	data := pngBytes(t, 30, 20)
+	copy(data[40:], make([]byte, len(data)-40))
+	upload, err := svc.CreateResumableUpload(ctx, ResumableInput{Filename: "broken.png", Length: int64(len(data))})
+	if err != nil {
+		t.Fatalf("CreateResumableUpload returned error: %v", err)
+	}
+	if _, err := svc.AppendResumableUpload(ctx, upload.ID, 0, bytes.NewReader(data), nil); err != nil {
+		t.Fatalf("AppendResumableUpload returned error: %v", err)
+	}
+	tasks[0](context.Background())
+
+	var domainErr *Error
+	if _, err := svc.GetResumableUpload(ctx, upload.ID); !errors.As(err, &domainErr) || domainErr.Code != "invalid_image" {
+		t.Fatalf("expected the upload to report the refused image, got %v", err)
+	}
+	if _, err := svc.AppendResumableUpload(ctx, upload.ID, 0, bytes.NewReader(data), nil); !IsKind(err, KindValidation) || len(tasks) != 1 {
+		t.Errorf("expected a retry to report the failure without assembling again, got %v (%d tasks)", err, len(tasks))
+	}
+	if err := svc.CancelResumableUpload(ctx, upload.ID); err != nil {
+		t.Errorf("expected a refused upload to be cancellable, got %v", err)
+	}
+}
+
+func TestResumableUploadRaceKeepsWinningPart(t *testing.T) {
+	svc, db := newTestService(t)
+	dir := useLocalStorage(t, svc)
+	assembleInline(svc)
+	author := createUser(t, db, "author@example.com", models.RoleAuthor)
+	ctx := WithUserID(context.Background(), author.ID)
+
+	data := []byte("%PDF-1.4\nraced")
+	upload, err := svc.CreateResumableUpload(ctx, ResumableInput{Filename: "raced.pdf", Length: int64(len(data))})
+	if err != nil {
+		t.Fatalf("CreateResumableUpload returned error: %v", err)
+	}
+
+	// Two requests read the upload at offset 0 and both write a part
+	upload.MimeType = "application/pdf"
+	stale := *upload
+	if err := svc.appendResumablePart(ctx, upload, data[:9]); err != nil {
+		t.Fatalf("appendResumablePart returned error: %v", err)
+	}
+	if err := svc.appendResumablePart(ctx, &stale, []byte("%PDF-1.7\n")); !IsKind(err, KindConflict) {
+		t.Fatalf("expected the slower request to conflict, got %v", err)
+	}
+	if n := partFiles(t, dir, upload.ID); n != 1 {
+		t.Fatalf("expected only the winning part to be kept, found %d", n)
+	}
+
+	if _, err := svc.AppendResumableUpload(ctx, upload.ID, 9, bytes.NewReader(data[9:]), nil); err != nil {
+		t.Fatalf("AppendResumableUpload returned error: %v", err)
+	}
+	upload, _ = svc.GetResumableUpload(ctx, upload.ID)
+	stored, err := os.ReadFile(filepath.Join(dir, upload.Media.StorageKey))
+	if err != nil || !bytes.Equal(stored, data) {
+		t.Errorf("expected the winning part in the assembled file, got %q (%v)", stored, err)
+	}
+}
+
+func TestResumableUploadImage(t *testing.T) {
+	svc, db := newTestService(t)
+	useLocalStorage(t, svc)
+	author := createUser(t, db, "author@example.com", models.RoleAuthor)
+	ctx := WithUserID(context.Background(), author.ID)
+
+	var tasks []func(context.Context)
+	WithBackground(func(name string, fn func(ctx context.Context)) {
+		tasks = append(tasks, fn)
+	})(svc)
+
+	data := pngBytes(t, 30, 20)
+	upload, err := svc.CreateResumableUpload(ctx, ResumableInput{Filename: "shot.png", Length: int64(len(data))})
+	if err != nil {
+		t.Fatalf("CreateResumableUpload returned error: %v", err)
+	}
+	half := len(data) / 2
+	if _, err := svc.AppendResumableUpload(ctx, upload.ID, 0, bytes.NewReader(data[:half]), nil); err != nil {
+		t.Fatalf("AppendResumableUpload returned error: %v", err)
+	}
+	if _, err := svc.AppendResumableUpload(ctx, upload.ID, int64(half), bytes.NewReader(data[half:]), nil); err != nil {
+		t.Fatalf("AppendResumableUpload returned error: %v", err)
+	}
+	// A retry while the assembly runs does not start another
+	if _, err := svc.AppendResumableUpload(ctx, upload.ID, int64(half), bytes.NewReader(data[half:]), nil); err != nil {
+		t.Fatalf("AppendResumableUpload returned error: %v", err)
+	}
+	if len(tasks) != 1 {
+		t.Fatalf("expected the assembly to be handed to the background runner once, got %d tasks", len(tasks))
+	}
+	if upload, _ = svc.GetResumableUpload(ctx, upload.ID); upload.Media != nil {
+		t.Fatalf("expected no media item before the assembly ran, got %+v", upload.Media)
+	}
+	tasks[0](context.Background())
+	upload, _ = svc.GetResumableUpload(ctx, upload.ID)
+	if upload.Media == nil || upload.Media.Width != 30 || upload.Media.Height != 20 {
+		t.Errorf("expected images to be processed like direct uploads, got %+v", upload.Media)
+	}
+}
+
+func TestPurgeExpiredResumableUploads(t *testing.T) {
+	svc, db := newTestService(t)
+	dir := useLocalStorage(t, svc)
+	author := createUser(t, db, "author@example.com", models.RoleAuthor)
+	ctx := WithUserID(context.Background(), author.ID)
+
+	upload, err := svc.CreateResumableUpload(ctx, ResumableInput{Filename: "demo.pdf", Length: 100})
+	if err != nil {
+		t.Fatalf("CreateResumableUpload returned error: %v", err)
+	}
+	if _, err := svc.AppendResumableUpload(ctx, upload.ID, 0, bytes.NewReader([]byte("%PDF-1.4\n")), nil); err != nil {
+		t.Fatalf("AppendResumableUpload returned error: %v", err)
+	}
+
+	if n, err := svc.PurgeExpiredResumableUploads(ctx); err != nil || n != 0 {
+		t.Fatalf("expected nothing to purge yet, got %d (%v)", n, err)
+	}
+	db.Model(&models.ResumableUpload{}).Where("id = ?", upload.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	if _, err := svc.GetResumableUpload(ctx, upload.ID); !IsKind(err, KindNotFound) {
+		t.Errorf("expected expired uploads to be gone, got %v", err)
+	}
+	if n, err := svc.PurgeExpiredResumableUploads(ctx); err != nil || n != 1 {
+		t.Fatalf("expected one upload to be purged, got %d (%v)", n, err)
+	}
+	if n := partFiles(t, dir, upload.ID); n != 0 {
+		t.Errorf("expected the parts of expired uploads to be removed, found %d", n)
+	}
+}
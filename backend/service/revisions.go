@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"blog-backend/models"
+	"blog-backend/repository"
+	"blog-backend/tracing"
+	"blog-backend/utils"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RevisionRetention limits the revisions kept per post. Zero values disable
+// the respective limit; the newest revision is never pruned.
+type RevisionRetention struct {
+	MaxCount int
+	MaxAge   time.Duration
+}
+
+// WithRevisionRetention sets the revision pruning policy
+func WithRevisionRetention(retention RevisionRetention) Option {
+	return func(s *Service) {
+		s.revisionRetention = retention
+	}
+}
+
+// RevisionDiff is a line-level comparison of two revisions of a post
+type RevisionDiff struct {
+	From        *models.PostRevision `json:"from"`
+	To          *models.PostRevision `json:"to"`
+	Title       []utils.DiffLine     `json:"title"`
+	Excerpt     []utils.DiffLine     `json:"excerpt"`
+	Content     []utils.DiffLine     `json:"content"`
+	TagsAdded   []string             `json:"tagsAdded"`
+	TagsRemoved []string             `json:"tagsRemoved"`
+}
+
+// savePost writes post (every editable column when fields is nil) and records
+// a revision in the same transaction when its text changed from before
+func (s *Service) savePost(ctx context.Context, before, post *models.Post, fields []string, ifMatch []string) error {
+	err := s.repo.Transaction(ctx, func(tx *repository.Repository) error {
+		var rows int64
+		var err error
+		if fields == nil {
+			rows, err = tx.UpdatePost(ctx, post)
+		} else {
+			rows, err = tx.UpdatePostFields(ctx, post, fields)
+		}
+		if err != nil {
+			return translate(err, "post")
+		}
+		trace.SpanFromContext(ctx).SetAttributes(tracing.RowsAffected(rows))
+		if rows == 0 {
+			return staleWrite(ifMatch, "post")
+		}
+
+		if sameText(before, post) {
+			return nil
+		}
+		return s.recordRevision(ctx, tx, before, post)
+	})
+	if err == nil {
+		s.notifyPostsChanged()
+		if before == nil || post.Content != before.Content {
+			s.trackMediaReferences(ctx, models.MediaOwnerPost, post.ID, post.Content)
+		}
+	}
+	return err
+}
+
+// recordRevision snapshots post as edited by the current user. A post without
+// history first gets a baseline revision of its previous text, attributed to
+// its author, so the original can always be restored.
+func (s *Service) recordRevision(ctx context.Context, tx *repository.Repository, before, post *models.Post) error {
+	count, err := tx.CountPostRevisions(ctx, post.ID)
+	if err != nil {
+		return err
+	}
+	if count == 0 && before != nil {
+		if err := tx.CreatePostRevision(ctx, newRevision(before, before.AuthorID)); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.CreatePostRevision(ctx, newRevision(post, UserIDFromContext(ctx))); err != nil {
+		return err
+	}
+
+	var cutoff time.Time
+	if s.revisionRetention.MaxAge > 0 {
+		cutoff = time.Now().Add(-s.revisionRetention.MaxAge)
+	}
+	_, err = tx.PrunePostRevisions(ctx, post.ID, s.revisionRetention.MaxCount, cutoff)
+	return err
+}
+
+// ListPostRevisions returns the revision history of a post, newest first
+func (s *Service) ListPostRevisions(ctx context.Context, slug string) ([]models.PostRevision, error) {
+	ctx, span := tracing.Start(ctx, "Service.ListPostRevisions", tracing.PostSlug(slug))
+	defer span.End()
+
+	_, post, err := s.editablePost(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	revisions, err := s.repo.ListPostRevisions(ctx, post.ID)
+	return revisions, tracing.RecordError(span, err)
+}
+
+// GetPostRevision returns a single revision of a post including its content
+func (s *Service) GetPostRevision(ctx context.Context, slug string, id uint) (*models.PostRevision, error) {
+	ctx, span := tracing.Start(ctx, "Service.GetPostRevision", tracing.PostSlug(slug))
+	defer span.End()
+
+	_, post, err := s.editablePost(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	revision, err := s.repo.FindPostRevision(ctx, post.ID, id)
+	return revision, tracing.RecordError(span, translate(err, "revision"))
+}
+
+// DiffPostRevisions compares two revisions of a post line by line
+func (s *Service) DiffPostRevisions(ctx context.Context, slug string, fromID, toID uint) (*RevisionDiff, error) {
+	ctx, span := tracing.Start(ctx, "Service.DiffPostRevisions", tracing.PostSlug(slug))
+	defer span.End()
+
+	_, post, err := s.editablePost(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	from, err := s.repo.FindPostRevision(ctx, post.ID, fromID)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "revision"))
+	}
+	to, err := s.repo.FindPostRevision(ctx, post.ID, toID)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "revision"))
+	}
+
+	diff := &RevisionDiff{
+		From:    from,
+		To:      to,
+		Title:   utils.DiffLines(from.Title, to.Title),
+		Excerpt: utils.DiffLines(from.Excerpt, to.Excerpt),
+		Content: utils.DiffLines(from.Content, to.Content),
+	}
+	for _, tag := range to.Tags {
+		if !slices.Contains(from.Tags, tag) {
+			diff.TagsAdded = append(diff.TagsAdded, tag)
+		}
+	}
+	for _, tag := range from.Tags {
+		if !slices.Contains(to.Tags, tag) {
+			diff.TagsRemoved = append(diff.TagsRemoved, tag)
+		}
+	}
+	return diff, nil
+}
+
+// RestorePostRevision copies the text of a revision back onto the post. The
+// restore is itself recorded as a new revision.
+func (s *Service) RestorePostRevision(ctx context.Context, slug string, id uint, ifMatch []string) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Service.RestorePostRevision", tracing.PostSlug(slug))
+	defer span.End()
+
+	_, post, err := s.writablePost(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	if err := checkIfMatch(ifMatch, post.ETag(), "post"); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	revision, err := s.repo.FindPostRevision(ctx, post.ID, id)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "revision"))
+	}
+
+	before := *post
+	post.Title = revision.Title
+	post.Excerpt = revision.Excerpt
+	post.Content = revision.Content
+	post.Tags = revision.Tags
+
+	if err := s.savePost(ctx, &before, post, nil, ifMatch); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return post, nil
+}
+
+func newRevision(post *models.Post, editorID uint) *models.PostRevision {
+	return &models.PostRevision{
+		PostID:   post.ID,
+		Version:  post.Version,
+		Title:    post.Title,
+		Excerpt:  post.Excerpt,
+		Content:  post.Content,
+		Tags:     post.Tags,
+		EditorID: editorID,
+	}
+}
+
+func sameText(a, b *models.Post) bool {
+	return a.Title == b.Title && a.Excerpt == b.Excerpt && a.Content == b.Content && slices.Equal(a.Tags, b.Tags)
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"blog-backend/models"
+	"blog-backend/repository"
+	"blog-backend/utils"
+)
+
+func TestUpdatePostRecordsRevisions(t *testing.T) {
+	svc, db := newTestService(t)
+	post := createPost(t, db, "history")
+	editor := createUser(t, db, "editor@example.com", models.RoleEditor)
+	ctx := WithUserID(context.Background(), editor.ID)
+
+	if _, err := svc.UpdatePost(ctx, "history", &models.Post{Title: "Second", Content: "Body", Excerpt: "Short"}, nil); err != nil {
+		t.Fatalf("UpdatePost returned error: %v", err)
+	}
+	// Unchanged text must not add a revision
+	if _, err := svc.UpdatePost(ctx, "history", &models.Post{Title: "Second", Content: "Body", Excerpt: "Short", ReadTime: 4}, nil); err != nil {
+		t.Fatalf("UpdatePost returned error: %v", err)
+	}
+
+	revisions, err := svc.ListPostRevisions(ctx, "history")
+	if err != nil {
+		t.Fatalf("ListPostRevisions returned error: %v", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("expected baseline and edit revisions, got %d", len(revisions))
+	}
+	if revisions[0].Title != "Second" || revisions[0].EditorID != editor.ID {
+		t.Errorf("unexpected newest revision: %+v", revisions[0])
+	}
+	if revisions[1].Title != "Original" || revisions[1].EditorID != post.AuthorID {
+		t.Errorf("unexpected baseline revision: %+v", revisions[1])
+	}
+}
+
+func TestRestorePostRevision(t *testing.T) {
+	svc, db := newTestService(t)
+	createPost(t, db, "restore")
+	ctx := editorContext(t, db)
+
+	if _, err := svc.PatchPost(ctx, "restore", Patch{"content": []byte(`"Rewritten"`)}, nil); err != nil {
+		t.Fatalf("PatchPost returned error: %v", err)
+	}
+	revisions, _ := svc.ListPostRevisions(ctx, "restore")
+	baseline := revisions[len(revisions)-1]
+
+	restored, err := svc.RestorePostRevision(ctx, "restore", baseline.ID, nil)
+	if err != nil {
+		t.Fatalf("RestorePostRevision returned error: %v", err)
+	}
+	if restored.Content != "Body" {
+		t.Errorf("expected original content, got %q", restored.Content)
+	}
+
+	revisions, _ = svc.ListPostRevisions(ctx, "restore")
+	if len(revisions) != 3 {
+		t.Errorf("expected the restore to be recorded as a revision, got %d revisions", len(revisions))
+	}
+
+	if _, err := svc.RestorePostRevision(ctx, "restore", 999, nil); !IsKind(err, KindNotFound) {
+		t.Errorf("expected not found for a missing revision, got %v", err)
+	}
+}
+
+func TestDiffPostRevisions(t *testing.T) {
+	svc, db := newTestService(t)
+	createPost(t, db, "diff")
+	ctx := editorContext(t, db)
+
+	if _, err := svc.UpdatePost(ctx, "diff", &models.Post{Title: "Original", Content: "Body\nMore", Excerpt: "Short"}, nil); err != nil {
+		t.Fatalf("UpdatePost returned error: %v", err)
+	}
+	revisions, _ := svc.ListPostRevisions(ctx, "diff")
+
+	diff, err := svc.DiffPostRevisions(ctx, "diff", revisions[1].ID, revisions[0].ID)
+	if err != nil {
+		t.Fatalf("DiffPostRevisions returned error: %v", err)
+	}
+	last := diff.Content[len(diff.Content)-1]
+	if last != (utils.DiffLine{Op: "insert", Text: "More"}) {
+		t.Errorf("expected an inserted line, got %+v", diff.Content)
+	}
+	if len(diff.Title) != 1 || diff.Title[0].Op != "equal" {
+		t.Errorf("expected an unchanged title, got %+v", diff.Title)
+	}
+}
+
+func TestRevisionRetentionPrunesOldest(t *testing.T) {
+	_, db := newTestService(t)
+	svc := NewService(repository.NewRepository(db), WithRevisionRetention(RevisionRetention{MaxCount: 2}))
+	createPost(t, db, "pruned")
+	ctx := editorContext(t, db)
+
+	for _, title := range []string{"One", "Two", "Three"} {
+		if _, err := svc.UpdatePost(ctx, "pruned", &models.Post{Title: title, Content: "Body", Excerpt: "Short"}, nil); err != nil {
+			t.Fatalf("UpdatePost returned error: %v", err)
+		}
+	}
+
+	revisions, _ := svc.ListPostRevisions(ctx, "pruned")
+	if len(revisions) != 2 || revisions[0].Title != "Three" || revisions[1].Title != "Two" {
+		t.Errorf("expected the two newest revisions, got %+v", revisions)
+	}
+}
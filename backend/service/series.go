@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"blog-backend/logging"
+	"blog-backend/models"
+	"blog-backend/tracing"
+	"blog-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// SeriesInput creates or updates a series. Slug defaults to one generated
+// from the title and cannot be changed afterwards.
+type SeriesInput struct {
+	Title       string `json:"title" binding:"required,max=200"`
+	Slug        string `json:"slug" binding:"omitempty,max=200"`
+	Description string `json:"description" binding:"max=2000"`
+}
+
+// ListSeries returns every series without its posts
+func (s *Service) ListSeries(ctx context.Context) ([]models.Series, error) {
+	ctx, span := tracing.Start(ctx, "Service.ListSeries")
+	defer span.End()
+
+	series, err := s.repo.ListSeries(ctx)
+	return series, tracing.RecordError(span, err)
+}
+
+// GetSeries returns a series with its published posts in order
+func (s *Service) GetSeries(ctx context.Context, slug string) (*models.Series, error) {
+	ctx, span := tracing.Start(ctx, "Service.GetSeries")
+	defer span.End()
+
+	series, err := s.repo.FindSeriesBySlug(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "series"))
+	}
+	if err := s.loadSeriesPosts(ctx, series, true); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return series, nil
+}
+
+func (s *Service) CreateSeries(ctx context.Context, input SeriesInput) (*models.Series, error) {
+	ctx, span := tracing.Start(ctx, "Service.CreateSeries")
+	defer span.End()
+
+	if err := s.requireEditor(ctx, "series_forbidden", "Only editors may change series"); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	series := &models.Series{
+		Title:       input.Title,
+		Slug:        input.Slug,
+		Description: input.Description,
+		Posts:       []models.SeriesPost{},
+	}
+	if series.Slug == "" {
+		series.Slug = utils.GenerateSlug(input.Title)
+	}
+	if err := s.repo.CreateSeries(ctx, series); err != nil {
+		return nil, tracing.RecordError(span, translate(err, "series"))
+	}
+	return series, nil
+}
+
+// UpdateSeries replaces the title and description of a series
+func (s *Service) UpdateSeries(ctx context.Context, slug string, input SeriesInput) (*models.Series, error) {
+	ctx, span := tracing.Start(ctx, "Service.UpdateSeries")
+	defer span.End()
+
+	if err := s.requireEditor(ctx, "series_forbidden", "Only editors may change series"); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	series, err := s.repo.FindSeriesBySlug(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "series"))
+	}
+
+	series.Title = input.Title
+	series.Description = input.Description
+	if err := s.repo.UpdateSeries(ctx, series); err != nil {
+		return nil, tracing.RecordError(span, translate(err, "series"))
+	}
+	if err := s.loadSeriesPosts(ctx, series, false); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return series, nil
+}
+
+// DeleteSeries removes a series; its posts stay published on their own
+func (s *Service) DeleteSeries(ctx context.Context, slug string) error {
+	ctx, span := tracing.Start(ctx, "Service.DeleteSeries")
+	defer span.End()
+
+	if err := s.requireEditor(ctx, "series_forbidden", "Only editors may change series"); err != nil {
+		return tracing.RecordError(span, err)
+	}
+
+	series, err := s.repo.FindSeriesBySlug(ctx, slug)
+	if err != nil {
+		return tracing.RecordError(span, translate(err, "series"))
+	}
+	return tracing.RecordError(span, translate(s.repo.DeleteSeries(ctx, series), "series"))
+}
+
+// SetSeriesPosts sets the posts of a series and their order from a list of
+// post slugs. Posts are moved out of any other series they belonged to.
+func (s *Service) SetSeriesPosts(ctx context.Context, slug string, postSlugs []string) (*models.Series, error) {
+	ctx, span := tracing.Start(ctx, "Service.SetSeriesPosts")
+	defer span.End()
+
+	if err := s.requireEditor(ctx, "series_forbidden", "Only editors may change series"); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	series, err := s.repo.FindSeriesBySlug(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "series"))
+	}
+
+	postIDs := make([]uint, 0, len(postSlugs))
+	seen := make(map[string]bool, len(postSlugs))
+	for _, postSlug := range postSlugs {
+		if seen[postSlug] {
+			return nil, tracing.RecordError(span, Validation("duplicate_series_post", "A post can only appear once in a series",
+				map[string]string{"posts": fmt.Sprintf("%q is listed more than once", postSlug)}))
+		}
+		seen[postSlug] = true
+
+		post, err := s.repo.FindPostBySlug(ctx, postSlug)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, tracing.RecordError(span, Validation("unknown_series_post", "The series lists a post that does not exist",
+				map[string]string{"posts": fmt.Sprintf("%q does not exist", postSlug)}))
+		}
+		if err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+		postIDs = append(postIDs, post.ID)
+	}
+
+	if err := s.repo.SetSeriesPosts(ctx, series.ID, postIDs); err != nil {
+		return nil, tracing.RecordError(span, translate(err, "series"))
+	}
+	if err := s.loadSeriesPosts(ctx, series, false); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return series, nil
+}
+
+// loadSeriesPosts fills series.Posts, numbering the posts from 1 so trashed
+// posts, and unpublished ones if publishedOnly is set, leave no gaps
+func (s *Service) loadSeriesPosts(ctx context.Context, series *models.Series, publishedOnly bool) error {
+	list := s.repo.ListSeriesEntries
+	if publishedOnly {
+		list = s.repo.ListPublishedSeriesEntries
+	}
+	entries, err := list(ctx, series.ID)
+	if err != nil {
+		return err
+	}
+
+	series.Posts = make([]models.SeriesPost, len(entries))
+	for i, entry := range entries {
+		series.Posts[i] = models.SeriesPost{
+			Position:  i + 1,
+			Title:     entry.Post.Title,
+			Slug:      entry.Post.Slug,
+			Excerpt:   entry.Post.Excerpt,
+			Published: entry.Post.Published,
+		}
+	}
+	return nil
+}
+
+// seriesNav locates post within its series, or returns nil if it is not part
+// of one. With publishedOnly the navigation skips unpublished posts.
+func (s *Service) seriesNav(ctx context.Context, post *models.Post, publishedOnly bool) (*models.SeriesNav, error) {
+	entry, err := s.repo.FindSeriesEntry(ctx, post.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	series := entry.Series
+	if err := s.loadSeriesPosts(ctx, &series, publishedOnly); err != nil {
+		return nil, err
+	}
+
+	nav := &models.SeriesNav{
+		ID:    series.ID,
+		Title: series.Title,
+		Slug:  series.Slug,
+		Total: len(series.Posts),
+	}
+	for i := range series.Posts {
+		if series.Posts[i].Slug != post.Slug {
+			continue
+		}
+		nav.Position = series.Posts[i].Position
+		if i > 0 {
+			nav.Previous = &series.Posts[i-1]
+		}
+		if i+1 < len(series.Posts) {
+			nav.Next = &series.Posts[i+1]
+		}
+	}
+	return nav, nil
+}
+
+// refreshSeriesNav gives the other posts in the series of post a new version
+// after post left or rejoined it. The change itself has already been made, so
+// a failure is only logged.
+func (s *Service) refreshSeriesNav(ctx context.Context, post *models.Post) {
+	if err := s.repo.BumpSeriesVersions(ctx, post.ID); err != nil {
+		logging.Printf(ctx, "Failed to refresh the series of post %s: %v", post.Slug, err)
+	}
+}
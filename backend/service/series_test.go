@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"blog-backend/models"
+)
+
+func TestSeriesNavigation(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	for _, slug := range []string{"part-1", "part-2", "part-3"} {
+		publishPost(t, db, createPost(t, db, slug))
+	}
+	if _, err := svc.CreateSeries(WithUserID(context.Background(), createUser(t, db, "author@example.com", models.RoleAuthor).ID),
+		SeriesInput{Title: "Mine"}); !IsKind(err, KindForbidden) {
+		t.Errorf("expected authors to be refused, got %v", err)
+	}
+
+	series, err := svc.CreateSeries(ctx, SeriesInput{Title: "Go Tutorial"})
+	if err != nil {
+		t.Fatalf("CreateSeries returned error: %v", err)
+	}
+	if series.Slug != "go-tutorial" {
+		t.Errorf("expected a generated slug, got %q", series.Slug)
+	}
+
+	if _, err := svc.SetSeriesPosts(ctx, series.Slug, []string{"part-1", "part-2", "part-3"}); err != nil {
+		t.Fatalf("SetSeriesPosts returned error: %v", err)
+	}
+	post, err := svc.GetPost(ctx, "part-2")
+	if err != nil {
+		t.Fatalf("GetPost returned error: %v", err)
+	}
+	nav := post.Series
+	if nav == nil || nav.Title != "Go Tutorial" || nav.Position != 2 || nav.Total != 3 {
+		t.Fatalf("unexpected series info: %+v", nav)
+	}
+	if nav.Previous == nil || nav.Previous.Slug != "part-1" || nav.Next == nil || nav.Next.Slug != "part-3" {
+		t.Errorf("unexpected previous/next: %+v %+v", nav.Previous, nav.Next)
+	}
+
+	// Reorder and drop a post
+	if _, err := svc.SetSeriesPosts(ctx, series.Slug, []string{"part-3", "part-1"}); err != nil {
+		t.Fatalf("SetSeriesPosts returned error: %v", err)
+	}
+	post, _ = svc.GetPost(ctx, "part-1")
+	if post.Series.Position != 2 || post.Series.Previous.Slug != "part-3" || post.Series.Next != nil {
+		t.Errorf("unexpected series info after reorder: %+v", post.Series)
+	}
+	post, _ = svc.GetPost(ctx, "part-2")
+	if post.Series != nil {
+		t.Errorf("expected dropped post to have no series, got %+v", post.Series)
+	}
+
+	// Trashed posts leave no gap
+	if err := svc.DeletePost(ctx, "part-3", nil); err != nil {
+		t.Fatalf("DeletePost returned error: %v", err)
+	}
+	got, err := svc.GetSeries(ctx, series.Slug)
+	if err != nil {
+		t.Fatalf("GetSeries returned error: %v", err)
+	}
+	if len(got.Posts) != 1 || got.Posts[0].Slug != "part-1" || got.Posts[0].Position != 1 {
+		t.Errorf("unexpected series posts: %+v", got.Posts)
+	}
+}
+
+func TestSetSeriesPostsRejectsInvalidLists(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	createPost(t, db, "only")
+	series, _ := svc.CreateSeries(ctx, SeriesInput{Title: "Series", Slug: "series"})
+
+	for _, posts := range [][]string{{"missing"}, {"only", "only"}} {
+		if _, err := svc.SetSeriesPosts(ctx, series.Slug, posts); !IsKind(err, KindValidation) {
+			t.Errorf("expected validation error for %v, got %v", posts, err)
+		}
+	}
+	if _, err := svc.GetSeries(ctx, "nope"); !IsKind(err, KindNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestPublicSeriesSkipsUnpublishedPosts(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	publishPost(t, db, createPost(t, db, "part-1"))
+	createPost(t, db, "part-2")
+	publishPost(t, db, createPost(t, db, "part-3"))
+	series, _ := svc.CreateSeries(ctx, SeriesInput{Title: "Series", Slug: "series"})
+	if _, err := svc.SetSeriesPosts(ctx, series.Slug, []string{"part-1", "part-2", "part-3"}); err != nil {
+		t.Fatalf("SetSeriesPosts returned error: %v", err)
+	}
+
+	got, err := svc.GetSeries(context.Background(), series.Slug)
+	if err != nil {
+		t.Fatalf("GetSeries returned error: %v", err)
+	}
+	if len(got.Posts) != 2 || got.Posts[1].Slug != "part-3" || got.Posts[1].Position != 2 {
+		t.Errorf("expected only the published posts, got %+v", got.Posts)
+	}
+	post, _ := svc.GetPost(context.Background(), "part-1")
+	if post.Series.Total != 2 || post.Series.Next == nil || post.Series.Next.Slug != "part-3" {
+		t.Errorf("expected navigation to skip the draft, got %+v", post.Series)
+	}
+
+	managed, _ := svc.GetManagedPost(ctx, "part-1")
+	if managed.Series.Total != 3 || managed.Series.Next.Slug != "part-2" {
+		t.Errorf("expected editors to see the draft, got %+v", managed.Series)
+	}
+}
+
+func TestSeriesChangesBumpPostVersions(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	for _, slug := range []string{"part-1", "part-2", "part-3"} {
+		publishPost(t, db, createPost(t, db, slug))
+	}
+	series, _ := svc.CreateSeries(ctx, SeriesInput{Title: "Series", Slug: "series"})
+
+	etag := func(slug string) string {
+		post, err := svc.GetPost(context.Background(), slug)
+		if err != nil {
+			t.Fatalf("GetPost returned error: %v", err)
+		}
+		return post.ETag()
+	}
+	changed := func(step string, change func() error) {
+		before := etag("part-1")
+		if err := change(); err != nil {
+			t.Fatalf("%s returned error: %v", step, err)
+		}
+		if etag("part-1") == before {
+			t.Errorf("expected %s to change the ETag of part-1", step)
+		}
+	}
+
+	changed("adding posts", func() error {
+		_, err := svc.SetSeriesPosts(ctx, series.Slug, []string{"part-1", "part-2"})
+		return err
+	})
+	changed("appending a post", func() error {
+		_, err := svc.SetSeriesPosts(ctx, series.Slug, []string{"part-1", "part-2", "part-3"})
+		return err
+	})
+	changed("renaming the series", func() error {
+		_, err := svc.UpdateSeries(ctx, series.Slug, SeriesInput{Title: "Renamed"})
+		return err
+	})
+	changed("archiving a neighbour", func() error {
+		_, err := svc.TransitionPost(ctx, "part-2", TransitionRequest{Status: models.StatusArchived}, nil)
+		return err
+	})
+	changed("trashing a neighbour", func() error {
+		return svc.DeletePost(ctx, "part-3", nil)
+	})
+	changed("deleting the series", func() error {
+		return svc.DeleteSeries(ctx, series.Slug)
+	})
+}
@@ -1,124 +1,453 @@
 package service
 
 import (
+	"blog-backend/imaging"
+	"blog-backend/mail"
+	"blog-backend/metrics"
 	"blog-backend/models"
 	"blog-backend/repository"
+	"blog-backend/spam"
+	"blog-backend/storage"
+	"blog-backend/tracing"
 	"blog-backend/utils"
-	"errors"
+	"context"
+	"fmt"
 	"golang.org/x/crypto/bcrypt"
+	"sync"
+	"time"
 )
 
+var errInvalidCredentials = Unauthorized("invalid_credentials", "Invalid email or password")
+
 // Service handles business logic
 type Service struct {
-	repo *repository.Repository
+	repo              *repository.Repository
+	revisionRetention RevisionRetention
+	trashRetention    time.Duration
+	previewTTL        time.Duration
+	postsChanged      chan struct{}
+	spamFilter        *spam.Pipeline
+	spamThreshold     float64
+	mailer            mail.Mailer
+	contactNotify     []string
+	background        func(name string, fn func(ctx context.Context))
+	assembling        sync.Map // IDs of resumable uploads being assembled
+
+	store                storage.Backend
+	uploadLimits         UploadLimits
+	images               *imaging.Processor
+	maxChunkSize         int64
+	resumableExpiry      time.Duration
+	mediaOrphanRetention time.Duration
+}
+
+// Option configures optional Service behaviour
+type Option func(*Service)
+
+// WithBackground runs the tasks requests leave behind, such as notification
+// emails and assembling resumable uploads, through run, so that shutdown can
+// wait for them. The lifecycle manager's Go fits.
+func WithBackground(run func(name string, fn func(ctx context.Context))) Option {
+	return func(s *Service) {
+		s.background = run
+	}
 }
 
 // NewService creates a new service instance
-func NewService(repo *repository.Repository) *Service {
-	return &Service{repo: repo}
+func NewService(repo *repository.Repository, opts ...Option) *Service {
+	s := &Service{
+		repo:            repo,
+		postsChanged:    make(chan struct{}, 1),
+		uploadLimits:    DefaultUploadLimits(),
+		maxChunkSize:    defaultMaxChunkSize,
+		resumableExpiry: defaultResumableExpiry,
+		background: func(_ string, fn func(ctx context.Context)) {
+			go fn(context.Background())
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Auth operations
-func (s *Service) Login(email, password string) (*models.User, string, error) {
-	user, err := s.repo.FindUserByEmail(email)
+func (s *Service) Login(ctx context.Context, email, password string) (*models.User, string, error) {
+	ctx, span := tracing.Start(ctx, "Service.Login")
+	defer span.End()
+
+	user, err := s.repo.FindUserByEmail(ctx, email)
 	if err != nil {
-		return nil, "", errors.New("invalid credentials")
+		metrics.RecordLogin(false)
+		return nil, "", errInvalidCredentials
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, "", errors.New("invalid credentials")
+		metrics.RecordLogin(false)
+		return nil, "", errInvalidCredentials
 	}
+	metrics.RecordLogin(true)
+	span.SetAttributes(tracing.UserID(user.ID))
 
 	token, err := utils.GenerateToken(*user)
 	if err != nil {
-		return nil, "", err
+		return nil, "", tracing.RecordError(span, err)
 	}
 
 	return user, token, nil
 }
 
-func (s *Service) Register(name, email, password string) (*models.User, string, error) {
+func (s *Service) Register(ctx context.Context, name, email, password string) (*models.User, string, error) {
+	ctx, span := tracing.Start(ctx, "Service.Register")
+	defer span.End()
+
 	// Check if user exists
-	if _, err := s.repo.FindUserByEmail(email); err == nil {
-		return nil, "", errors.New("email already registered")
+	if _, err := s.repo.FindUserByEmail(ctx, email); err == nil {
+		return nil, "", Conflict("email_taken", "Email is already registered")
 	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, "", err
+		return nil, "", tracing.RecordError(span, err)
 	}
 
 	user := &models.User{
 		Name:     name,
 		Email:    email,
 		Password: string(hashedPassword),
+		Role:     models.RoleAuthor,
 	}
 
-	if err := s.repo.CreateUser(user); err != nil {
-		return nil, "", err
+	if err := s.repo.CreateUser(ctx, user); err != nil {
+		return nil, "", tracing.RecordError(span, translate(err, "user"))
 	}
 
 	token, err := utils.GenerateToken(*user)
 	if err != nil {
-		return nil, "", err
+		return nil, "", tracing.RecordError(span, err)
 	}
 
 	return user, token, nil
 }
 
 // Post operations
-func (s *Service) ListPosts() ([]models.Post, error) {
-	return s.repo.ListPosts()
+
+// ListPosts returns the published posts, newest first
+func (s *Service) ListPosts(ctx context.Context) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Service.ListPosts")
+	defer span.End()
+
+	posts, err := s.repo.ListPublishedPosts(ctx)
+	return posts, tracing.RecordError(span, translate(err, "post"))
 }
 
-func (s *Service) GetPost(slug string) (*models.Post, error) {
-	return s.repo.FindPostBySlug(slug)
+// GetPost returns a published post with its series navigation. Posts in
+// other workflow states are not found.
+func (s *Service) GetPost(ctx context.Context, slug string) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Service.GetPost", tracing.PostSlug(slug))
+	defer span.End()
+
+	post, err := s.repo.FindPublishedPostBySlug(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "post"))
+	}
+
+	post.Series, err = s.seriesNav(ctx, post, true)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return post, nil
 }
 
-func (s *Service) CreatePost(post *models.Post) error {
-	return s.repo.CreatePost(post)
+// ListManagedPosts returns the posts the current user may edit in every
+// workflow state, newest first: all of them for editors, otherwise their own
+func (s *Service) ListManagedPosts(ctx context.Context) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Service.ListManagedPosts")
+	defer span.End()
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	authorID := user.ID
+	if user.IsEditor() {
+		authorID = 0
+	}
+
+	posts, err := s.repo.ListPosts(ctx, authorID)
+	return posts, tracing.RecordError(span, translate(err, "post"))
 }
 
-func (s *Service) UpdatePost(post *models.Post) error {
-	return s.repo.UpdatePost(post)
+// GetManagedPost returns a post in any workflow state to an editor or its
+// author
+func (s *Service) GetManagedPost(ctx context.Context, slug string) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Service.GetManagedPost", tracing.PostSlug(slug))
+	defer span.End()
+
+	_, post, err := s.editablePost(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	post.Series, err = s.seriesNav(ctx, post, false)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return post, nil
+}
+
+// CreatePost adds a post by the current user
+func (s *Service) CreatePost(ctx context.Context, post *models.Post) error {
+	ctx, span := tracing.Start(ctx, "Service.CreatePost", tracing.PostSlug(post.Slug))
+	defer span.End()
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return tracing.RecordError(span, err)
+	}
+	// The author is always the caller, never taken from the payload
+	post.AuthorID = user.ID
+	post.Author = models.User{}
+
+	// Only editors may publish directly; everyone else starts with a draft
+	if post.Published {
+		if !user.IsEditor() {
+			return tracing.RecordError(span, Forbidden("publish_forbidden", "Only editors may publish posts"))
+		}
+		post.Status = models.StatusPublished
+	} else {
+		post.Status = models.StatusDraft
+	}
+	post.ScheduledAt = nil
+
+	published := markPublished(post)
+	if err := s.repo.CreatePost(ctx, post); err != nil {
+		return tracing.RecordError(span, translate(err, "post"))
+	}
+	if published {
+		metrics.PostsPublished.Inc()
+	}
+	s.notifyPostsChanged()
+	s.trackMediaReferences(ctx, models.MediaOwnerPost, post.ID, post.Content)
+	return nil
+}
+
+// UpdatePost replaces the editable fields of the post with the given slug.
+// The slug, counters, author and workflow status are kept from the stored
+// post. When ifMatch holds ETags the update only proceeds if one matches the
+// current version. Only editors, and the post's author while it is a draft
+// or in review, may update it.
+func (s *Service) UpdatePost(ctx context.Context, slug string, changes *models.Post, ifMatch []string) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Service.UpdatePost", tracing.PostSlug(slug))
+	defer span.End()
+
+	_, post, err := s.writablePost(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	if err := checkIfMatch(ifMatch, post.ETag(), "post"); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	before := *post
+	post.Title = changes.Title
+	post.Content = changes.Content
+	post.Excerpt = changes.Excerpt
+	post.ReadTime = changes.ReadTime
+	post.Tags = changes.Tags
+	post.SocialData = changes.SocialData
+
+	if err := s.savePost(ctx, &before, post, nil, ifMatch); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return post, nil
 }
 
-func (s *Service) DeletePost(slug string) error {
-	return s.repo.DeletePost(slug)
+// markPublished stamps PublishedAt on a post that is being published for the
+// first time and reports whether it did so
+func markPublished(post *models.Post) bool {
+	if !post.Published || post.PublishedAt != nil {
+		return false
+	}
+	now := time.Now()
+	post.PublishedAt = &now
+	return true
+}
+
+// DeletePost moves a post to the trash. Only editors, and the post's author
+// while it is a draft or in review, may delete it.
+func (s *Service) DeletePost(ctx context.Context, slug string, ifMatch []string) error {
+	ctx, span := tracing.Start(ctx, "Service.DeletePost", tracing.PostSlug(slug))
+	defer span.End()
+
+	_, post, err := s.writablePost(ctx, slug)
+	if err != nil {
+		return tracing.RecordError(span, err)
+	}
+	if err := checkIfMatch(ifMatch, post.ETag(), "post"); err != nil {
+		return tracing.RecordError(span, err)
+	}
+
+	rows, err := s.repo.DeletePost(ctx, post)
+	if err != nil {
+		return tracing.RecordError(span, translate(err, "post"))
+	}
+	span.SetAttributes(tracing.RowsAffected(rows))
+	if rows == 0 {
+		return tracing.RecordError(span, staleWrite(ifMatch, "post"))
+	}
+	s.refreshSeriesNav(ctx, post)
+	s.notifyPostsChanged()
+	return nil
+}
+
+// editablePost loads the post with the given slug in any workflow state if
+// the current user may change it
+func (s *Service) editablePost(ctx context.Context, slug string) (*models.User, *models.Post, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	post, err := s.repo.FindPostBySlug(ctx, slug)
+	if err != nil {
+		return nil, nil, translate(err, "post")
+	}
+	if !mayEdit(user, post) {
+		return nil, nil, Forbidden("post_forbidden", "Only the author and editors may change this post")
+	}
+	return user, post, nil
+}
+
+// writablePost is editablePost for changes to the post. Once a post has left
+// review only editors may change it, so authors cannot alter reviewed or live
+// content.
+func (s *Service) writablePost(ctx context.Context, slug string) (*models.User, *models.Post, error) {
+	user, post, err := s.editablePost(ctx, slug)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !user.IsEditor() && post.Status != models.StatusDraft && post.Status != models.StatusInReview {
+		return nil, nil, Forbidden("post_locked", fmt.Sprintf("Only editors may change a %s post", post.Status))
+	}
+	return user, post, nil
+}
+
+// mayEdit reports whether user is an editor or the author of post
+func mayEdit(user *models.User, post *models.Post) bool {
+	return user.IsEditor() || post.AuthorID == user.ID
 }
 
 // Project operations
-func (s *Service) ListProjects() ([]models.Project, error) {
-	return s.repo.ListProjects()
+func (s *Service) ListProjects(ctx context.Context) ([]models.Project, error) {
+	ctx, span := tracing.Start(ctx, "Service.ListProjects")
+	defer span.End()
+
+	projects, err := s.repo.ListProjects(ctx)
+	return projects, tracing.RecordError(span, translate(err, "project"))
 }
 
-func (s *Service) GetProject(id uint) (*models.Project, error) {
-	return s.repo.FindProjectByID(id)
+func (s *Service) GetProject(ctx context.Context, id uint) (*models.Project, error) {
+	ctx, span := tracing.Start(ctx, "Service.GetProject", tracing.ProjectID(id))
+	defer span.End()
+
+	project, err := s.repo.FindProjectByID(ctx, id)
+	return project, tracing.RecordError(span, translate(err, "project"))
 }
 
-func (s *Service) CreateProject(project *models.Project) error {
-	return s.repo.CreateProject(project)
+func (s *Service) CreateProject(ctx context.Context, project *models.Project) error {
+	ctx, span := tracing.Start(ctx, "Service.CreateProject")
+	defer span.End()
+
+	if err := s.repo.CreateProject(ctx, project); err != nil {
+		return tracing.RecordError(span, translate(err, "project"))
+	}
+	span.SetAttributes(tracing.ProjectID(project.ID))
+	s.trackMediaReferences(ctx, models.MediaOwnerProject, project.ID, projectMediaText(project))
+	return nil
 }
 
-func (s *Service) UpdateProject(project *models.Project) error {
-	return s.repo.UpdateProject(project)
+// UpdateProject replaces the editable fields of the project with the given ID,
+// honouring ifMatch like UpdatePost
+func (s *Service) UpdateProject(ctx context.Context, id uint, changes *models.Project, ifMatch []string) (*models.Project, error) {
+	ctx, span := tracing.Start(ctx, "Service.UpdateProject", tracing.ProjectID(id))
+	defer span.End()
+
+	project, err := s.repo.FindProjectByID(ctx, id)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "project"))
+	}
+	if err := checkIfMatch(ifMatch, project.ETag(), "project"); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	project.Title = changes.Title
+	project.Description = changes.Description
+	project.ShortDescription = changes.ShortDescription
+	project.ImageURL = changes.ImageURL
+	project.Technologies = changes.Technologies
+	project.GithubURL = changes.GithubURL
+	project.LiveURL = changes.LiveURL
+	project.IsVisible = changes.IsVisible
+	project.Category = changes.Category
+	project.Priority = changes.Priority
+
+	rows, err := s.repo.UpdateProject(ctx, project)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "project"))
+	}
+	span.SetAttributes(tracing.RowsAffected(rows))
+	if rows == 0 {
+		return nil, tracing.RecordError(span, staleWrite(ifMatch, "project"))
+	}
+	s.trackMediaReferences(ctx, models.MediaOwnerProject, project.ID, projectMediaText(project))
+	return project, nil
 }
 
-func (s *Service) DeleteProject(id uint) error {
-	return s.repo.DeleteProject(id)
+func (s *Service) DeleteProject(ctx context.Context, id uint, ifMatch []string) error {
+	ctx, span := tracing.Start(ctx, "Service.DeleteProject", tracing.ProjectID(id))
+	defer span.End()
+
+	project, err := s.repo.FindProjectByID(ctx, id)
+	if err != nil {
+		return tracing.RecordError(span, translate(err, "project"))
+	}
+	if err := checkIfMatch(ifMatch, project.ETag(), "project"); err != nil {
+		return tracing.RecordError(span, err)
+	}
+
+	rows, err := s.repo.DeleteProject(ctx, project)
+	if err != nil {
+		return tracing.RecordError(span, translate(err, "project"))
+	}
+	span.SetAttributes(tracing.RowsAffected(rows))
+	if rows == 0 {
+		return tracing.RecordError(span, staleWrite(ifMatch, "project"))
+	}
+	return nil
 }
 
 // Activity operations
-func (s *Service) ListActivities() ([]models.Activity, error) {
-	return s.repo.ListActivities()
+func (s *Service) ListActivities(ctx context.Context) ([]models.Activity, error) {
+	ctx, span := tracing.Start(ctx, "Service.ListActivities")
+	defer span.End()
+
+	activities, err := s.repo.ListActivities(ctx)
+	return activities, tracing.RecordError(span, translate(err, "activity"))
 }
 
-func (s *Service) CreateActivity(activity *models.Activity) error {
-	return s.repo.CreateActivity(activity)
+func (s *Service) CreateActivity(ctx context.Context, activity *models.Activity) error {
+	ctx, span := tracing.Start(ctx, "Service.CreateActivity", tracing.UserID(activity.UserID))
+	defer span.End()
+
+	return tracing.RecordError(span, translate(s.repo.CreateActivity(ctx, activity), "activity"))
 }
 
 // User operations
-func (s *Service) GetUserByID(id uint) (*models.User, error) {
-	return s.repo.FindUserByID(id)
+func (s *Service) GetUserByID(ctx context.Context, id uint) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "Service.GetUserByID", tracing.UserID(id))
+	defer span.End()
+
+	user, err := s.repo.FindUserByID(ctx, id)
+	return user, tracing.RecordError(span, translate(err, "user"))
 }
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"blog-backend/config"
+	"blog-backend/models"
+	"blog-backend/repository"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestService(t *testing.T) (*Service, *gorm.DB) {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := config.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	return NewService(repository.NewRepository(db)), db
+}
+
+func createPost(t *testing.T, db *gorm.DB, slug string) *models.Post {
+	t.Helper()
+
+	post := &models.Post{Title: "Original", Content: "Body", Excerpt: "Short", Slug: slug, Views: 7, Likes: 3, AuthorID: 1}
+	if err := db.Create(post).Error; err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	return post
+}
+
+// editorContext creates an editor and returns a context signed in as them
+func editorContext(t *testing.T, db *gorm.DB) context.Context {
+	t.Helper()
+
+	editor := createUser(t, db, "editor@example.com", models.RoleEditor)
+	return WithUserID(context.Background(), editor.ID)
+}
+
+// publishPost moves post straight to the published state
+func publishPost(t *testing.T, db *gorm.DB, post *models.Post) {
+	t.Helper()
+
+	if err := db.Model(post).Updates(map[string]interface{}{"status": models.StatusPublished, "published": true}).Error; err != nil {
+		t.Fatalf("failed to publish post: %v", err)
+	}
+}
+
+func createProject(t *testing.T, db *gorm.DB) *models.Project {
+	t.Helper()
+
+	project := &models.Project{Title: "Original", Description: "Desc", Priority: 1, UserID: 1}
+	if err := db.Create(project).Error; err != nil {
+		t.Fatalf("failed to create project: %v", err)
+	}
+	return project
+}
+
+func TestUpdatePostUpdatesExistingRow(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	original := createPost(t, db, "hello-world")
+
+	// ID, Slug, counters and author in the payload must be ignored
+	changes := &models.Post{Title: "Updated", Content: "New body", Excerpt: "New short", Slug: "other", Views: 999, Likes: 999, AuthorID: 42}
+
+	updated, err := svc.UpdatePost(ctx, "hello-world", changes, nil)
+	if err != nil {
+		t.Fatalf("UpdatePost returned error: %v", err)
+	}
+	if updated.ID != original.ID {
+		t.Errorf("expected post ID %d, got %d", original.ID, updated.ID)
+	}
+
+	var count int64
+	db.Model(&models.Post{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected 1 post after update, got %d", count)
+	}
+
+	var stored models.Post
+	db.First(&stored, original.ID)
+	if stored.Title != "Updated" || stored.Content != "New body" || stored.Excerpt != "New short" {
+		t.Errorf("editable fields not updated: %+v", stored)
+	}
+	if stored.Slug != "hello-world" || stored.Views != 7 || stored.Likes != 3 || stored.AuthorID != 1 {
+		t.Errorf("protected fields were overwritten: slug=%s views=%d likes=%d author=%d", stored.Slug, stored.Views, stored.Likes, stored.AuthorID)
+	}
+}
+
+func TestUpdatePostKeepsWorkflowStatus(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	createPost(t, db, "draft")
+
+	// Publishing goes through the editorial workflow, not PUT
+	updated, err := svc.UpdatePost(ctx, "draft", &models.Post{Title: "T", Content: "C", Excerpt: "E", Published: true, Status: models.StatusPublished}, nil)
+	if err != nil {
+		t.Fatalf("UpdatePost returned error: %v", err)
+	}
+	if updated.Published || updated.PublishedAt != nil || updated.Status != models.StatusDraft {
+		t.Errorf("expected the post to stay a draft, got published=%v status=%s", updated.Published, updated.Status)
+	}
+}
+
+func TestUpdatePostMissingReturnsNotFound(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+
+	_, err := svc.UpdatePost(ctx, "missing", &models.Post{Title: "T", Content: "C", Excerpt: "E"}, nil)
+	if !IsKind(err, KindNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	var count int64
+	db.Model(&models.Post{}).Count(&count)
+	if count != 0 {
+		t.Errorf("update of a missing post must not insert, found %d posts", count)
+	}
+}
+
+func TestDeletePost(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	createPost(t, db, "hello-world")
+
+	if err := svc.DeletePost(ctx, "hello-world", nil); err != nil {
+		t.Fatalf("DeletePost returned error: %v", err)
+	}
+	if _, err := svc.GetPost(ctx, "hello-world"); !IsKind(err, KindNotFound) {
+		t.Errorf("expected deleted post to be not found, got %v", err)
+	}
+	if err := svc.DeletePost(ctx, "hello-world", nil); !IsKind(err, KindNotFound) {
+		t.Errorf("expected second delete to be not found, got %v", err)
+	}
+}
+
+func TestDeletePostMissingReturnsNotFound(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+
+	if err := svc.DeletePost(ctx, "missing", nil); !IsKind(err, KindNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestUpdateProjectUpdatesExistingRow(t *testing.T) {
+	svc, db := newTestService(t)
+	original := createProject(t, db)
+
+	changes := &models.Project{Title: "Updated", Description: "New desc", Priority: 5, UserID: 42}
+	updated, err := svc.UpdateProject(context.Background(), original.ID, changes, nil)
+	if err != nil {
+		t.Fatalf("UpdateProject returned error: %v", err)
+	}
+	if updated.ID != original.ID {
+		t.Errorf("expected project ID %d, got %d", original.ID, updated.ID)
+	}
+
+	var stored models.Project
+	db.First(&stored, original.ID)
+	if stored.Title != "Updated" || stored.Description != "New desc" || stored.Priority != 5 {
+		t.Errorf("editable fields not updated: %+v", stored)
+	}
+	if stored.UserID != 1 {
+		t.Errorf("owner was overwritten: %d", stored.UserID)
+	}
+}
+
+func TestUpdateProjectMissingReturnsNotFound(t *testing.T) {
+	svc, db := newTestService(t)
+
+	_, err := svc.UpdateProject(context.Background(), 404, &models.Project{Title: "T", Description: "D"}, nil)
+	if !IsKind(err, KindNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	var count int64
+	db.Model(&models.Project{}).Count(&count)
+	if count != 0 {
+		t.Errorf("update of a missing project must not insert, found %d projects", count)
+	}
+}
+
+func TestDeleteProject(t *testing.T) {
+	svc, db := newTestService(t)
+	project := createProject(t, db)
+
+	if err := svc.DeleteProject(context.Background(), project.ID, nil); err != nil {
+		t.Fatalf("DeleteProject returned error: %v", err)
+	}
+	if err := svc.DeleteProject(context.Background(), project.ID, nil); !IsKind(err, KindNotFound) {
+		t.Errorf("expected second delete to be not found, got %v", err)
+	}
+}
+
+func TestDeleteProjectMissingReturnsNotFound(t *testing.T) {
+	svc, _ := newTestService(t)
+
+	if err := svc.DeleteProject(context.Background(), 404, nil); !IsKind(err, KindNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestPatchPostUpdatesOnlySuppliedFields(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	original := createPost(t, db, "hello-world")
+
+	patch := Patch{"title": []byte(`"Patched"`), "readTime": []byte(`5`)}
+	if _, err := svc.PatchPost(ctx, "hello-world", patch, nil); err != nil {
+		t.Fatalf("PatchPost returned error: %v", err)
+	}
+
+	var stored models.Post
+	db.First(&stored, original.ID)
+	if stored.Title != "Patched" || stored.ReadTime != 5 {
+		t.Errorf("patched fields not updated: %+v", stored)
+	}
+	if stored.Content != "Body" || stored.Excerpt != "Short" || stored.Views != 7 {
+		t.Errorf("omitted fields were changed: %+v", stored)
+	}
+}
+
+func TestPatchPostRejectsInvalidPatches(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	createPost(t, db, "hello-world")
+
+	tests := []struct {
+		name  string
+		patch Patch
+		field string
+	}{
+		{"protected counter", Patch{"views": []byte(`1000`)}, "views"},
+		{"protected author", Patch{"author_id": []byte(`2`)}, "author_id"},
+		{"required field cleared", Patch{"title": []byte(`null`)}, "title"},
+		{"wrong type", Patch{"readTime": []byte(`"five"`)}, "readTime"},
+	}
+
+	for _, tt := range tests {
+		_, err := svc.PatchPost(ctx, "hello-world", tt.patch, nil)
+		var domainErr *Error
+		if !errors.As(err, &domainErr) || domainErr.Kind != KindValidation {
+			t.Errorf("%s: expected validation error, got %v", tt.name, err)
+			continue
+		}
+		if _, ok := domainErr.Fields[tt.field]; !ok {
+			t.Errorf("%s: expected error for field %q, got %v", tt.name, tt.field, domainErr.Fields)
+		}
+	}
+}
+
+func TestUpdatePostHonoursIfMatch(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	original := createPost(t, db, "hello-world")
+	staleETag := original.ETag()
+	changes := &models.Post{Title: "First", Content: "C", Excerpt: "E"}
+
+	updated, err := svc.UpdatePost(ctx, "hello-world", changes, []string{staleETag})
+	if err != nil {
+		t.Fatalf("UpdatePost with current ETag returned error: %v", err)
+	}
+	if updated.Version != original.Version+1 || updated.ETag() == staleETag {
+		t.Fatalf("expected version to be bumped, got %d", updated.Version)
+	}
+
+	changes.Title = "Second"
+	if _, err := svc.UpdatePost(ctx, "hello-world", changes, []string{staleETag}); !IsKind(err, KindPreconditionFailed) {
+		t.Errorf("expected precondition failure for stale ETag, got %v", err)
+	}
+	if _, err := svc.PatchPost(ctx, "hello-world", Patch{"title": []byte(`"Third"`)}, []string{staleETag}); !IsKind(err, KindPreconditionFailed) {
+		t.Errorf("expected precondition failure for stale patch, got %v", err)
+	}
+	if err := svc.DeletePost(ctx, "hello-world", []string{staleETag}); !IsKind(err, KindPreconditionFailed) {
+		t.Errorf("expected precondition failure for stale delete, got %v", err)
+	}
+
+	stored, _ := svc.GetManagedPost(ctx, "hello-world")
+	if stored.Title != "First" {
+		t.Errorf("stale writes must not apply, title is %q", stored.Title)
+	}
+	if err := svc.DeletePost(ctx, "hello-world", []string{"*"}); err != nil {
+		t.Errorf("expected If-Match * to match an existing post, got %v", err)
+	}
+}
+
+func TestUpdateProjectHonoursIfMatch(t *testing.T) {
+	svc, db := newTestService(t)
+	project := createProject(t, db)
+
+	_, err := svc.UpdateProject(context.Background(), project.ID, &models.Project{Title: "T", Description: "D"}, []string{`"other"`})
+	if !IsKind(err, KindPreconditionFailed) {
+		t.Fatalf("expected precondition failure, got %v", err)
+	}
+	if _, err := svc.UpdateProject(context.Background(), project.ID, &models.Project{Title: "T", Description: "D"}, []string{project.ETag()}); err != nil {
+		t.Fatalf("UpdateProject with current ETag returned error: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"blog-backend/logging"
+	"blog-backend/metrics"
+	"blog-backend/spam"
+)
+
+// WithSpamFilter scores public submissions with pipeline. Submissions scoring
+// threshold or more are filed as spam.
+func WithSpamFilter(pipeline *spam.Pipeline, threshold float64) Option {
+	return func(s *Service) {
+		s.spamFilter = pipeline
+		s.spamThreshold = threshold
+	}
+}
+
+// scoreSubmission runs the spam pipeline and reports whether sub is spam.
+// Without a pipeline nothing is ever spam.
+func (s *Service) scoreSubmission(ctx context.Context, sub *spam.Submission) (spam.Verdict, bool) {
+	if s.spamFilter == nil {
+		return spam.Verdict{}, false
+	}
+
+	verdict, err := s.spamFilter.Evaluate(ctx, sub)
+	if err != nil {
+		logging.Printf(ctx, "Spam rule failed for %s: %v", sub.Kind, err)
+	}
+	isSpam := verdict.Score >= s.spamThreshold
+	metrics.RecordSpamVerdict(sub.Kind, isSpam)
+	return verdict, isSpam
+}
+
+// learnSpam trains the spam pipeline on a moderation decision
+func (s *Service) learnSpam(ctx context.Context, sub *spam.Submission, label, previous spam.Label) error {
+	if s.spamFilter == nil {
+		return nil
+	}
+	return s.spamFilter.Learn(ctx, sub, label, previous)
+}
+
+// formStartedAt converts the form render time reported by clients, in Unix
+// milliseconds, to a time
+func formStartedAt(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"blog-backend/logging"
+	"blog-backend/models"
+	"blog-backend/tracing"
+
+	"gorm.io/gorm"
+)
+
+// Trash item types
+const (
+	TrashPost     = "post"
+	TrashProject  = "project"
+	TrashActivity = "activity"
+)
+
+// maxSlugSuffix bounds the search for a free slug when restoring a post
+const maxSlugSuffix = 100
+
+// WithTrashRetention sets how long deleted items stay in the trash before
+// PurgeTrash removes them for good. Zero keeps them forever.
+func WithTrashRetention(retention time.Duration) Option {
+	return func(s *Service) {
+		s.trashRetention = retention
+	}
+}
+
+// TrashItem is a soft-deleted post, project or activity
+type TrashItem struct {
+	Type      string     `json:"type"`
+	ID        uint       `json:"id"`
+	Title     string     `json:"title"`
+	Slug      string     `json:"slug,omitempty"`
+	DeletedAt time.Time  `json:"deletedAt"`
+	PurgeAt   *time.Time `json:"purgeAt,omitempty"`
+}
+
+// ListTrash returns the items in the trash the current user may manage,
+// most recently deleted first: every item for editors, otherwise their own
+func (s *Service) ListTrash(ctx context.Context) ([]TrashItem, error) {
+	ctx, span := tracing.Start(ctx, "Service.ListTrash")
+	defer span.End()
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	posts, err := s.repo.ListTrashedPosts(ctx)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	projects, err := s.repo.ListTrashedProjects(ctx)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	activities, err := s.repo.ListTrashedActivities(ctx)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	items := make([]TrashItem, 0, len(posts)+len(projects)+len(activities))
+	for i, post := range posts {
+		if mayManageTrashed(user, &posts[i]) {
+			items = append(items, s.trashItem(TrashPost, post.Model, post.Title, post.OriginalSlug()))
+		}
+	}
+	for i, project := range projects {
+		if mayManageTrashed(user, &projects[i]) {
+			items = append(items, s.trashItem(TrashProject, project.Model, project.Title, ""))
+		}
+	}
+	for i, activity := range activities {
+		if mayManageTrashed(user, &activities[i]) {
+			items = append(items, s.trashItem(TrashActivity, activity.Model, activity.Description, ""))
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	return items, nil
+}
+
+// RestoreFromTrash takes an item out of the trash and returns it. A post whose
+// slug has been taken in the meantime is restored under the first free
+// "<slug>-<n>".
+func (s *Service) RestoreFromTrash(ctx context.Context, itemType string, id uint) (interface{}, error) {
+	ctx, span := tracing.Start(ctx, "Service.RestoreFromTrash")
+	defer span.End()
+
+	model, err := s.findTrashed(ctx, itemType, id)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	var rows int64
+	if post, ok := model.(*models.Post); ok {
+		slug, err := s.freeSlug(ctx, post)
+		if err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+		rows, err = s.repo.RestorePost(ctx, post, slug)
+		if err != nil {
+			return nil, tracing.RecordError(span, translate(err, itemType))
+		}
+		post.Slug = slug
+	} else {
+		rows, err = s.repo.Restore(ctx, model)
+		if err != nil {
+			return nil, tracing.RecordError(span, translate(err, itemType))
+		}
+	}
+	span.SetAttributes(tracing.RowsAffected(rows))
+	if rows == 0 {
+		return nil, tracing.RecordError(span, notFound(itemType))
+	}
+	if post, ok := model.(*models.Post); ok {
+		s.refreshSeriesNav(ctx, post)
+		s.notifyPostsChanged()
+	}
+	return model, nil
+}
+
+// DeleteFromTrash permanently deletes an item that is in the trash
+func (s *Service) DeleteFromTrash(ctx context.Context, itemType string, id uint) error {
+	ctx, span := tracing.Start(ctx, "Service.DeleteFromTrash")
+	defer span.End()
+
+	model, err := s.findTrashed(ctx, itemType, id)
+	if err != nil {
+		return tracing.RecordError(span, err)
+	}
+
+	rows, err := s.repo.Purge(ctx, model)
+	if err != nil {
+		return tracing.RecordError(span, translate(err, itemType))
+	}
+	span.SetAttributes(tracing.RowsAffected(rows))
+	if rows == 0 {
+		return tracing.RecordError(span, notFound(itemType))
+	}
+	return nil
+}
+
+// PurgeTrash permanently deletes items that have been in the trash longer
+// than the retention period
+func (s *Service) PurgeTrash(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Service.PurgeTrash")
+	defer span.End()
+
+	if s.trashRetention <= 0 {
+		return 0, nil
+	}
+	rows, err := s.repo.PurgeTrash(ctx, time.Now().Add(-s.trashRetention))
+	span.SetAttributes(tracing.RowsAffected(rows))
+	return rows, tracing.RecordError(span, err)
+}
+
+// RunTrashPurge calls PurgeTrash every interval until ctx is cancelled
+func (s *Service) RunTrashPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if rows, err := s.PurgeTrash(ctx); err != nil {
+			logging.Printf(ctx, "Failed to purge trash: %v", err)
+		} else if rows > 0 {
+			logging.Printf(ctx, "Purged %d items from the trash", rows)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// findTrashed loads an item from the trash if the current user may manage it
+func (s *Service) findTrashed(ctx context.Context, itemType string, id uint) (interface{}, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var model interface{}
+	switch itemType {
+	case TrashPost:
+		model = &models.Post{}
+	case TrashProject:
+		model = &models.Project{}
+	case TrashActivity:
+		model = &models.Activity{}
+	default:
+		return nil, Validation("invalid_trash_type", "Trash type must be post, project or activity", nil)
+	}
+
+	if err := s.repo.FindTrashed(ctx, model, id); err != nil {
+		return nil, translate(err, itemType)
+	}
+	if !mayManageTrashed(user, model) {
+		return nil, Forbidden("trash_forbidden", "Only the owner and editors may manage this item")
+	}
+	return model, nil
+}
+
+// mayManageTrashed reports whether user is an editor or owns the trashed
+// post, project or activity
+func mayManageTrashed(user *models.User, model interface{}) bool {
+	if user.IsEditor() {
+		return true
+	}
+	switch item := model.(type) {
+	case *models.Post:
+		return item.AuthorID == user.ID
+	case *models.Project:
+		return item.UserID == user.ID
+	case *models.Activity:
+		return item.UserID == user.ID
+	}
+	return false
+}
+
+// freeSlug returns the original slug of a trashed post, or the first
+// "<slug>-<n>" not held by another post
+func (s *Service) freeSlug(ctx context.Context, post *models.Post) (string, error) {
+	base := post.OriginalSlug()
+	for n := 1; n <= maxSlugSuffix; n++ {
+		slug := base
+		if n > 1 {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		taken, err := s.repo.SlugTaken(ctx, slug, post.ID)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return slug, nil
+		}
+	}
+	return "", Conflict("slug_taken", fmt.Sprintf("No free slug found for %q", base))
+}
+
+func (s *Service) trashItem(itemType string, model gorm.Model, title, slug string) TrashItem {
+	item := TrashItem{
+		Type:      itemType,
+		ID:        model.ID,
+		Title:     title,
+		Slug:      slug,
+		DeletedAt: model.DeletedAt.Time,
+	}
+	if s.trashRetention > 0 {
+		purgeAt := item.DeletedAt.Add(s.trashRetention)
+		item.PurgeAt = &purgeAt
+	}
+	return item
+}
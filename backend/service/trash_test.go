@@ -0,0 +1,123 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"blog-backend/models"
+	"blog-backend/repository"
+)
+
+func TestDeletePostFreesSlug(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	createPost(t, db, "reused")
+
+	if err := svc.DeletePost(ctx, "reused", nil); err != nil {
+		t.Fatalf("DeletePost returned error: %v", err)
+	}
+	if err := svc.CreatePost(ctx, &models.Post{Title: "New", Content: "C", Excerpt: "E", Slug: "reused"}); err != nil {
+		t.Fatalf("expected the slug of a trashed post to be reusable, got %v", err)
+	}
+}
+
+func TestRestorePostFromTrash(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	post := createPost(t, db, "restored")
+
+	if err := svc.DeletePost(ctx, "restored", nil); err != nil {
+		t.Fatalf("DeletePost returned error: %v", err)
+	}
+
+	items, err := svc.ListTrash(ctx)
+	if err != nil {
+		t.Fatalf("ListTrash returned error: %v", err)
+	}
+	if len(items) != 1 || items[0].Type != TrashPost || items[0].Slug != "restored" {
+		t.Fatalf("unexpected trash contents: %+v", items)
+	}
+
+	if _, err := svc.RestoreFromTrash(ctx, TrashPost, post.ID); err != nil {
+		t.Fatalf("RestoreFromTrash returned error: %v", err)
+	}
+	if _, err := svc.GetManagedPost(ctx, "restored"); err != nil {
+		t.Errorf("expected restored post under its original slug, got %v", err)
+	}
+	if _, err := svc.RestoreFromTrash(ctx, TrashPost, post.ID); !IsKind(err, KindNotFound) {
+		t.Errorf("expected not found when restoring a live post, got %v", err)
+	}
+}
+
+func TestRestorePostFromTrashAvoidsSlugCollision(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	post := createPost(t, db, "taken")
+
+	if err := svc.DeletePost(ctx, "taken", nil); err != nil {
+		t.Fatalf("DeletePost returned error: %v", err)
+	}
+	createPost(t, db, "taken")
+
+	restored, err := svc.RestoreFromTrash(ctx, TrashPost, post.ID)
+	if err != nil {
+		t.Fatalf("RestoreFromTrash returned error: %v", err)
+	}
+	if slug := restored.(*models.Post).Slug; slug != "taken-2" {
+		t.Errorf("expected restored post under taken-2, got %q", slug)
+	}
+}
+
+func TestDeleteFromTrash(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	project := createProject(t, db)
+
+	if err := svc.DeleteFromTrash(ctx, TrashProject, project.ID); !IsKind(err, KindNotFound) {
+		t.Errorf("expected not found for a live project, got %v", err)
+	}
+	if err := svc.DeleteProject(ctx, project.ID, nil); err != nil {
+		t.Fatalf("DeleteProject returned error: %v", err)
+	}
+	if err := svc.DeleteFromTrash(ctx, TrashProject, project.ID); err != nil {
+		t.Fatalf("DeleteFromTrash returned error: %v", err)
+	}
+
+	var count int64
+	db.Unscoped().Model(&models.Project{}).Count(&count)
+	if count != 0 {
+		t.Errorf("expected project to be gone, %d rows left", count)
+	}
+
+	if err := svc.DeleteFromTrash(ctx, "user", 1); !IsKind(err, KindValidation) {
+		t.Errorf("expected validation error for an unknown type, got %v", err)
+	}
+}
+
+func TestPurgeTrashRemovesExpiredItems(t *testing.T) {
+	_, db := newTestService(t)
+	svc := NewService(repository.NewRepository(db), WithTrashRetention(24*time.Hour))
+	ctx := editorContext(t, db)
+
+	expired := createPost(t, db, "expired")
+	recent := createPost(t, db, "recent")
+	for _, slug := range []string{"expired", "recent"} {
+		if err := svc.DeletePost(ctx, slug, nil); err != nil {
+			t.Fatalf("DeletePost returned error: %v", err)
+		}
+	}
+	db.Unscoped().Model(expired).Update("deleted_at", time.Now().Add(-48*time.Hour))
+
+	rows, err := svc.PurgeTrash(ctx)
+	if err != nil {
+		t.Fatalf("PurgeTrash returned error: %v", err)
+	}
+	if rows != 1 {
+		t.Errorf("expected 1 purged item, got %d", rows)
+	}
+
+	items, _ := svc.ListTrash(ctx)
+	if len(items) != 1 || items[0].ID != recent.ID || items[0].PurgeAt == nil {
+		t.Errorf("expected only the recent post left in the trash, got %+v", items)
+	}
+}
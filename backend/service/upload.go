@@ -0,0 +1,135 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	// Register the decoders used to check images and read their dimensions
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// maxFilenameLength caps the client filename kept for display
+const maxFilenameLength = 255
+
+// uploadExtensions maps the accepted content types to the extension of
+// stored files
+var uploadExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+}
+
+// UploadLimits maps each accepted content type to its maximum size in bytes.
+// Types are sniffed from the content, never taken from the client.
+type UploadLimits map[string]int64
+
+// NewUploadLimits accepts JPEG, PNG, GIF and WebP images up to maxImage
+// bytes, PDFs up to maxPDF bytes and MP4 and WebM videos up to maxVideo bytes
+func NewUploadLimits(maxImage, maxPDF, maxVideo int64) UploadLimits {
+	return UploadLimits{
+		"image/jpeg":      maxImage,
+		"image/png":       maxImage,
+		"image/gif":       maxImage,
+		"image/webp":      maxImage,
+		"application/pdf": maxPDF,
+		"video/mp4":       maxVideo,
+		"video/webm":      maxVideo,
+	}
+}
+
+// DefaultUploadLimits accepts images up to 10 MiB, PDFs up to 20 MiB and
+// videos up to 500 MiB
+func DefaultUploadLimits() UploadLimits {
+	return NewUploadLimits(10<<20, 20<<20, 500<<20)
+}
+
+// WithUploadLimits replaces the accepted upload types and their sizes
+func WithUploadLimits(limits UploadLimits) Option {
+	return func(s *Service) {
+		s.uploadLimits = limits
+	}
+}
+
+// Max returns the largest size any accepted type may have
+func (l UploadLimits) Max() int64 {
+	var max int64
+	for _, limit := range l {
+		if limit > max {
+			max = limit
+		}
+	}
+	return max
+}
+
+// Check sniffs the content type of data and returns it if the type is
+// accepted and data is within its size limit. Images must also decode.
+func (l UploadLimits) Check(data []byte) (string, error) {
+	mimeType, err := l.CheckType(data, int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(mimeType, "image/") {
+		if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil {
+			return "", Validation("invalid_image", "The uploaded image could not be read", map[string]string{"image": "is not a valid image"})
+		}
+	}
+	return mimeType, nil
+}
+
+// CheckType sniffs the content type from head, the start of a file of size
+// bytes, and returns it if the type is accepted and size is within its limit
+func (l UploadLimits) CheckType(head []byte, size int64) (string, error) {
+	if size == 0 {
+		return "", Validation("file_empty", "The uploaded file is empty", map[string]string{"image": "is empty"})
+	}
+
+	mimeType := strings.TrimSpace(strings.Split(http.DetectContentType(head), ";")[0])
+	limit, ok := l[mimeType]
+	if !ok || uploadExtensions[mimeType] == "" {
+		return "", Validation("unsupported_file_type", "Only JPEG, PNG, GIF and WebP images, PDF documents and MP4 and WebM videos may be uploaded",
+			map[string]string{"image": "has an unsupported type " + mimeType})
+	}
+	if size > limit {
+		return "", Validation("file_too_large", fmt.Sprintf("Files of type %s may be at most %d bytes", mimeType, limit),
+			map[string]string{"image": "is too large"})
+	}
+	return mimeType, nil
+}
+
+// UploadExtension returns the file extension stored files of an accepted
+// content type get
+func UploadExtension(mimeType string) string {
+	return uploadExtensions[mimeType]
+}
+
+// displayFilename reduces a client filename to a safe base name for display.
+// It is never used to name stored files.
+func displayFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" {
+		return ""
+	}
+	if len(name) > maxFilenameLength {
+		name = name[len(name)-maxFilenameLength:]
+	}
+	return name
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// validate checks models against their `binding` tags, the same rules gin
+// applies when binding request bodies
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.SetTagName("binding")
+	v.RegisterTagNameFunc(JSONFieldName)
+	return v
+}
+
+// JSONFieldName names struct fields by their JSON key in validation errors
+func JSONFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// FieldValidation converts validator errors into a validation error that
+// lists a message per field
+func FieldValidation(errs validator.ValidationErrors) *Error {
+	fields := make(map[string]string, len(errs))
+	for _, fieldErr := range errs {
+		fields[fieldName(fieldErr)] = fieldMessage(fieldErr)
+	}
+	e := Validation("validation_failed", "The request has invalid fields", fields)
+	e.Err = errs
+	return e
+}
+
+// fieldName returns the JSON path of the failing field without the top-level
+// struct name, e.g. "title" rather than "Post.title"
+func fieldName(fieldErr validator.FieldError) string {
+	namespace := fieldErr.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return fieldErr.Field()
+}
+
+func fieldMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "url":
+		return "must be a valid URL"
+	case "min":
+		return fmt.Sprintf("must be at least %s%s", fieldErr.Param(), unit(fieldErr))
+	case "max":
+		return fmt.Sprintf("must be at most %s%s", fieldErr.Param(), unit(fieldErr))
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fieldErr.Param())
+	default:
+		return "is invalid"
+	}
+}
+
+func unit(fieldErr validator.FieldError) string {
+	switch fieldErr.Kind() {
+	case reflect.String:
+		return " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return " items"
+	default:
+		return ""
+	}
+}
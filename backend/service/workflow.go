@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"blog-backend/logging"
+	"blog-backend/metrics"
+	"blog-backend/models"
+	"blog-backend/repository"
+	"blog-backend/tracing"
+)
+
+// postTransitions lists the allowed moves between workflow states. The value
+// reports whether the post's own author may make the move; editors may make
+// all of them.
+var postTransitions = map[string]map[string]bool{
+	models.StatusDraft:     {models.StatusInReview: true},
+	models.StatusInReview:  {models.StatusDraft: true, models.StatusApproved: false},
+	models.StatusApproved:  {models.StatusDraft: false, models.StatusScheduled: false, models.StatusPublished: false},
+	models.StatusScheduled: {models.StatusApproved: false, models.StatusPublished: false},
+	models.StatusPublished: {models.StatusArchived: false},
+	models.StatusArchived:  {models.StatusDraft: false},
+}
+
+// TransitionRequest moves a post to another workflow state. ScheduledAt is
+// required when scheduling.
+type TransitionRequest struct {
+	Status      string     `json:"status" binding:"required"`
+	Comment     string     `json:"comment" binding:"max=2000"`
+	ScheduledAt *time.Time `json:"scheduledAt"`
+}
+
+// TransitionPost moves the post with the given slug to req.Status on behalf
+// of the current user, recording the comment and logging an activity
+func (s *Service) TransitionPost(ctx context.Context, slug string, req TransitionRequest, ifMatch []string) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Service.TransitionPost", tracing.PostSlug(slug))
+	defer span.End()
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	post, err := s.repo.FindPostBySlug(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, translate(err, "post"))
+	}
+	// Refuse other people's posts before revealing anything about their state
+	if !mayEdit(user, post) {
+		return nil, tracing.RecordError(span, Forbidden("transition_forbidden", "Only the author and editors may move this post"))
+	}
+	if err := checkIfMatch(ifMatch, post.ETag(), "post"); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	authorMay, ok := postTransitions[post.Status][req.Status]
+	if !ok {
+		return nil, tracing.RecordError(span, Conflict("invalid_transition",
+			fmt.Sprintf("A %s post cannot be moved to %s", post.Status, req.Status)))
+	}
+	if !user.IsEditor() && !authorMay {
+		return nil, tracing.RecordError(span, Forbidden("transition_forbidden",
+			fmt.Sprintf("You may not move this post to %s", req.Status)))
+	}
+	if req.Status == models.StatusScheduled && (req.ScheduledAt == nil || !req.ScheduledAt.After(time.Now())) {
+		return nil, tracing.RecordError(span, Validation("invalid_schedule", "The post must be scheduled in the future",
+			map[string]string{"scheduledAt": "must be a future time"}))
+	}
+
+	if err := s.applyTransition(ctx, post, user, req, ifMatch); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return post, nil
+}
+
+// ListPostTransitions returns the workflow history of a post, newest first
+func (s *Service) ListPostTransitions(ctx context.Context, slug string) ([]models.PostTransition, error) {
+	ctx, span := tracing.Start(ctx, "Service.ListPostTransitions", tracing.PostSlug(slug))
+	defer span.End()
+
+	_, post, err := s.editablePost(ctx, slug)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	transitions, err := s.repo.ListPostTransitions(ctx, post.ID)
+	return transitions, tracing.RecordError(span, err)
+}
+
+// ReviewQueue returns the posts waiting for review, longest waiting first.
+// Only editors may see it.
+func (s *Service) ReviewQueue(ctx context.Context) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "Service.ReviewQueue")
+	defer span.End()
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	if !user.IsEditor() {
+		return nil, tracing.RecordError(span, Forbidden("review_forbidden", "Only editors may see the review queue"))
+	}
+
+	posts, err := s.repo.ListPostsByStatus(ctx, models.StatusInReview)
+	return posts, tracing.RecordError(span, err)
+}
+
+// PublishDuePosts publishes scheduled posts whose time has come. Each is
+// attributed to the editor who scheduled it. A post that cannot be published
+// is logged and skipped so it does not hold back the others.
+func (s *Service) PublishDuePosts(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "Service.PublishDuePosts")
+	defer span.End()
+
+	posts, err := s.repo.ListDuePosts(ctx, time.Now())
+	if err != nil {
+		return 0, tracing.RecordError(span, err)
+	}
+
+	published := 0
+	for i := range posts {
+		post := &posts[i]
+		if err := s.publishDuePost(ctx, post); err != nil {
+			// A concurrent edit wins; the post is picked up again next run
+			if !IsKind(err, KindPreconditionFailed) && !IsKind(err, KindNotFound) {
+				logging.Printf(ctx, "Failed to publish scheduled post %s: %v", post.Slug, err)
+			}
+			continue
+		}
+		published++
+	}
+	return published, nil
+}
+
+// publishDuePost publishes a scheduled post on behalf of its scheduler
+func (s *Service) publishDuePost(ctx context.Context, post *models.Post) error {
+	scheduled, err := s.repo.LatestPostTransition(ctx, post.ID, models.StatusScheduled)
+	if err != nil {
+		return err
+	}
+	scheduler, err := s.repo.FindUserByID(ctx, scheduled.UserID)
+	if err != nil {
+		return err
+	}
+	req := TransitionRequest{Status: models.StatusPublished, Comment: "Published on schedule"}
+	return s.applyTransition(ctx, post, scheduler, req, nil)
+}
+
+// RunScheduledPublishing calls PublishDuePosts every interval until ctx is
+// cancelled
+func (s *Service) RunScheduledPublishing(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.PublishDuePosts(ctx); err != nil {
+			logging.Printf(ctx, "Failed to publish scheduled posts: %v", err)
+		} else if n > 0 {
+			logging.Printf(ctx, "Published %d scheduled posts", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyTransition writes the new state of post and records the transition and
+// its activity in one transaction
+func (s *Service) applyTransition(ctx context.Context, post *models.Post, user *models.User, req TransitionRequest, ifMatch []string) error {
+	from := post.Status
+	post.Status = req.Status
+	post.Published = req.Status == models.StatusPublished
+	post.ScheduledAt = nil
+	if req.Status == models.StatusScheduled {
+		post.ScheduledAt = req.ScheduledAt
+	}
+	published := markPublished(post)
+
+	err := s.repo.Transaction(ctx, func(tx *repository.Repository) error {
+		rows, err := tx.UpdatePostFields(ctx, post, []string{"Status", "Published", "PublishedAt", "ScheduledAt"})
+		if err != nil {
+			return translate(err, "post")
+		}
+		if rows == 0 {
+			return staleWrite(ifMatch, "post")
+		}
+		if (from == models.StatusPublished) != post.Published {
+			// Public series navigation only lists published posts
+			if err := tx.BumpSeriesVersions(ctx, post.ID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.CreatePostTransition(ctx, &models.PostTransition{
+			PostID:     post.ID,
+			FromStatus: from,
+			ToStatus:   req.Status,
+			Comment:    req.Comment,
+			UserID:     user.ID,
+		}); err != nil {
+			return err
+		}
+
+		description := fmt.Sprintf("%s moved %q from %s to %s", user.Name, post.Title, from, req.Status)
+		if req.Comment != "" {
+			description += ": " + req.Comment
+		}
+		return tx.CreateActivity(ctx, &models.Activity{
+			Type:        "post_" + req.Status,
+			Description: description,
+			UserID:      user.ID,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if published {
+		metrics.PostsPublished.Inc()
+	}
+	s.notifyPostsChanged()
+	return nil
+}
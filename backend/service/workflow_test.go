@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blog-backend/models"
+
+	"gorm.io/gorm"
+)
+
+func createUser(t *testing.T, db *gorm.DB, email, role string) *models.User {
+	t.Helper()
+
+	user := &models.User{Name: role, Email: email, Password: "x", Role: role}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return user
+}
+
+func TestTransitionPostEnforcesRoles(t *testing.T) {
+	svc, db := newTestService(t)
+	author := createUser(t, db, "author@example.com", models.RoleAuthor)
+	other := createUser(t, db, "other@example.com", models.RoleAuthor)
+	editor := createUser(t, db, "editor@example.com", models.RoleEditor)
+	post := createPost(t, db, "guest-post")
+	db.Model(post).Update("author_id", author.ID)
+
+	authorCtx := WithUserID(context.Background(), author.ID)
+	editorCtx := WithUserID(context.Background(), editor.ID)
+
+	otherCtx := WithUserID(context.Background(), other.ID)
+	if _, err := svc.TransitionPost(otherCtx, "guest-post", TransitionRequest{Status: models.StatusInReview}, nil); !IsKind(err, KindForbidden) {
+		t.Errorf("expected another author to be forbidden, got %v", err)
+	}
+	// An invalid move must not tell other authors anything about the post
+	if _, err := svc.TransitionPost(otherCtx, "guest-post", TransitionRequest{Status: models.StatusArchived}, nil); !IsKind(err, KindForbidden) {
+		t.Errorf("expected another author to be forbidden before the move is checked, got %v", err)
+	}
+	if _, err := svc.TransitionPost(authorCtx, "guest-post", TransitionRequest{Status: models.StatusInReview}, nil); err != nil {
+		t.Fatalf("author submitting for review: %v", err)
+	}
+	if _, err := svc.TransitionPost(authorCtx, "guest-post", TransitionRequest{Status: models.StatusApproved}, nil); !IsKind(err, KindForbidden) {
+		t.Errorf("expected the author to be unable to approve, got %v", err)
+	}
+	if _, err := svc.TransitionPost(editorCtx, "guest-post", TransitionRequest{Status: models.StatusPublished}, nil); !IsKind(err, KindConflict) {
+		t.Errorf("expected publishing an unapproved post to conflict, got %v", err)
+	}
+
+	queue, err := svc.ReviewQueue(editorCtx)
+	if err != nil || len(queue) != 1 {
+		t.Fatalf("expected one post in the review queue, got %d (err %v)", len(queue), err)
+	}
+	if _, err := svc.ReviewQueue(authorCtx); !IsKind(err, KindForbidden) {
+		t.Errorf("expected authors to be kept out of the review queue, got %v", err)
+	}
+
+	if _, err := svc.TransitionPost(editorCtx, "guest-post", TransitionRequest{Status: models.StatusApproved, Comment: "Looks good"}, nil); err != nil {
+		t.Fatalf("editor approving: %v", err)
+	}
+	published, err := svc.TransitionPost(editorCtx, "guest-post", TransitionRequest{Status: models.StatusPublished}, nil)
+	if err != nil {
+		t.Fatalf("editor publishing: %v", err)
+	}
+	if !published.Published || published.PublishedAt == nil {
+		t.Errorf("expected publishing to set Published and PublishedAt, got %+v", published)
+	}
+
+	transitions, _ := svc.ListPostTransitions(editorCtx, "guest-post")
+	if len(transitions) != 3 || transitions[1].Comment != "Looks good" || transitions[1].UserID != editor.ID {
+		t.Errorf("unexpected workflow history: %+v", transitions)
+	}
+	var activities int64
+	db.Model(&models.Activity{}).Count(&activities)
+	if activities != 3 {
+		t.Errorf("expected an activity per transition, got %d", activities)
+	}
+}
+
+func TestAuthorsCannotEditReviewedPosts(t *testing.T) {
+	svc, db := newTestService(t)
+	author := createUser(t, db, "author@example.com", models.RoleAuthor)
+	ctx := WithUserID(context.Background(), author.ID)
+	post := createPost(t, db, "live")
+	db.Model(post).Update("author_id", author.ID)
+
+	if _, err := svc.PatchPost(ctx, "live", Patch{"title": []byte(`"Draft edit"`)}, nil); err != nil {
+		t.Fatalf("expected the author to edit their draft, got %v", err)
+	}
+	publishPost(t, db, post)
+
+	if _, err := svc.UpdatePost(ctx, "live", &models.Post{Title: "T", Content: "C", Excerpt: "E"}, nil); !IsKind(err, KindForbidden) {
+		t.Errorf("expected the author to be unable to update a published post, got %v", err)
+	}
+	if _, err := svc.PatchPost(ctx, "live", Patch{"content": []byte(`"Changed"`)}, nil); !IsKind(err, KindForbidden) {
+		t.Errorf("expected the author to be unable to patch a published post, got %v", err)
+	}
+	revisions, _ := svc.ListPostRevisions(ctx, "live")
+	if _, err := svc.RestorePostRevision(ctx, "live", revisions[len(revisions)-1].ID, nil); !IsKind(err, KindForbidden) {
+		t.Errorf("expected the author to be unable to restore a revision, got %v", err)
+	}
+	if err := svc.DeletePost(ctx, "live", nil); !IsKind(err, KindForbidden) {
+		t.Errorf("expected the author to be unable to delete a published post, got %v", err)
+	}
+	if _, err := svc.PatchPost(editorContext(t, db), "live", Patch{"content": []byte(`"Fixed"`)}, nil); err != nil {
+		t.Errorf("expected editors to change a published post, got %v", err)
+	}
+}
+
+func TestPublishDuePosts(t *testing.T) {
+	svc, db := newTestService(t)
+	editor := createUser(t, db, "editor@example.com", models.RoleEditor)
+	post := createPost(t, db, "scheduled")
+	db.Model(post).Update("status", models.StatusApproved)
+	ctx := WithUserID(context.Background(), editor.ID)
+
+	if _, err := svc.TransitionPost(ctx, "scheduled", TransitionRequest{Status: models.StatusScheduled}, nil); !IsKind(err, KindValidation) {
+		t.Errorf("expected scheduling without a time to fail validation, got %v", err)
+	}
+	at := time.Now().Add(time.Hour)
+	if _, err := svc.TransitionPost(ctx, "scheduled", TransitionRequest{Status: models.StatusScheduled, ScheduledAt: &at}, nil); err != nil {
+		t.Fatalf("scheduling: %v", err)
+	}
+
+	if n, err := svc.PublishDuePosts(context.Background()); err != nil || n != 0 {
+		t.Fatalf("expected nothing due yet, got %d (err %v)", n, err)
+	}
+	db.Model(&models.Post{}).Where("id = ?", post.ID).Update("scheduled_at", time.Now().Add(-time.Minute))
+	if n, err := svc.PublishDuePosts(context.Background()); err != nil || n != 1 {
+		t.Fatalf("expected one post published, got %d (err %v)", n, err)
+	}
+
+	stored, _ := svc.GetPost(context.Background(), "scheduled")
+	if stored.Status != models.StatusPublished || !stored.Published {
+		t.Errorf("expected the scheduled post to be published, got status %s", stored.Status)
+	}
+}
+
+func TestPublishDuePostsSkipsFailures(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := editorContext(t, db)
+	due := time.Now().Add(-time.Minute)
+
+	// The first post was scheduled directly, without a transition
+	broken := createPost(t, db, "broken")
+	db.Model(broken).Updates(map[string]interface{}{"status": models.StatusScheduled, "scheduled_at": due.Add(-time.Minute)})
+	post := createPost(t, db, "scheduled")
+	db.Model(post).Update("status", models.StatusApproved)
+	at := time.Now().Add(time.Hour)
+	if _, err := svc.TransitionPost(ctx, "scheduled", TransitionRequest{Status: models.StatusScheduled, ScheduledAt: &at}, nil); err != nil {
+		t.Fatalf("scheduling: %v", err)
+	}
+	db.Model(&models.Post{}).Where("id = ?", post.ID).Update("scheduled_at", due)
+
+	if n, err := svc.PublishDuePosts(context.Background()); err != nil || n != 1 {
+		t.Fatalf("expected the second post to be published, got %d (err %v)", n, err)
+	}
+	if _, err := svc.GetPost(context.Background(), "scheduled"); err != nil {
+		t.Errorf("expected the scheduled post to be public, got %v", err)
+	}
+}
+
+func TestUnpublishedPostsStayPrivate(t *testing.T) {
+	svc, db := newTestService(t)
+	author := createUser(t, db, "author@example.com", models.RoleAuthor)
+	other := createUser(t, db, "other@example.com", models.RoleAuthor)
+	editor := createUser(t, db, "editor@example.com", models.RoleEditor)
+	authorCtx := WithUserID(context.Background(), author.ID)
+	otherCtx := WithUserID(context.Background(), other.ID)
+	editorCtx := WithUserID(context.Background(), editor.ID)
+
+	post := &models.Post{Title: "Draft", Content: "C", Excerpt: "E", Slug: "draft", AuthorID: editor.ID}
+	if err := svc.CreatePost(authorCtx, post); err != nil {
+		t.Fatalf("CreatePost returned error: %v", err)
+	}
+	if post.AuthorID != author.ID {
+		t.Errorf("expected the caller to become the author, got %d", post.AuthorID)
+	}
+
+	if _, err := svc.GetPost(context.Background(), "draft"); !IsKind(err, KindNotFound) {
+		t.Errorf("expected drafts to be hidden from readers, got %v", err)
+	}
+	if posts, _ := svc.ListPosts(context.Background()); len(posts) != 0 {
+		t.Errorf("expected no published posts, got %d", len(posts))
+	}
+	if _, err := svc.GetManagedPost(authorCtx, "draft"); err != nil {
+		t.Errorf("expected the author to see their draft, got %v", err)
+	}
+	if _, err := svc.GetManagedPost(otherCtx, "draft"); !IsKind(err, KindForbidden) {
+		t.Errorf("expected other authors to be refused, got %v", err)
+	}
+	if posts, _ := svc.ListManagedPosts(otherCtx); len(posts) != 0 {
+		t.Errorf("expected other authors to see none of the posts, got %d", len(posts))
+	}
+	if posts, _ := svc.ListManagedPosts(editorCtx); len(posts) != 1 {
+		t.Errorf("expected editors to see every post, got %d", len(posts))
+	}
+
+	changes := &models.Post{Title: "Hijacked", Content: "C", Excerpt: "E"}
+	if _, err := svc.UpdatePost(otherCtx, "draft", changes, nil); !IsKind(err, KindForbidden) {
+		t.Errorf("expected other authors to be unable to update, got %v", err)
+	}
+	if _, err := svc.PatchPost(otherCtx, "draft", Patch{"title": []byte(`"Hijacked"`)}, nil); !IsKind(err, KindForbidden) {
+		t.Errorf("expected other authors to be unable to patch, got %v", err)
+	}
+	if err := svc.DeletePost(otherCtx, "draft", nil); !IsKind(err, KindForbidden) {
+		t.Errorf("expected other authors to be unable to delete, got %v", err)
+	}
+
+	if err := svc.DeletePost(authorCtx, "draft", nil); err != nil {
+		t.Fatalf("DeletePost returned error: %v", err)
+	}
+	if items, _ := svc.ListTrash(otherCtx); len(items) != 0 {
+		t.Errorf("expected other authors to see none of the trash, got %+v", items)
+	}
+	if _, err := svc.RestoreFromTrash(otherCtx, TrashPost, post.ID); !IsKind(err, KindForbidden) {
+		t.Errorf("expected other authors to be unable to restore, got %v", err)
+	}
+	if err := svc.DeleteFromTrash(otherCtx, TrashPost, post.ID); !IsKind(err, KindForbidden) {
+		t.Errorf("expected other authors to be unable to purge, got %v", err)
+	}
+	if _, err := svc.RestoreFromTrash(authorCtx, TrashPost, post.ID); err != nil {
+		t.Fatalf("RestoreFromTrash returned error: %v", err)
+	}
+
+	publishPost(t, db, post)
+	if _, err := svc.GetPost(context.Background(), "draft"); err != nil {
+		t.Errorf("expected published posts to be public, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package spam
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// maxTokens caps how many distinct tokens of a submission are considered
+const maxTokens = 200
+
+// Counts is how many spam and ham submissions contained a token
+type Counts struct {
+	Spam int
+	Ham  int
+}
+
+// TokenStore persists the classifier's training data
+type TokenStore interface {
+	// TokenCounts returns the counts of the given tokens, plus the number of
+	// spam and ham submissions trained so far
+	TokenCounts(ctx context.Context, tokens []string) (map[string]Counts, Counts, error)
+	// AddTokenCounts adds delta to the counts of tokens and of trained
+	// submissions
+	AddTokenCounts(ctx context.Context, tokens []string, delta Counts) error
+}
+
+// Bayes is a naive Bayes classifier over the words and link domains of a
+// submission. It stays silent until it has seen minTraining examples of both
+// spam and ham.
+type Bayes struct {
+	store       TokenStore
+	minTraining int
+}
+
+// NewBayes creates a classifier backed by store
+func NewBayes(store TokenStore, minTraining int) *Bayes {
+	return &Bayes{store: store, minTraining: minTraining}
+}
+
+// Check scores a submission by how much more likely it is spam than ham
+func (b *Bayes) Check(ctx context.Context, sub *Submission) (float64, string, error) {
+	tokens := Tokenize(sub.Text())
+	if len(tokens) == 0 {
+		return 0, "", nil
+	}
+
+	counts, docs, err := b.store.TokenCounts(ctx, tokens)
+	if err != nil {
+		return 0, "", err
+	}
+	if docs.Spam < b.minTraining || docs.Ham < b.minTraining {
+		return 0, "", nil
+	}
+
+	p := spamProbability(tokens, counts, docs)
+	if p <= 0.5 {
+		return 0, "", nil
+	}
+	return (p - 0.5) * 2, fmt.Sprintf("classifier rates it %.0f%% spam", p*100), nil
+}
+
+// Learn records the tokens of sub under label, undoing a previous label
+func (b *Bayes) Learn(ctx context.Context, sub *Submission, label, previous Label) error {
+	tokens := Tokenize(sub.Text())
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	var delta Counts
+	delta.add(label, 1)
+	delta.add(previous, -1)
+	return b.store.AddTokenCounts(ctx, tokens, delta)
+}
+
+func (c *Counts) add(label Label, n int) {
+	switch label {
+	case Spam:
+		c.Spam += n
+	case Ham:
+		c.Ham += n
+	}
+}
+
+// spamProbability combines per-token likelihoods with Laplace smoothing in
+// log space
+func spamProbability(tokens []string, counts map[string]Counts, docs Counts) float64 {
+	logOdds := math.Log(float64(docs.Spam+1)) - math.Log(float64(docs.Ham+1))
+	for _, token := range tokens {
+		c := counts[token]
+		pSpam := float64(c.Spam+1) / float64(docs.Spam+2)
+		pHam := float64(c.Ham+1) / float64(docs.Ham+2)
+		logOdds += math.Log(pSpam) - math.Log(pHam)
+	}
+	return 1 / (1 + math.Exp(-logOdds))
+}
+
+var urlPattern = regexp.MustCompile(`(?i)https?://[^\s)\]>"']+`)
+
+// Tokenize returns the distinct lower-cased words (3 to 30 characters) and
+// link domains of text
+func Tokenize(text string) []string {
+	seen := map[string]bool{}
+	var tokens []string
+	add := func(token string) {
+		if !seen[token] && len(tokens) < maxTokens {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	for _, link := range urlPattern.FindAllString(text, -1) {
+		if u, err := url.Parse(link); err == nil && u.Hostname() != "" {
+			add("domain:" + strings.ToLower(u.Hostname()))
+		}
+	}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if n := len(word); n >= 3 && n <= 30 {
+			add(word)
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,133 @@
+package spam
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var linkPattern = regexp.MustCompile(`(?i)https?://|www\.|\[[^\]]*\]\([^)]*\)|<a\s`)
+
+type ruleFunc func(ctx context.Context, sub *Submission) (float64, string, error)
+
+func (f ruleFunc) Check(ctx context.Context, sub *Submission) (float64, string, error) {
+	return f(ctx, sub)
+}
+
+// Honeypot flags submissions that filled in the hidden honeypot field
+func Honeypot() Rule {
+	return ruleFunc(func(_ context.Context, sub *Submission) (float64, string, error) {
+		if strings.TrimSpace(sub.Honeypot) != "" {
+			return 1, "honeypot field was filled in", nil
+		}
+		return 0, "", nil
+	})
+}
+
+// MinFillTime flags forms submitted faster than a person can type, and
+// slightly penalises clients that do not report when the form was shown
+func MinFillTime(min time.Duration) Rule {
+	return ruleFunc(func(_ context.Context, sub *Submission) (float64, string, error) {
+		if sub.StartedAt.IsZero() {
+			return 0.2, "form start time missing", nil
+		}
+		if elapsed := sub.Now.Sub(sub.StartedAt); elapsed < min {
+			return 0.6, fmt.Sprintf("form filled in %s", elapsed.Round(100*time.Millisecond)), nil
+		}
+		return 0, "", nil
+	})
+}
+
+// LinkCount flags submissions with more than max links, adding weight for
+// each extra link
+func LinkCount(max int) Rule {
+	return ruleFunc(func(_ context.Context, sub *Submission) (float64, string, error) {
+		links := len(linkPattern.FindAllStringIndex(sub.Body, -1))
+		if links <= max {
+			return 0, "", nil
+		}
+		score := 0.3 + 0.2*float64(links-max-1)
+		if score > 1 {
+			score = 1
+		}
+		return score, fmt.Sprintf("%d links", links), nil
+	})
+}
+
+// Blocklist flags submissions whose name, email or body contains one of the
+// terms, matched case-insensitively
+func Blocklist(terms []string) Rule {
+	lowered := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if term = strings.ToLower(strings.TrimSpace(term)); term != "" {
+			lowered = append(lowered, term)
+		}
+	}
+
+	return ruleFunc(func(_ context.Context, sub *Submission) (float64, string, error) {
+		text := strings.ToLower(sub.Text())
+		for _, term := range lowered {
+			if strings.Contains(text, term) {
+				return 1, fmt.Sprintf("blocked term %q", term), nil
+			}
+		}
+		return 0, "", nil
+	})
+}
+
+// IPRate flags an IP that submits more than limit times within window. Counts
+// are kept in memory per process. If throttled is not nil it is called with
+// every flagged IP.
+func IPRate(limit int, window time.Duration, throttled func(ip string)) Rule {
+	rate := &ipRate{limit: limit, window: window, throttled: throttled, seen: map[string][]time.Time{}}
+	return ruleFunc(rate.check)
+}
+
+type ipRate struct {
+	limit     int
+	window    time.Duration
+	throttled func(ip string)
+
+	mu        sync.Mutex
+	seen      map[string][]time.Time
+	lastSweep time.Time
+}
+
+func (r *ipRate) check(_ context.Context, sub *Submission) (float64, string, error) {
+	if sub.IP == "" {
+		return 0, "", nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cutoff := sub.Now.Add(-r.window)
+	if sub.Now.Sub(r.lastSweep) > r.window {
+		for ip, times := range r.seen {
+			if len(times) == 0 || !times[len(times)-1].After(cutoff) {
+				delete(r.seen, ip)
+			}
+		}
+		r.lastSweep = sub.Now
+	}
+
+	recent := r.seen[sub.IP][:0]
+	for _, t := range r.seen[sub.IP] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, sub.Now)
+	r.seen[sub.IP] = recent
+
+	if len(recent) > r.limit {
+		if r.throttled != nil {
+			r.throttled(sub.IP)
+		}
+		return 0.5, fmt.Sprintf("%d submissions from this IP within %s", len(recent), r.window), nil
+	}
+	return 0, "", nil
+}
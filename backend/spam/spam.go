@@ -0,0 +1,106 @@
+// Package spam scores public submissions such as comments and contact
+// messages with a pipeline of local rules. Nothing leaves the server.
+package spam
+
+import (
+	"context"
+	"time"
+)
+
+// Label is a moderation decision a submission was trained as
+type Label string
+
+const (
+	Unlabeled Label = ""
+	Spam      Label = "spam"
+	Ham       Label = "ham"
+)
+
+// Submission is the text and request metadata of one public submission.
+// Honeypot holds the hidden form field real visitors leave empty and
+// StartedAt when the form was rendered, if the client reported it.
+type Submission struct {
+	Kind      string
+	IP        string
+	Name      string
+	Email     string
+	Body      string
+	Honeypot  string
+	StartedAt time.Time
+	Now       time.Time
+}
+
+// Text is everything a visitor typed, as seen by text-based rules
+func (s *Submission) Text() string {
+	return s.Name + " " + s.Email + " " + s.Body
+}
+
+// Verdict is the combined score of all rules and why each contributed
+type Verdict struct {
+	Score   float64
+	Reasons []string
+}
+
+// Rule scores one aspect of a submission. A score of 0 means no signal; 1 is
+// certain spam on its own. The reason explains a non-zero score.
+type Rule interface {
+	Check(ctx context.Context, sub *Submission) (score float64, reason string, err error)
+}
+
+// Learner is implemented by rules that learn from moderation decisions.
+// previous is the label the submission was trained as before, if any, so a
+// changed decision replaces the old one.
+type Learner interface {
+	Learn(ctx context.Context, sub *Submission, label, previous Label) error
+}
+
+// Pipeline runs rules in order and adds up their scores
+type Pipeline struct {
+	rules []Rule
+}
+
+// NewPipeline creates a pipeline from rules
+func NewPipeline(rules ...Rule) *Pipeline {
+	return &Pipeline{rules: rules}
+}
+
+// Evaluate scores sub with every rule. A failing rule is skipped so that a
+// broken rule cannot block submissions; its error is returned alongside the
+// verdict of the others.
+func (p *Pipeline) Evaluate(ctx context.Context, sub *Submission) (Verdict, error) {
+	if sub.Now.IsZero() {
+		sub.Now = time.Now()
+	}
+
+	var verdict Verdict
+	var firstErr error
+	for _, rule := range p.rules {
+		score, reason, err := rule.Check(ctx, sub)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if score > 0 {
+			verdict.Score += score
+			verdict.Reasons = append(verdict.Reasons, reason)
+		}
+	}
+	return verdict, firstErr
+}
+
+// Learn passes a moderation decision to every rule that learns
+func (p *Pipeline) Learn(ctx context.Context, sub *Submission, label, previous Label) error {
+	if label == previous {
+		return nil
+	}
+	for _, rule := range p.rules {
+		if learner, ok := rule.(Learner); ok {
+			if err := learner.Learn(ctx, sub, label, previous); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package spam
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	tokens map[string]Counts
+	docs   Counts
+}
+
+func (m *memoryStore) TokenCounts(_ context.Context, tokens []string) (map[string]Counts, Counts, error) {
+	counts := map[string]Counts{}
+	for _, token := range tokens {
+		if c, ok := m.tokens[token]; ok {
+			counts[token] = c
+		}
+	}
+	return counts, m.docs, nil
+}
+
+func (m *memoryStore) AddTokenCounts(_ context.Context, tokens []string, delta Counts) error {
+	for _, token := range tokens {
+		c := m.tokens[token]
+		c.Spam += delta.Spam
+		c.Ham += delta.Ham
+		m.tokens[token] = c
+	}
+	m.docs.Spam += delta.Spam
+	m.docs.Ham += delta.Ham
+	return nil
+}
+
+func TestRules(t *testing.T) {
+	now := time.Now()
+	var throttled []string
+	pipeline := NewPipeline(Honeypot(), MinFillTime(3*time.Second), LinkCount(1), Blocklist([]string{" Casino "}),
+		IPRate(2, time.Minute, func(ip string) { throttled = append(throttled, ip) }))
+	ctx := context.Background()
+
+	clean := func() *Submission {
+		return &Submission{IP: "10.0.0.1", Body: "Great post, thanks", StartedAt: now.Add(-time.Minute), Now: now}
+	}
+
+	tests := []struct {
+		name  string
+		edit  func(*Submission)
+		score float64
+	}{
+		{"clean", func(*Submission) {}, 0},
+		{"honeypot", func(s *Submission) { s.Honeypot = "http://spam.example" }, 1},
+		{"too fast", func(s *Submission) { s.StartedAt = now.Add(-time.Second) }, 0.6},
+		{"no start time", func(s *Submission) { s.StartedAt = time.Time{} }, 0.2},
+		{"links", func(s *Submission) { s.Body = "see https://a.example and www.b.example and [c](http://c.example)" }, 0.5},
+		{"blocklist", func(s *Submission) { s.Name = "Best CASINO" }, 1},
+	}
+	for i, tt := range tests {
+		sub := clean()
+		sub.IP = string(rune('a' + i))
+		tt.edit(sub)
+		verdict, err := pipeline.Evaluate(ctx, sub)
+		if err != nil {
+			t.Fatalf("%s: Evaluate returned error: %v", tt.name, err)
+		}
+		if diff := verdict.Score - tt.score; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("%s: expected score %.1f, got %.2f (%v)", tt.name, tt.score, verdict.Score, verdict.Reasons)
+		}
+		if tt.score > 0 && len(verdict.Reasons) != 1 {
+			t.Errorf("%s: expected one reason, got %v", tt.name, verdict.Reasons)
+		}
+	}
+
+	// The third submission from one IP within the window is flagged
+	for i := 0; i < 3; i++ {
+		verdict, _ := pipeline.Evaluate(ctx, clean())
+		if want := i == 2; (verdict.Score > 0) != want {
+			t.Errorf("submission %d: expected flagged=%v, got %v", i+1, want, verdict.Reasons)
+		}
+	}
+	if len(throttled) != 1 || throttled[0] != "10.0.0.1" {
+		t.Errorf("expected the flagged IP to be reported once, got %v", throttled)
+	}
+}
+
+func TestBayesLearnsFromModeration(t *testing.T) {
+	store := &memoryStore{tokens: map[string]Counts{}}
+	bayes := NewBayes(store, 2)
+	ctx := context.Background()
+
+	spam := []string{"cheap pills online https://pills.example", "buy cheap pills now", "cheap watches and pills"}
+	ham := []string{"thanks for the clear explanation", "the second example helped me", "great explanation of goroutines"}
+
+	probe := &Submission{Body: "cheap pills here https://pills.example"}
+	if score, _, _ := bayes.Check(ctx, probe); score != 0 {
+		t.Errorf("expected an untrained classifier to stay silent, got %.2f", score)
+	}
+
+	for _, body := range spam {
+		if err := bayes.Learn(ctx, &Submission{Body: body}, Spam, Unlabeled); err != nil {
+			t.Fatalf("Learn returned error: %v", err)
+		}
+	}
+	for _, body := range ham {
+		if err := bayes.Learn(ctx, &Submission{Body: body}, Ham, Unlabeled); err != nil {
+			t.Fatalf("Learn returned error: %v", err)
+		}
+	}
+
+	score, reason, err := bayes.Check(ctx, probe)
+	if err != nil {
+		t.Fatalf("Check returned error: %v", err)
+	}
+	if score < 0.5 || reason == "" {
+		t.Errorf("expected the probe to score as spam, got %.2f %q", score, reason)
+	}
+	if score, _, _ := bayes.Check(ctx, &Submission{Body: "clear explanation, thanks"}); score != 0 {
+		t.Errorf("expected a ham-like submission to score 0, got %.2f", score)
+	}
+
+	// Relabelling moves the counts rather than adding to them
+	if err := bayes.Learn(ctx, &Submission{Body: ham[0]}, Spam, Ham); err != nil {
+		t.Fatalf("Learn returned error: %v", err)
+	}
+	if store.docs != (Counts{Spam: 4, Ham: 2}) || store.tokens["thanks"] != (Counts{Spam: 1}) {
+		t.Errorf("unexpected counts after relabelling: docs=%+v thanks=%+v", store.docs, store.tokens["thanks"])
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("Visit HTTPS://Shop.Example/deal now, now! a an")
+	want := map[string]bool{"domain:shop.example": true, "visit": true, "https": true, "shop": true, "example": true, "deal": true, "now": true}
+	if len(tokens) != len(want) {
+		t.Fatalf("expected %d tokens, got %v", len(want), tokens)
+	}
+	for _, token := range tokens {
+		if !want[token] {
+			t.Errorf("unexpected token %q", token)
+		}
+	}
+}
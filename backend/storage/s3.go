@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config locates a bucket on an S3-compatible service such as AWS S3 or
+// MinIO. Endpoint is a host and port without a scheme.
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// S3 stores objects in a bucket of an S3-compatible service
+type S3 struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3 connects to the bucket described by cfg. The bucket must exist.
+func NewS3(cfg S3Config) (*S3, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3{client: client, bucket: cfg.Bucket}, nil
+}
+
+// CheckBucket fails unless the bucket exists and the credentials can see it
+func (s *S3) CheckBucket(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("storage: bucket " + s.bucket + " does not exist")
+	}
+	return nil
+}
+
+// Put uploads the object; objects larger than the part size are sent as a
+// multipart upload. The object keeps the Content-Disposition it must be
+// served with, should the bucket be read directly.
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType:        contentType,
+		ContentDisposition: ContentDisposition(key),
+	})
+	return err
+}
+
+// Get opens the object. Its body is fetched lazily and supports seeking, so
+// it can serve range requests.
+func (s *S3) Get(ctx context.Context, key string) (*Object, error) {
+	if err := CheckKey(key); err != nil {
+		return nil, err
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, s3Error(err)
+	}
+	return &Object{Body: obj, Size: info.Size, ContentType: info.ContentType, ModTime: info.LastModified}, nil
+}
+
+// Delete removes the object
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	if errors.Is(s3Error(err), ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// PresignedURL signs a GET request for the object that is valid for expiry.
+// The URL overrides the content type and disposition of the response like
+// the proxied download does, so the bucket cannot be made to serve an
+// uploaded page inline.
+func (s *S3) PresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if err := CheckKey(key); err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	params.Set("response-content-disposition", ContentDisposition(key))
+	params.Set("response-content-type", ContentType(key))
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// s3Error turns a missing object into ErrNotFound
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	resp := minio.ToErrorResponse(err)
+	if resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+// Package storage keeps uploaded files in a local directory or an
+// S3-compatible object store behind one interface, so several instances of
+// the server can share them.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound reports a key with no stored object
+	ErrNotFound = errors.New("storage: object not found")
+	// ErrInvalidKey reports a key that is empty, absolute or escapes the
+	// store with ".." elements
+	ErrInvalidKey = errors.New("storage: invalid key")
+)
+
+// Backend stores objects under slash-separated keys
+type Backend interface {
+	// Put stores size bytes from r under key, replacing any object there
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object under key. The caller must close its Body.
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete removes the object under key. Deleting a missing object is not
+	// an error.
+	Delete(ctx context.Context, key string) error
+	// PresignedURL returns a URL that lets anyone download the object under
+	// key until expiry passes
+	PresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// Object is a stored object opened for reading
+type Object struct {
+	Body        io.ReadSeekCloser
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// inlineTypes are the extensions of stored files browsers may show inline;
+// everything else is downloaded
+var inlineTypes = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true,
+	".mp4": true, ".webm": true,
+}
+
+// ContentDisposition returns the Content-Disposition to serve the object
+// under key with: inline for images and videos, otherwise a download named
+// after the object
+func ContentDisposition(key string) string {
+	name := path.Base(key)
+	disposition := "attachment"
+	if inlineTypes[strings.ToLower(path.Ext(name))] {
+		disposition = "inline"
+	}
+	return disposition + `; filename="` + strings.ReplaceAll(name, `"`, "") + `"`
+}
+
+// ContentType returns the content type of the object under key by its
+// extension, or application/octet-stream if the extension is unknown
+func ContentType(key string) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// CheckKey returns ErrInvalidKey unless key is a clean relative path
+func CheckKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) || path.Clean(key) != key {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testBackend checks the behaviour every Backend must share
+func testBackend(t *testing.T, b Backend) {
+	ctx := context.Background()
+	key := "tests/" + time.Now().Format("150405.000000000") + ".txt"
+	data := []byte("hello storage")
+
+	if err := b.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "text/plain"); err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+	obj, err := b.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if _, err := obj.Body.Seek(6, io.SeekStart); err != nil {
+		t.Fatalf("Seek returned error: %v", err)
+	}
+	rest, err := io.ReadAll(obj.Body)
+	obj.Body.Close()
+	if err != nil || string(rest) != "storage" || obj.Size != int64(len(data)) || !strings.HasPrefix(obj.ContentType, "text/plain") {
+		t.Errorf("unexpected object %+v with tail %q (err %v)", obj, rest, err)
+	}
+
+	if url, err := b.PresignedURL(ctx, key, time.Minute); err != nil || !strings.Contains(url, key) {
+		t.Errorf("expected a URL for the key, got %q (err %v)", url, err)
+	}
+
+	if err := b.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if _, err := b.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a deleted object to be missing, got %v", err)
+	}
+	if err := b.Delete(ctx, key); err != nil {
+		t.Errorf("expected deleting a missing object to succeed, got %v", err)
+	}
+
+	for _, bad := range []string{"", "/etc/passwd", "../secret", "a/../../b", `a\b`} {
+		if err := b.Put(ctx, bad, bytes.NewReader(data), int64(len(data)), ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("expected key %q to be refused, got %v", bad, err)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	b, err := NewLocal(t.TempDir(), "/uploads/")
+	if err != nil {
+		t.Fatalf("NewLocal returned error: %v", err)
+	}
+	testBackend(t, b)
+
+	if url, _ := b.PresignedURL(context.Background(), "a b.png", time.Minute); url != "/uploads/a%20b.png" {
+		t.Errorf("expected the public URL, got %q", url)
+	}
+}
+
+func TestS3PresignedURLSetsResponseHeaders(t *testing.T) {
+	b, err := NewS3(S3Config{Endpoint: "s3.example.com", Region: "us-east-1", Bucket: "uploads", AccessKey: "key", SecretKey: "secret", UseSSL: true})
+	if err != nil {
+		t.Fatalf("NewS3 returned error: %v", err)
+	}
+
+	tests := []struct {
+		key, disposition, contentType string
+	}{
+		{"photo.png", `inline; filename="photo.png"`, "image/png"},
+		{"cv.pdf", `attachment; filename="cv.pdf"`, "application/pdf"},
+		{"notes", `attachment; filename="notes"`, "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		signed, err := b.PresignedURL(context.Background(), tt.key, time.Minute)
+		if err != nil {
+			t.Fatalf("PresignedURL returned error: %v", err)
+		}
+		u, err := url.Parse(signed)
+		if err != nil {
+			t.Fatalf("invalid URL %q: %v", signed, err)
+		}
+		query := u.Query()
+		if got := query.Get("response-content-disposition"); got != tt.disposition {
+			t.Errorf("%s: expected disposition %q, got %q", tt.key, tt.disposition, got)
+		}
+		if got := query.Get("response-content-type"); got != tt.contentType {
+			t.Errorf("%s: expected content type %q, got %q", tt.key, tt.contentType, got)
+		}
+	}
+}
+
+// TestS3 runs against the bucket in S3_TEST_BUCKET, e.g. on a local MinIO:
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	S3_TEST_ENDPOINT=localhost:9000 S3_TEST_BUCKET=test \
+//	S3_TEST_ACCESS_KEY=minioadmin S3_TEST_SECRET_KEY=minioadmin go test ./storage
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	b, err := NewS3(S3Config{
+		Endpoint:  endpoint,
+		Bucket:    os.Getenv("S3_TEST_BUCKET"),
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+		UseSSL:    os.Getenv("S3_TEST_USE_SSL") == "true",
+	})
+	if err != nil {
+		t.Fatalf("NewS3 returned error: %v", err)
+	}
+	if err := b.CheckBucket(context.Background()); err != nil {
+		t.Fatalf("CheckBucket returned error: %v", err)
+	}
+	testBackend(t, b)
+}
@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+
+	"blog-backend/buildinfo"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "blog-backend"
+
+// ServiceName is the service.name reported on every span
+var ServiceName = "blog-backend"
+
+// Init installs the global tracer provider and the W3C trace-context
+// propagator. Spans are exported over OTLP/HTTP when
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set;
+// otherwise tracing stays local and nothing is exported. The returned function
+// flushes pending spans and must be called on shutdown.
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		ServiceName = name
+	}
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		log.Println("No OTLP endpoint configured, traces will not be exported")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := sdkresource.Merge(sdkresource.Default(), sdkresource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+		semconv.ServiceVersion(buildinfo.Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span as a child of the span in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// RecordError marks span as failed when err is non-nil and returns err
+func RecordError(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// Span attributes shared across layers
+func PostSlug(slug string) attribute.KeyValue {
+	return attribute.String("post.slug", slug)
+}
+
+func ProjectID(id uint) attribute.KeyValue {
+	return attribute.Int64("project.id", int64(id))
+}
+
+func RowsAffected(rows int64) attribute.KeyValue {
+	return attribute.Int64("db.rows_affected", rows)
+}
+
+func UserID(id uint) attribute.KeyValue {
+	return semconv.EnduserID(strconv.FormatUint(uint64(id), 10))
+}
@@ -0,0 +1,205 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"blog-backend/config"
+	"blog-backend/handlers"
+	"blog-backend/models"
+	"blog-backend/repository"
+	"blog-backend/service"
+	"blog-backend/tracing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupExporter(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	return exporter
+}
+
+func findSpan(spans tracetest.SpanStubs, name string) *tracetest.SpanStub {
+	for i := range spans {
+		if spans[i].Name == name {
+			return &spans[i]
+		}
+	}
+	return nil
+}
+
+func hasAttribute(span *tracetest.SpanStub, kv attribute.KeyValue) bool {
+	for _, attr := range span.Attributes {
+		if attr.Key == kv.Key && attr.Value == kv.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMiddlewareContinuesIncomingTrace(t *testing.T) {
+	exporter := setupExporter(t)
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := config.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		t.Fatalf("failed to register plugin: %v", err)
+	}
+	post := &models.Post{Title: "Hello", Content: "Body", Excerpt: "Short", Slug: "hello-world", Status: models.StatusPublished, Published: true}
+	if err := db.Create(post).Error; err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	exporter.Reset()
+
+	handler := handlers.NewHandler(service.NewService(repository.NewRepository(db)))
+	router := gin.New()
+	router.Use(tracing.Middleware())
+	router.GET("/api/posts/:slug", handler.GetPost)
+	router.GET("/healthz", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/hello-world", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	spans := exporter.GetSpans()
+	for i := range spans {
+		if spans[i].Name == "/healthz" {
+			t.Error("health probe should not be traced")
+		}
+	}
+
+	server := findSpan(spans, "/api/posts/:slug")
+	if server == nil {
+		t.Fatalf("server span not found in %v", spans)
+	}
+	if server.SpanKind != trace.SpanKindServer {
+		t.Errorf("expected server span kind, got %v", server.SpanKind)
+	}
+	if got := server.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("server span did not continue incoming trace, got trace ID %s", got)
+	}
+	if got := server.Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("expected remote parent 00f067aa0ba902b7, got %s", got)
+	}
+
+	svcSpan := findSpan(spans, "Service.GetPost")
+	if svcSpan == nil {
+		t.Fatal("service span not found")
+	}
+	if svcSpan.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Error("service span is not a child of the server span")
+	}
+	if !hasAttribute(svcSpan, tracing.PostSlug("hello-world")) {
+		t.Errorf("service span missing post.slug attribute: %v", svcSpan.Attributes)
+	}
+
+	repoSpan := findSpan(spans, "Repository.FindPublishedPostBySlug")
+	if repoSpan == nil {
+		t.Fatal("repository span not found")
+	}
+	if repoSpan.Parent.SpanID() != svcSpan.SpanContext.SpanID() {
+		t.Error("repository span is not a child of the service span")
+	}
+	if !hasAttribute(repoSpan, tracing.PostSlug("hello-world")) {
+		t.Errorf("repository span missing post.slug attribute: %v", repoSpan.Attributes)
+	}
+
+	var queries int
+	for i := range spans {
+		if spans[i].Name == "gorm.query" && spans[i].Parent.SpanID() == repoSpan.SpanContext.SpanID() {
+			queries++
+		}
+	}
+	if queries == 0 {
+		t.Error("expected query spans under the repository span")
+	}
+}
+
+type widget struct {
+	ID   uint
+	Name string
+}
+
+func TestGormPluginCreatesQuerySpans(t *testing.T) {
+	exporter := setupExporter(t)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&widget{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		t.Fatalf("failed to register plugin: %v", err)
+	}
+
+	ctx, parent := tracing.Start(context.Background(), "Repository.FindWidget")
+	db.WithContext(ctx).Create(&widget{Name: "gear"})
+	var found widget
+	db.WithContext(ctx).First(&found, "name = ?", "gear")
+	err = db.WithContext(ctx).First(&found, "name = ?", "missing").Error
+	parent.End()
+	if err != gorm.ErrRecordNotFound {
+		t.Fatalf("expected record not found, got %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	parentStub := findSpan(spans, "Repository.FindWidget")
+	if parentStub == nil {
+		t.Fatal("parent span not found")
+	}
+
+	var queries int
+	for i := range spans {
+		span := &spans[i]
+		if span.Name != "gorm.create" && span.Name != "gorm.query" {
+			continue
+		}
+		queries++
+		if span.Parent.SpanID() != parentStub.SpanContext.SpanID() {
+			t.Errorf("%s is not a child of the request span", span.Name)
+		}
+		if !hasAttribute(span, attribute.String("db.sql.table", "widgets")) {
+			t.Errorf("%s missing table attribute: %v", span.Name, span.Attributes)
+		}
+		if span.Status.Code == codes.Error {
+			t.Errorf("%s should not be marked failed: %v", span.Name, span.Status)
+		}
+	}
+	if queries != 3 {
+		t.Errorf("expected 3 query spans, got %d", queries)
+	}
+}
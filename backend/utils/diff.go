@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// DiffLine is one line of a line-level diff. Op is "equal", "insert" or
+// "delete".
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// DiffLines compares a and b line by line
+func DiffLines(a, b string) []DiffLine {
+	dmp := diffmatchpatch.New()
+	runesA, runesB, lines := dmp.DiffLinesToRunes(a, b)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMainRunes(runesA, runesB, false), lines)
+
+	var result []DiffLine
+	for _, d := range diffs {
+		op := "equal"
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			op = "insert"
+		case diffmatchpatch.DiffDelete:
+			op = "delete"
+		}
+		for _, line := range strings.SplitAfter(d.Text, "\n") {
+			if line == "" {
+				continue
+			}
+			result = append(result, DiffLine{Op: op, Text: strings.TrimSuffix(line, "\n")})
+		}
+	}
+	return result
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"bytes"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var (
+	// goldmark escapes raw HTML in the source; the policy then keeps only the
+	// text formatting Markdown produces, so javascript: links, images and
+	// embeds never reach the page
+	markdown       = goldmark.New(goldmark.WithExtensions(extension.Strikethrough, extension.Linkify))
+	markdownPolicy = newMarkdownPolicy()
+)
+
+func newMarkdownPolicy() *bluemonday.Policy {
+	policy := bluemonday.NewPolicy()
+	policy.AllowElements("p", "br", "em", "strong", "del", "code", "pre", "blockquote", "ul", "ol", "li", "hr")
+	policy.AllowAttrs("href").OnElements("a")
+	policy.AllowStandardURLs()
+	policy.RequireNoFollowOnLinks(true)
+	policy.AddTargetBlankToFullyQualifiedLinks(true)
+	return policy
+}
+
+// RenderMarkdown converts user-supplied Markdown to sanitized HTML
+func RenderMarkdown(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return markdownPolicy.Sanitize(buf.String()), nil
+}
@@ -14,6 +14,8 @@ import (
 	"path/filepath"
 )
 
+const previewTokenType = "preview"
+
 func GenerateToken(user models.User) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": user.ID,
@@ -44,6 +46,11 @@ func ValidateToken(tokenString string, db interface{}) (jwt.MapClaims, error) {
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		log.Printf("Token claims: %+v", claims)
+		// Tokens issued for another purpose, such as preview links, are not
+		// session tokens
+		if _, ok := claims["typ"]; ok {
+			return nil, fmt.Errorf("token is not a session token")
+		}
 		return claims, nil
 	}
 
@@ -51,6 +58,44 @@ func ValidateToken(tokenString string, db interface{}) (jwt.MapClaims, error) {
 	return nil, fmt.Errorf("invalid token claims or signature")
 }
 
+// GeneratePreviewToken signs a token for the draft preview link linkID of
+// postID, valid until expiresAt
+func GeneratePreviewToken(linkID, postID uint, expiresAt time.Time) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ":     previewTokenType,
+		"link_id": linkID,
+		"post_id": postID,
+		"exp":     expiresAt.Unix(),
+	})
+
+	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+// ValidatePreviewToken checks the signature and expiry of a preview token and
+// returns the preview link and post it was issued for
+func ValidatePreviewToken(tokenString string) (linkID, postID uint, err error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["typ"] != previewTokenType {
+		return 0, 0, fmt.Errorf("invalid preview token")
+	}
+	link, linkOK := claims["link_id"].(float64)
+	post, postOK := claims["post_id"].(float64)
+	if !linkOK || !postOK {
+		return 0, 0, fmt.Errorf("invalid preview token claims")
+	}
+	return uint(link), uint(post), nil
+}
+
 // GenerateSlug creates a URL-friendly version of a string
 func GenerateSlug(title string) string {
 	return slug.Make(strings.ToLower(title))